@@ -1,12 +1,12 @@
 package main
 
 import (
+	"errors"
 	"go-rest/internal/database"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -22,7 +22,13 @@ type loginRequest struct {
 }
 
 type loginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
 // @Summary Login user
@@ -32,41 +38,152 @@ type loginResponse struct {
 // @Produce json
 // @Param loginRequest body loginRequest true "Login credentials"
 // @Success 200 {object} loginResponse
-// @Failure 400,401,404,500 {object} map[string]string
+// @Failure 400,401,404,500 {object} problem
 // @Router /auth/login [post]
 func (app *Application) login(c *gin.Context) {
 	var auth loginRequest
 	if err := c.ShouldBindJSON(&auth); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		bindError(c, err)
 		return
 	}
-	existingUser, err := app.models.Users.GetByEmail(auth.Email)
-	if existingUser == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	existingUser, err := app.models.Users.GetByEmail(c.Request.Context(), auth.Email)
+	if errors.Is(err, database.ErrNotFound) {
+		loginsFailed.WithLabelValues("unknown_user").Inc()
+		errorResponse(c, http.StatusNotFound, "User not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went Wrong in Getting User"})
+		serverError(c, err, "Something went Wrong in Getting User")
 		return
 	}
 	err = bcrypt.CompareHashAndPassword([]byte(existingUser.Password), []byte(auth.Password))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Password"})
+		loginsFailed.WithLabelValues("wrong_password").Inc()
+		errorResponse(c, http.StatusUnauthorized, "Invalid password")
 		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": existingUser.ID,
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(),
+	// The session and its first refresh token are created together, so a
+	// failure cannot leave a session behind that no token belongs to.
+	var tokens *loginResponse
+	err = app.models.WithTx(c.Request.Context(), func(tx database.Models) error {
+		session := database.Session{
+			UserID:    existingUser.ID,
+			ExpiresAt: time.Now().Add(app.refreshTokenTTL).UTC(),
+		}
+		if err := tx.Sessions.Insert(c.Request.Context(), &session); err != nil {
+			return err
+		}
+		issued, err := app.issueTokens(c.Request.Context(), tx, existingUser, &session)
+		tokens = issued
+		return err
 	})
-	tokenString, err := token.SignedString([]byte(app.jwtSecret))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went Wrong in Generating Token"})
+		serverError(c, err, "Something went Wrong in Creating Session")
 		return
 	}
-	c.JSON(http.StatusOK, loginResponse{Token: tokenString})
+	c.JSON(http.StatusOK, tokens)
 
 }
 
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new access/refresh token pair. Reusing an already rotated refresh token revokes the whole session.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param refreshRequest body refreshRequest true "Refresh token"
+// @Success 200 {object} loginResponse
+// @Failure 400,401,500 {object} problem
+// @Router /auth/refresh [post]
+func (app *Application) refresh(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		bindError(c, err)
+		return
+	}
+	// Looking the token up, marking it used and storing its successor happen
+	// in one transaction, so the token cannot be used up without a new one
+	// being issued.
+	var tokens *loginResponse
+	reused := false
+	err := app.models.WithTx(c.Request.Context(), func(tx database.Models) error {
+		refreshToken, err := tx.RefreshTokens.GetByHash(c.Request.Context(), hashToken(req.RefreshToken))
+		if errors.Is(err, database.ErrNotFound) {
+			return unauthorized("Invalid refresh token")
+		}
+		if err != nil {
+			return err
+		}
+		if time.Now().After(refreshToken.ExpiresAt) {
+			return unauthorized("Invalid refresh token")
+		}
+		session, err := tx.Sessions.Get(c.Request.Context(), refreshToken.SessionID)
+		if err != nil {
+			return err
+		}
+		if !session.Active() {
+			return unauthorized("Session revoked")
+		}
+		fresh, err := tx.RefreshTokens.MarkUsed(c.Request.Context(), refreshToken.ID)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			// The token was already rotated, so someone is replaying it.
+			// Kill the whole family so neither party can keep using it. The
+			// revocation has to be committed, so this is not an error.
+			reused = true
+			return tx.Sessions.Revoke(c.Request.Context(), session.ID)
+		}
+		user, err := tx.Users.GetUser(c.Request.Context(), session.UserID)
+		if err != nil {
+			return err
+		}
+		tokens, err = app.issueTokens(c.Request.Context(), tx, user, session)
+		return err
+	})
+	if err != nil {
+		handleError(c, err, "Something went Wrong in Rotating Refresh Token")
+		return
+	}
+	if reused {
+		errorResponse(c, http.StatusUnauthorized, "Refresh token reuse detected, session revoked")
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// @Summary Logout
+// @Description Revoke the current session
+// @Tags Auth
+// @Success 204
+// @Failure 401,500 {object} problem
+// @Router /auth/logout [post]
+// @Security BearerAuth
+func (app *Application) logout(c *gin.Context) {
+	sessionID := app.GetSessionIDFromContext(c)
+	if err := app.models.Sessions.Revoke(c.Request.Context(), sessionID); err != nil {
+		serverError(c, err, "Something went Wrong in Revoking Session")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Logout everywhere
+// @Description Revoke every session of the current user
+// @Tags Auth
+// @Success 204
+// @Failure 401,500 {object} problem
+// @Router /auth/logout-all [post]
+// @Security BearerAuth
+func (app *Application) logoutAll(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if err := app.models.Sessions.RevokeAllForUser(c.Request.Context(), user.ID); err != nil {
+		serverError(c, err, "Something went Wrong in Revoking Sessions")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
 // @Summary Register user
 // @Description Register a new user
 // @Tags Auth
@@ -74,17 +191,17 @@ func (app *Application) login(c *gin.Context) {
 // @Produce json
 // @Param registerRequest body registerRequest true "Registration info"
 // @Success 201 {object} database.User
-// @Failure 400,500 {object} map[string]string
+// @Failure 400,409,500 {object} problem
 // @Router /auth/register [post]
 func (app *Application) registerUser(c *gin.Context) {
 	var req registerRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		bindError(c, err)
 		return
 	}
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went Wrong in Generating Password"})
+		serverError(c, err, "Something went Wrong in Generating Password")
 		return
 	}
 
@@ -94,10 +211,18 @@ func (app *Application) registerUser(c *gin.Context) {
 		Password: req.Password,
 		UserName: req.UserName,
 	}
-	err = app.models.Users.Insert(&user)
+	err = app.models.Users.Insert(c.Request.Context(), &user)
+	var dbErr *database.Error
+	if errors.As(err, &dbErr) && dbErr.Kind == database.ErrDuplicate {
+		// The username and email columns are named like the fields.
+		fields := []fieldError{{Field: dbErr.Field, Rule: "unique", Detail: "is already taken"}}
+		writeProblem(c, http.StatusConflict, problemTypes[http.StatusConflict], "The "+dbErr.Field+" is already taken", fields)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went Wrong in Inserting User"})
+		serverError(c, err, "Something went Wrong in Inserting User")
 		return
 	}
+	usersRegistered.Inc()
 	c.JSON(http.StatusCreated, user)
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"go-rest/internal/database"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRegister(t *testing.T) {
+	app := newTestApp(t)
+	user, _ := app.signUp(t, "alice", "")
+	if user.ID == 0 || user.UserName != "alice" || user.Role != database.RoleOrganizer {
+		t.Errorf("registered user = %+v, want an organizer named alice", user)
+	}
+
+	rec := app.do(t, http.MethodPost, "/api/v1/auth/register", registerRequest{Email: "alice@example.com", Password: "password123", UserName: "alice2"}, "")
+	p := expectProblem(t, rec, http.StatusConflict, "/problems/conflict")
+	if len(p.Errors) != 1 || p.Errors[0].Field != "email" {
+		t.Errorf("errors of a taken email = %+v, want email", p.Errors)
+	}
+
+	rec = app.do(t, http.MethodPost, "/api/v1/auth/register", registerRequest{Email: "bob", Password: "short", UserName: "bob"}, "")
+	expectProblem(t, rec, http.StatusBadRequest, "/problems/validation-failed")
+}
+
+func TestLogin(t *testing.T) {
+	app := newTestApp(t)
+	_, tokens := app.signUp(t, "alice", "")
+	if tokens.Token == "" || tokens.RefreshToken == "" || tokens.ExpiresIn != 15*60 {
+		t.Errorf("tokens = %+v", tokens)
+	}
+
+	rec := app.do(t, http.MethodPost, "/api/v1/auth/login", loginRequest{Email: "alice@example.com", Password: "wrong-password"}, "")
+	expectProblem(t, rec, http.StatusUnauthorized, "/problems/unauthorized")
+	rec = app.do(t, http.MethodPost, "/api/v1/auth/login", loginRequest{Email: "nobody@example.com", Password: "password123"}, "")
+	expectProblem(t, rec, http.StatusNotFound, "/problems/not-found")
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	app := newTestApp(t)
+	_, tokens := app.signUp(t, "alice", "")
+	for name, header := range map[string]string{
+		"no token":      "",
+		"invalid token": "not-a-jwt",
+	} {
+		rec := app.do(t, http.MethodPost, "/api/v1/calendar/token", nil, header)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", name, rec.Code)
+		}
+	}
+	expect(t, app.do(t, http.MethodPost, "/api/v1/calendar/token", nil, tokens.Token), http.StatusCreated, nil)
+}
+
+func TestRefresh(t *testing.T) {
+	app := newTestApp(t)
+	_, tokens := app.signUp(t, "alice", "")
+
+	var rotated loginResponse
+	expect(t, app.do(t, http.MethodPost, "/api/v1/auth/refresh", refreshRequest{tokens.RefreshToken}, ""), http.StatusOK, &rotated)
+	if rotated.RefreshToken == tokens.RefreshToken {
+		t.Errorf("refresh did not rotate the refresh token")
+	}
+
+	// Replaying the rotated token revokes the session, so its successor
+	// stops working too.
+	rec := app.do(t, http.MethodPost, "/api/v1/auth/refresh", refreshRequest{tokens.RefreshToken}, "")
+	expectProblem(t, rec, http.StatusUnauthorized, "/problems/unauthorized")
+	rec = app.do(t, http.MethodPost, "/api/v1/auth/refresh", refreshRequest{rotated.RefreshToken}, "")
+	expectProblem(t, rec, http.StatusUnauthorized, "/problems/unauthorized")
+	rec = app.do(t, http.MethodPost, "/api/v1/auth/logout", nil, rotated.Token)
+	expectProblem(t, rec, http.StatusUnauthorized, "/problems/unauthorized")
+
+	rec = app.do(t, http.MethodPost, "/api/v1/auth/refresh", refreshRequest{"unknown"}, "")
+	expectProblem(t, rec, http.StatusUnauthorized, "/problems/unauthorized")
+}
+
+func TestLogout(t *testing.T) {
+	app := newTestApp(t)
+	_, first := app.signUp(t, "alice", "")
+	var second loginResponse
+	expect(t, app.do(t, http.MethodPost, "/api/v1/auth/login", loginRequest{Email: "alice@example.com", Password: "password123"}, ""), http.StatusOK, &second)
+
+	expect(t, app.do(t, http.MethodPost, "/api/v1/auth/logout", nil, first.Token), http.StatusNoContent, nil)
+	expectProblem(t, app.do(t, http.MethodPost, "/api/v1/auth/logout", nil, first.Token), http.StatusUnauthorized, "/problems/unauthorized")
+	expect(t, app.do(t, http.MethodPost, "/api/v1/auth/logout-all", nil, second.Token), http.StatusNoContent, nil)
+	expectProblem(t, app.do(t, http.MethodPost, "/api/v1/auth/refresh", refreshRequest{second.RefreshToken}, ""), http.StatusUnauthorized, "/problems/unauthorized")
+}
+
+// TestLogoutSurvivesSessionCleanup checks that an access token stays
+// rejected after logout, however the ended session is cleaned up and
+// whoever logs in next.
+func TestLogoutSurvivesSessionCleanup(t *testing.T) {
+	app := newTestApp(t)
+	_, tokens := app.signUp(t, "alice", "")
+	expect(t, app.do(t, http.MethodPost, "/api/v1/auth/logout", nil, tokens.Token), http.StatusNoContent, nil)
+
+	// The cleanup keeps the session while its access tokens are valid.
+	app.deleteEndedSessions(t.Context())
+	if _, err := app.models.Sessions.Get(t.Context(), app.sessionID(t, tokens.Token)); err != nil {
+		t.Errorf("session was deleted before its access token expired: %v", err)
+	}
+	expectProblem(t, app.do(t, http.MethodPost, "/api/v1/calendar/token", nil, tokens.Token), http.StatusUnauthorized, "/problems/unauthorized")
+
+	// Once the session is gone, its id is not given to the next login.
+	if _, err := app.models.Sessions.DeleteEnded(t.Context(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	var next loginResponse
+	expect(t, app.do(t, http.MethodPost, "/api/v1/auth/login", loginRequest{Email: "alice@example.com", Password: "password123"}, ""), http.StatusOK, &next)
+	if app.sessionID(t, next.Token) == app.sessionID(t, tokens.Token) {
+		t.Errorf("new login reused the id of the deleted session")
+	}
+	expectProblem(t, app.do(t, http.MethodPost, "/api/v1/calendar/token", nil, tokens.Token), http.StatusUnauthorized, "/problems/unauthorized")
+	expect(t, app.do(t, http.MethodPost, "/api/v1/calendar/token", nil, next.Token), http.StatusCreated, nil)
+}
+
+func TestRoleChangeInvalidatesTokens(t *testing.T) {
+	app := newTestApp(t)
+	user, tokens := app.signUp(t, "alice", "")
+	if err := app.models.Users.UpdateRole(t.Context(), user.ID, database.RoleMember); err != nil {
+		t.Fatal(err)
+	}
+	rec := app.do(t, http.MethodPost, "/api/v1/calendar/token", nil, tokens.Token)
+	expectProblem(t, rec, http.StatusUnauthorized, "/problems/unauthorized")
+
+	var refreshed loginResponse
+	expect(t, app.do(t, http.MethodPost, "/api/v1/auth/refresh", refreshRequest{tokens.RefreshToken}, ""), http.StatusOK, &refreshed)
+	expect(t, app.do(t, http.MethodPost, "/api/v1/calendar/token", nil, refreshed.Token), http.StatusCreated, nil)
+}
+
+// sessionID returns the session an access token is bound to.
+func (a *testApp) sessionID(t *testing.T, token string) int {
+	t.Helper()
+	claims, err := a.parseAccessToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims.SessionID
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-rest/internal/database"
+	"go-rest/internal/ical"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	calendarProdID          = "-//go-rest//Events//EN"
+	calendarRefreshInterval = time.Hour
+	// cancelledRetention is how long deleted events stay in calendar feeds,
+	// so that subscribers get to see them cancelled before they disappear.
+	cancelledRetention = 30 * 24 * time.Hour
+)
+
+type calendarTokenResponse struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// @Summary Export event as iCalendar
+// @Description Download a single event as an iCalendar (.ics) file. Recurring events include their rule and changed occurrences; deleted events are exported as cancelled.
+// @Tags Calendar
+// @Produce text/calendar
+// @Param id path int true "Event ID"
+// @Success 200 {string} string "iCalendar document"
+// @Failure 400,404,500 {object} problem
+// @Router /events/{id}.ics [get]
+func (app *Application) getEventCalendar(c *gin.Context, idParam string) {
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "Invalid event ID")
+		return
+	}
+	event, err := app.models.Events.GetWithDeleted(c.Request.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		errorResponse(c, http.StatusNotFound, "Event not found")
+		return
+	}
+	if err != nil {
+		serverError(c, err, "Failed to retrieve event")
+		return
+	}
+	cal := &ical.Calendar{ProdID: calendarProdID}
+	if err := app.addCalendarEvents(c, cal, []*database.Event{event}, ical.StatusConfirmed); err != nil {
+		serverError(c, err, "Failed to export event")
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="event-%d.ics"`, event.ID))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", cal.Encode())
+}
+
+// @Summary Create calendar feed
+// @Description Create a secret calendar feed URL listing the events the user is going to or might attend, for subscribing from calendar apps. Creating a new one invalidates the previous URL.
+// @Tags Calendar
+// @Produce json
+// @Success 201 {object} calendarTokenResponse
+// @Failure 401,500 {object} problem
+// @Router /calendar/token [post]
+// @Security BearerAuth
+func (app *Application) createCalendarToken(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	token, err := randomToken()
+	if err != nil {
+		serverError(c, err, "Failed to create calendar token")
+		return
+	}
+	if err := app.models.CalendarTokens.Set(c.Request.Context(), user.ID, hashToken(token)); err != nil {
+		serverError(c, err, "Failed to create calendar token")
+		return
+	}
+	c.JSON(http.StatusCreated, calendarTokenResponse{
+		Token: token,
+		URL:   app.calendarBaseURL + "/api/v1/calendar/" + token + ".ics",
+	})
+}
+
+// @Summary Revoke calendar feed
+// @Description Revoke the user's calendar feed URL
+// @Tags Calendar
+// @Success 204
+// @Failure 401,404,500 {object} problem
+// @Router /calendar/token [delete]
+// @Security BearerAuth
+func (app *Application) deleteCalendarToken(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if err := app.models.CalendarTokens.Delete(c.Request.Context(), user.ID); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			errorResponse(c, http.StatusNotFound, "No calendar feed to revoke")
+			return
+		}
+		serverError(c, err, "Failed to revoke calendar token")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Calendar feed
+// @Description iCalendar feed of the events the owner of the token is going to (confirmed) or might attend (tentative). Events deleted in the last 30 days are included as cancelled.
+// @Tags Calendar
+// @Produce text/calendar
+// @Param token path string true "Calendar token"
+// @Success 200 {string} string "iCalendar document"
+// @Failure 404,500 {object} problem
+// @Router /calendar/{token}.ics [get]
+func (app *Application) getCalendarFeed(c *gin.Context) {
+	token, ok := strings.CutSuffix(c.Param("token"), ".ics")
+	if !ok || token == "" {
+		errorResponse(c, http.StatusNotFound, "Calendar not found")
+		return
+	}
+	userID, err := app.models.CalendarTokens.GetUserID(c.Request.Context(), hashToken(token))
+	if errors.Is(err, database.ErrNotFound) {
+		errorResponse(c, http.StatusNotFound, "Calendar not found")
+		return
+	}
+	if err != nil {
+		serverError(c, err, "Failed to retrieve calendar")
+		return
+	}
+	user, err := app.models.Users.GetUser(c.Request.Context(), userID)
+	if err != nil {
+		serverError(c, err, "Failed to retrieve calendar")
+		return
+	}
+
+	cal := &ical.Calendar{
+		ProdID:          calendarProdID,
+		Name:            "Events of " + user.UserName,
+		RefreshInterval: calendarRefreshInterval,
+	}
+	for _, answer := range []struct{ rsvp, status string }{
+		{database.RSVPGoing, ical.StatusConfirmed},
+		{database.RSVPMaybe, ical.StatusTentative},
+	} {
+		events, err := app.allEventsByAttendee(c.Request.Context(), userID, database.EventFilter{
+			RSVP:         []string{answer.rsvp},
+			DeletedSince: time.Now().Add(-cancelledRetention),
+		})
+		if err == nil {
+			err = app.addCalendarEvents(c, cal, events, answer.status)
+		}
+		if err != nil {
+			serverError(c, err, "Failed to build calendar")
+			return
+		}
+	}
+	sort.SliceStable(cal.Events, func(i, j int) bool {
+		return cal.Events[i].Start.Before(cal.Events[j].Start)
+	})
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", cal.Encode())
+}
+
+// allEventsByAttendee walks every page of an attendee's events.
+func (app *Application) allEventsByAttendee(ctx context.Context, userID int, filter database.EventFilter) ([]*database.Event, error) {
+	var events []*database.Event
+	page := database.PageRequest{Limit: database.MaxPageLimit}
+	for {
+		result, err := app.models.Attendees.GetEventsByAttendee(ctx, userID, filter, page)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, result.Data...)
+		if result.NextCursor == "" {
+			return events, nil
+		}
+		page.Cursor = result.NextCursor
+	}
+}
+
+// addCalendarEvents adds the VEVENTs of the given events to cal. status is
+// used for events that have not been deleted.
+func (app *Application) addCalendarEvents(c *gin.Context, cal *ical.Calendar, events []*database.Event, status string) error {
+	var recurring []int
+	for _, e := range events {
+		if e.RRule != "" && e.DeletedAt == nil {
+			recurring = append(recurring, e.ID)
+		}
+	}
+	overrides, err := app.models.Events.GetOverrides(c.Request.Context(), recurring)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		vevents, err := app.calendarEvents(e, overrides[e.ID], status)
+		if err != nil {
+			return err
+		}
+		cal.Events = append(cal.Events, vevents...)
+	}
+	return nil
+}
+
+// calendarEvents converts an event into its VEVENTs: the event itself and,
+// for recurring events, one per changed or cancelled occurrence. All of them
+// share a UID derived from the event id, so re-importing an event updates it
+// instead of duplicating it.
+func (app *Application) calendarEvents(event *database.Event, overrides map[string]*database.OccurrenceOverride, status string) ([]*ical.Event, error) {
+	loc := event.Zone()
+	master := &ical.Event{
+		UID:         fmt.Sprintf("event-%d@%s", event.ID, app.calendarDomain),
+		Sequence:    event.Sequence,
+		Stamp:       event.UpdatedAt,
+		Start:       event.StartsAt,
+		End:         event.EndsAt,
+		TimeZone:    loc,
+		Summary:     event.Name,
+		Description: event.Description,
+		Location:    event.Location,
+		URL:         fmt.Sprintf("%s/api/v1/events/%d", app.calendarBaseURL, event.ID),
+		Status:      status,
+	}
+	if event.DeletedAt != nil {
+		master.Status = ical.StatusCancelled
+		return []*ical.Event{master}, nil
+	}
+
+	set, err := event.RecurrenceSet()
+	if err != nil || set == nil {
+		return []*ical.Event{master}, err
+	}
+	master.RRule = event.RRule
+	// EXDATE has to match the start time of the excluded occurrence.
+	start := event.StartsAt.In(loc)
+	for _, d := range set.ExDates {
+		master.ExDates = append(master.ExDates, time.Date(d.Year(), d.Month(), d.Day(),
+			start.Hour(), start.Minute(), start.Second(), 0, loc))
+	}
+
+	out := []*ical.Event{master}
+	originals := make([]string, 0, len(overrides))
+	for original := range overrides {
+		originals = append(originals, original)
+	}
+	sort.Strings(originals)
+	duration := event.EndsAt.Sub(event.StartsAt)
+	for _, original := range originals {
+		o := overrides[original]
+		day, err := time.ParseInLocation("2006-01-02", original, loc)
+		if err != nil {
+			return nil, err
+		}
+		occurrence, err := event.OccurrenceOn(day)
+		if err != nil {
+			return nil, err
+		}
+		if occurrence == nil {
+			// Left over from before the rule was changed.
+			continue
+		}
+		instance := *master
+		instance.RRule, instance.ExDates = "", nil
+		instance.RecurrenceID = *occurrence
+		instance.Start, instance.End = *occurrence, occurrence.Add(duration)
+		if o.StartsAt != nil {
+			instance.Start, instance.End = *o.StartsAt, o.StartsAt.Add(duration)
+		}
+		if o.EndsAt != nil {
+			instance.End = *o.EndsAt
+		}
+		if o.Name != nil {
+			instance.Summary = *o.Name
+		}
+		if o.Description != nil {
+			instance.Description = *o.Description
+		}
+		if o.Location != nil {
+			instance.Location = *o.Location
+		}
+		if o.Cancelled {
+			instance.Status = ical.StatusCancelled
+		}
+		out = append(out, &instance)
+	}
+	return out, nil
+}
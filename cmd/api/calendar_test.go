@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCalendarURLsIgnoreHost(t *testing.T) {
+	app := newTestApp(t)
+	_, tokens := app.signUp(t, "alice", "")
+	event := app.createEvent(t, tokens.Token, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/calendar/token", nil)
+	req.Host = "attacker.example"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("Authorization", "Bearer "+tokens.Token)
+	rec := httptest.NewRecorder()
+	app.handler.ServeHTTP(rec, req)
+	var feed calendarTokenResponse
+	expect(t, rec, http.StatusCreated, &feed)
+	if want := "https://events.example.com/api/v1/calendar/" + feed.Token + ".ics"; feed.URL != want {
+		t.Errorf("feed URL = %q, want %q", feed.URL, want)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/events/%d.ics", event.ID), nil)
+	req.Host = "attacker.example"
+	rec = httptest.NewRecorder()
+	app.handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body: %s", rec.Code, rec.Body)
+	}
+	if want := fmt.Sprintf("URL:https://events.example.com/api/v1/events/%d\r\n", event.ID); !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("exported event lacks %q:\n%s", want, rec.Body)
+	}
+}
@@ -17,3 +17,7 @@ func (app *Application) GetUserFromContext(c *gin.Context) *database.User {
 	}
 	return user
 }
+
+func (app *Application) GetSessionIDFromContext(c *gin.Context) int {
+	return c.GetInt("session_id")
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-rest/internal/database"
+	"go-rest/internal/logging"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// statusClientClosedRequest is the non-standard status nginx logs for
+// requests whose client disconnected before the response was ready.
+const statusClientClosedRequest = 499
+
+// problem is the body of every error response, an RFC 7807 problem details
+// object served as application/problem+json. Clients should tell errors
+// apart by Type, which never changes, rather than by Detail, which is meant
+// for people.
+type problem struct {
+	Type   string `json:"type" example:"/problems/not-found"`
+	Title  string `json:"title" example:"Not found"`
+	Status int    `json:"status" example:"404"`
+	Detail string `json:"detail,omitempty" example:"Event not found"`
+	// RequestID is the ID that the logs of the request carry.
+	RequestID string `json:"request_id,omitempty" example:"4bf92f3577b34da6a3ce929d0e0e4736"`
+	// Errors lists the invalid fields of a request body.
+	Errors []fieldError `json:"errors,omitempty"`
+}
+
+// fieldError is a field of a request body that failed validation.
+type fieldError struct {
+	// Field is the JSON path of the field, such as ends_at.
+	Field string `json:"field" example:"email"`
+	// Rule is the validation rule the value broke, such as required.
+	Rule   string `json:"rule" example:"email"`
+	Detail string `json:"detail" example:"must be an email address"`
+}
+
+// problemType is a kind of error, identified by a type URI relative to the
+// API's origin, or about:blank for statuses that need no more than their
+// title.
+type problemType struct {
+	code  string
+	title string
+}
+
+func (t problemType) uri() string {
+	if t.code == "" {
+		return "about:blank"
+	}
+	return "/problems/" + t.code
+}
+
+// problemTypes are the kinds of error answered with each status.
+var problemTypes = map[int]problemType{
+	http.StatusBadRequest:          {"bad-request", "Bad request"},
+	http.StatusUnauthorized:        {"unauthorized", "Unauthorized"},
+	http.StatusForbidden:           {"forbidden", "Forbidden"},
+	http.StatusNotFound:            {"not-found", "Not found"},
+	http.StatusConflict:            {"conflict", "Conflict"},
+	statusClientClosedRequest:      {"client-closed-request", "Client closed the request"},
+	http.StatusInternalServerError: {"internal", "Internal server error"},
+	http.StatusGatewayTimeout:      {"database-timeout", "The database did not respond in time"},
+}
+
+// validationFailed is the kind of the 400s answered to request bodies with
+// invalid fields, which come with the list of them.
+var validationFailed = problemType{"validation-failed", "Validation failed"}
+
+// writeProblem answers a request with a problem of type t.
+func writeProblem(c *gin.Context, status int, t problemType, detail string, fields []fieldError) {
+	c.Header("Content-Type", "application/problem+json")
+	c.JSON(status, problem{
+		Type:      t.uri(),
+		Title:     t.title,
+		Status:    status,
+		Detail:    detail,
+		RequestID: logging.RequestID(c.Request.Context()),
+		Errors:    fields,
+	})
+}
+
+// errorResponse answers a request with status and a problem of the kind
+// that goes with it, detail explaining it.
+func errorResponse(c *gin.Context, status int, detail string) {
+	t, ok := problemTypes[status]
+	if !ok {
+		t = problemType{title: http.StatusText(status)}
+	}
+	writeProblem(c, status, t, detail, nil)
+}
+
+// serverError responds to a request that failed with err, which is logged
+// with message. A database call cut short by the client going away or by
+// its deadline is not a fault of the server, so those get 499 and 504
+// instead of a 500, and a transaction that kept losing races with
+// concurrent ones gets a 409 that the client may retry. The error itself is
+// never shown to the client.
+func serverError(c *gin.Context, err error, message string) {
+	ctx := c.Request.Context()
+	switch {
+	case errors.Is(err, database.ErrConflict):
+		slog.WarnContext(ctx, "Transaction conflicted with concurrent ones", "error", err)
+		errorResponse(c, http.StatusConflict, "The request conflicted with concurrent ones, please retry")
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		slog.InfoContext(ctx, "Client closed the request", "error", err)
+		errorResponse(c, statusClientClosedRequest, "")
+	case errors.Is(err, context.DeadlineExceeded):
+		slog.WarnContext(ctx, "The database did not respond in time", "error", err)
+		errorResponse(c, http.StatusGatewayTimeout, "")
+	default:
+		slog.ErrorContext(ctx, message, "error", err)
+		errorResponse(c, http.StatusInternalServerError, "")
+	}
+}
+
+// requestError is an error that a request is answered with as it is, such
+// as a missing event or a forbidden change. It is how code that must not
+// write the response itself, such as the body of Models.WithTx, which may
+// run more than once, reports those.
+type requestError struct {
+	status int
+	detail string
+}
+
+func (e *requestError) Error() string { return e.detail }
+
+func badRequest(detail string) error   { return &requestError{http.StatusBadRequest, detail} }
+func unauthorized(detail string) error { return &requestError{http.StatusUnauthorized, detail} }
+func forbidden(detail string) error    { return &requestError{http.StatusForbidden, detail} }
+func notFound(detail string) error     { return &requestError{http.StatusNotFound, detail} }
+func conflict(detail string) error     { return &requestError{http.StatusConflict, detail} }
+
+// handleError responds to err: a requestError as it says, anything else
+// like serverError.
+func handleError(c *gin.Context, err error, message string) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		errorResponse(c, reqErr.status, reqErr.detail)
+		return
+	}
+	serverError(c, err, message)
+}
+
+// bindError responds to a request whose body could not be bound: with the
+// fields that failed validation, or with what is wrong with the JSON.
+func bindError(c *gin.Context, err error) {
+	var invalid validator.ValidationErrors
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var timeErr *time.ParseError
+	switch {
+	case errors.As(err, &invalid):
+		fields := make([]fieldError, 0, len(invalid))
+		for _, fe := range invalid {
+			fields = append(fields, fieldError{Field: fieldPath(fe), Rule: fe.Tag(), Detail: ruleDetail(fe)})
+		}
+		writeProblem(c, http.StatusBadRequest, validationFailed, "The request body has invalid fields", fields)
+	case errors.As(err, &typeErr):
+		fields := []fieldError{{Field: typeErr.Field, Rule: "type", Detail: "must be a " + jsonType(typeErr.Type)}}
+		writeProblem(c, http.StatusBadRequest, validationFailed, "The request body has invalid fields", fields)
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		errorResponse(c, http.StatusBadRequest, "The request body is not valid JSON")
+	case errors.Is(err, io.EOF):
+		errorResponse(c, http.StatusBadRequest, "The request body is empty")
+	case errors.As(err, &timeErr):
+		errorResponse(c, http.StatusBadRequest, fmt.Sprintf("Invalid time %q, expected RFC 3339 such as 2006-01-02T15:04:05Z", timeErr.Value))
+	default:
+		// The other values the JSON decoder could not parse report
+		// what they expected.
+		errorResponse(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+}
+
+// fieldPath returns the JSON path of the field, leaving out the name of the
+// request type the validator starts it with.
+func fieldPath(fe validator.FieldError) string {
+	_, path, _ := strings.Cut(fe.Namespace(), ".")
+	return path
+}
+
+// ruleDetail explains the validation rules used by the request types.
+func ruleDetail(fe validator.FieldError) string {
+	// Bounds of strings and lists are lengths, those of numbers values.
+	unit := ""
+	switch fe.Kind() {
+	case reflect.String:
+		unit = " characters long"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " items long"
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be an email address"
+	case "min":
+		return fmt.Sprintf("must be at least %s%s", fe.Param(), unit)
+	case "max":
+		return fmt.Sprintf("must be at most %s%s", fe.Param(), unit)
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "gtfield":
+		return "must be after " + jsonName(fe.Param(), fe)
+	case "timezone":
+		return "must be an IANA timezone such as Europe/Berlin"
+	case "datetime":
+		return "must be a date in the format " + fe.Param()
+	}
+	return "is invalid"
+}
+
+// jsonName returns the JSON name of the field of the struct that fe belongs
+// to whose Go name is field.
+func jsonName(field string, fe validator.FieldError) string {
+	path := fieldPath(fe)
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		path = path[:i+1]
+	} else {
+		path = ""
+	}
+	// The validator only knows the Go name of the other field; for the
+	// request types the JSON name is its snake case.
+	var b strings.Builder
+	for i, r := range field {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return path + strings.ToLower(b.String())
+}
+
+// jsonType names the JSON type of values decoded into t.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "object"
+}
+
+// useJSONFieldNames makes the validator name fields by their JSON names,
+// as clients know them.
+func useJSONFieldNames() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// postRaw posts body as it is, so that it can be malformed JSON.
+func (a *testApp) postRaw(t *testing.T, path, body, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBindErrors(t *testing.T) {
+	app := newTestApp(t)
+	_, tokens := app.signUp(t, "alice", "")
+	const valid = `"name": "Go meetup", "description": "Talks and pizza", "location": "Berlin", "starts_at": "2030-03-10T18:00:00Z"`
+	tests := []struct {
+		name   string
+		body   string
+		typ    string
+		detail string
+		// errors are the expected field errors as field, rule and detail.
+		errors [][3]string
+	}{
+		{
+			name: "empty body", body: "",
+			typ: "/problems/bad-request", detail: "The request body is empty",
+		},
+		{
+			name: "malformed JSON", body: `{"name": "Go meetup",`,
+			typ: "/problems/bad-request", detail: "The request body is not valid JSON",
+		},
+		{
+			name: "syntax error", body: `{"name" "Go meetup"}`,
+			typ: "/problems/bad-request", detail: "The request body is not valid JSON",
+		},
+		{
+			name: "malformed time", body: `{"starts_at": "tomorrow"}`,
+			typ: "/problems/bad-request", detail: `Invalid time "tomorrow", expected RFC 3339 such as 2006-01-02T15:04:05Z`,
+		},
+		{
+			name: "string for a number", body: `{` + valid + `, "ends_at": "2030-03-10T21:00:00Z", "capacity": "two"}`,
+			typ: "/problems/validation-failed", errors: [][3]string{{"capacity", "type", "must be a number"}},
+		},
+		{
+			name: "number for a string", body: `{"name": 42}`,
+			typ: "/problems/validation-failed", errors: [][3]string{{"name", "type", "must be a string"}},
+		},
+		{
+			name: "missing fields", body: `{"name": "Go", "timezone": "Mars/Olympus"}`,
+			typ: "/problems/validation-failed", errors: [][3]string{
+				{"name", "min", "must be at least 3 characters long"},
+				{"description", "required", "is required"},
+				{"starts_at", "required", "is required"},
+				{"ends_at", "required", "is required"},
+				{"timezone", "timezone", "must be an IANA timezone such as Europe/Berlin"},
+				{"location", "required", "is required"},
+			},
+		},
+		{
+			name: "ends before it starts", body: `{` + valid + `, "ends_at": "2030-03-10T17:00:00Z", "capacity": 0}`,
+			typ: "/problems/validation-failed", errors: [][3]string{
+				{"ends_at", "gtfield", "must be after starts_at"},
+				{"capacity", "min", "must be at least 1"},
+			},
+		},
+		{
+			name: "list element", body: `{` + valid + `, "ends_at": "2030-03-10T21:00:00Z", "rrule": "FREQ=WEEKLY", "exdates": ["2030-03-17", "24.03.2030"]}`,
+			typ: "/problems/validation-failed", errors: [][3]string{{"exdates[1]", "datetime", "must be a date in the format 2006-01-02"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := expectProblem(t, app.postRaw(t, "/api/v1/events", tt.body, tokens.Token), http.StatusBadRequest, tt.typ)
+			if tt.detail != "" && p.Detail != tt.detail {
+				t.Errorf("detail = %q, want %q", p.Detail, tt.detail)
+			}
+			if len(p.Errors) != len(tt.errors) {
+				t.Fatalf("errors = %+v, want %v", p.Errors, tt.errors)
+			}
+			for i, want := range tt.errors {
+				if got := p.Errors[i]; got.Field != want[0] || got.Rule != want[1] || got.Detail != want[2] {
+					t.Errorf("error %d = %+v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	app := newTestApp(t)
+	p := expectProblem(t, app.do(t, http.MethodGet, "/api/v1/events/9999", nil, ""), http.StatusNotFound, "/problems/not-found")
+	if p.Title != "Not found" || p.Detail != "Event not found" {
+		t.Errorf("problem = %+v", p)
+	}
+
+	// Statuses without a problem type of their own are about:blank.
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	errorResponse(c, http.StatusTeapot, "")
+	p = expectProblem(t, rec, http.StatusTeapot, "about:blank")
+	if p.Title != "I'm a teapot" {
+		t.Errorf("title = %q, want the status text", p.Title)
+	}
+}
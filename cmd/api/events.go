@@ -1,83 +1,193 @@
 package main
 
 import (
+	"errors"
 	"go-rest/internal/database"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 // @Summary Create event
-// @Description Create a new event
+// @Description Create a new event. starts_at and ends_at are RFC 3339 times and timezone is the IANA timezone the event takes place in (default UTC).
 // @Tags Events
 // @Accept json
 // @Produce json
 // @Param event body database.Event true "Event info"
 // @Success 201 {object} database.Event
-// @Failure 400,500 {object} map[string]string
+// @Failure 400,403,500 {object} problem
 // @Router /events [post]
 // @Security BearerAuth
 func (app *Application) createEvent(c *gin.Context) {
 	var event database.Event
 
 	if err := c.ShouldBindBodyWithJSON(&event); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		bindError(c, err)
+		return
+	}
+	if err := normalizeRecurrence(&event); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
 	user := app.GetUserFromContext(c)
 	event.OwnerId = user.ID
-	err := app.models.Events.Insert(&event)
+	err := app.models.Events.Insert(c.Request.Context(), &event)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error in Inserting Event"})
+		serverError(c, err, "Error in Inserting Event")
 		return
 	}
+	eventsCreated.Inc()
 
-	c.JSON(http.StatusCreated, event)
+	c.JSON(http.StatusCreated, renderEvent(&event, nil))
 }
 
 // @Summary Get all events
-// @Description Retrieve all events
+// @Description Retrieve events one page at a time, optionally filtered by date range, location and owner. Without expand, recurring events are listed once and filtered by their first date.
 // @Tags Events
 // @Produce json
-// @Success 200 {array} database.Event
-// @Failure 500 {object} map[string]string
+// @Param limit query int false "Page size (1-100, default 20)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field: id, starts_at or name; prefix with - for descending" default(id)
+// @Param from query string false "Only events starting on or after this UTC date (YYYY-MM-DD)"
+// @Param to query string false "Only events starting on or before this UTC date (YYYY-MM-DD)"
+// @Param tz query string false "IANA timezone to render times in; defaults to each event's own timezone"
+// @Param location query string false "Only events whose location contains this text"
+// @Param owner_id query int false "Only events owned by this user"
+// @Param expand query bool false "Expand recurring events into their occurrences between from and to (both required, at most 366 days apart); the response is then an occurrencePage sorted by start"
+// @Success 200 {object} eventPage
+// @Failure 400,500 {object} problem
 // @Router /events [get]
 func (app *Application) getAllEvents(c *gin.Context) {
-	events, err := app.models.Events.GetAll()
+	page, err := readPageRequest(c)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, err := readEventFilter(c)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	loc, err := readTimezone(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		errorResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
+	if c.Query("expand") == "true" {
+		if ok, msg := readOccurrenceWindow(filter); !ok {
+			errorResponse(c, http.StatusBadRequest, msg)
+			return
+		}
+		occurrences, err := app.models.Events.ListOccurrences(c.Request.Context(), filter, page)
+		if err != nil {
+			if isPageError(err) {
+				errorResponse(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			serverError(c, err, "Failed to retrieve events")
+			return
+		}
+		renderOccurrences(occurrences.Data, loc)
+		c.JSON(http.StatusOK, occurrences)
+		return
+	}
+	events, err := app.models.Events.List(c.Request.Context(), filter, page)
+	if err != nil {
+		if isPageError(err) {
+			errorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		serverError(c, err, "Failed to retrieve events")
+		return
+	}
+	renderEvents(events.Data, loc)
 	c.JSON(http.StatusOK, events)
 }
 
+type searchResponse struct {
+	Data []*database.EventSearchResult `json:"data"`
+}
+
+// @Summary Search events
+// @Description Full-text search over event names, descriptions and locations, best matches first. Words must all match, "quoted text" matches a phrase, word* matches a prefix and OR between terms matches either.
+// @Tags Events
+// @Produce json
+// @Param q query string true "Search query"
+// @Param limit query int false "Maximum number of results (1-100, default 20)"
+// @Param tz query string false "IANA timezone to render times in; defaults to each event's own timezone"
+// @Success 200 {object} searchResponse
+// @Failure 400,500 {object} problem
+// @Router /events/search [get]
+func (app *Application) searchEvents(c *gin.Context) {
+	q := c.Query("q")
+	if q == "" {
+		errorResponse(c, http.StatusBadRequest, "Query parameter q is required")
+		return
+	}
+	page, err := readPageRequest(c)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	loc, err := readTimezone(c)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	results, err := app.models.Events.Search(c.Request.Context(), q, page.Limit)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidSearch) {
+			errorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		serverError(c, err, "Failed to search events")
+		return
+	}
+	for _, r := range results {
+		r.Event = *renderEvent(&r.Event, loc)
+	}
+	c.JSON(http.StatusOK, searchResponse{Data: results})
+}
+
 // @Summary Get event by ID
 // @Description Retrieve event by ID
 // @Tags Events
 // @Produce json
 // @Param id path int true "Event ID"
+// @Param tz query string false "IANA timezone to render times in; defaults to each event's own timezone"
 // @Success 200 {object} database.Event
-// @Failure 400,404,500 {object} map[string]string
+// @Failure 400,404,500 {object} problem
 // @Router /events/{id} [get]
 func (app *Application) getEvent(c *gin.Context) {
+	// gin cannot route /events/:id.ics separately from /events/:id.
+	if idParam, ok := strings.CutSuffix(c.Param("id"), ".ics"); ok {
+		app.getEventCalendar(c, idParam)
+		return
+	}
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		errorResponse(c, http.StatusBadRequest, "Invalid event ID")
+		return
+	}
+	loc, err := readTimezone(c)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	event, err := app.models.Events.Get(id)
-	if event == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	event, err := app.models.Events.Get(c.Request.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		errorResponse(c, http.StatusNotFound, "Event not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		serverError(c, err, "Failed to get event")
 		return
 	}
-	c.JSON(http.StatusOK, event)
+	c.JSON(http.StatusOK, renderEvent(event, loc))
 }
 
 // @Summary Update event
@@ -88,40 +198,52 @@ func (app *Application) getEvent(c *gin.Context) {
 // @Param id path int true "Event ID"
 // @Param event body database.Event true "Event info"
 // @Success 200 {object} database.Event
-// @Failure 400,403,404,500 {object} map[string]string
+// @Failure 400,403,404,500 {object} problem
 // @Router /events/{id} [put]
 // @Security BearerAuth
 func (app *Application) updateEvent(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		errorResponse(c, http.StatusBadRequest, "Invalid event ID")
 		return
 	}
 	user := app.GetUserFromContext(c)
-	existingEvent, err := app.models.Events.Get(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve event"})
-		return
-	}
-	if existingEvent == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "event not found"})
-		return
-	}
-	if existingEvent.OwnerId != user.ID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not Authorize"})
-		return
-	}
 	updatedEvent := &database.Event{}
 	if err := c.ShouldBindJSON(updatedEvent); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		bindError(c, err)
+		return
+	}
+	if err := normalizeRecurrence(updatedEvent); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
 	updatedEvent.ID = id // Ensure the ID is set to the existing event's ID
-	if err := app.models.Events.Update(updatedEvent); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event"})
+	var event *database.Event
+	err = app.models.WithTx(c.Request.Context(), func(tx database.Models) error {
+		existingEvent, err := tx.Events.Get(c.Request.Context(), id)
+		if errors.Is(err, database.ErrNotFound) {
+			return notFound("Event not found")
+		}
+		if err != nil {
+			return err
+		}
+		if !canModifyEvent(user, existingEvent) {
+			return forbidden("You are not allowed to change this event")
+		}
+		updatedEvent.OwnerId = existingEvent.OwnerId
+		if err := tx.Events.Update(c.Request.Context(), updatedEvent); err != nil {
+			return err
+		}
+		// The event is read back to answer with it as stored, such as with
+		// its times to the second, rather than as the body put it.
+		event, err = tx.Events.Get(c.Request.Context(), id)
+		return err
+	})
+	if err != nil {
+		handleError(c, err, "Failed to update event")
 		return
 	}
-	c.JSON(http.StatusOK, updatedEvent)
+	c.JSON(http.StatusOK, renderEvent(event, nil))
 }
 
 // @Summary Delete event
@@ -129,32 +251,31 @@ func (app *Application) updateEvent(c *gin.Context) {
 // @Tags Events
 // @Param id path int true "Event ID"
 // @Success 204
-// @Failure 400,403,404,500 {object} map[string]string
+// @Failure 400,403,404,500 {object} problem
 // @Router /events/{id} [delete]
 // @Security BearerAuth
 func (app *Application) deleteEvent(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		errorResponse(c, http.StatusBadRequest, "Invalid event ID")
 		return
 	}
 	user := app.GetUserFromContext(c)
-	existingEvent, err := app.models.Events.Get(id)
-	if existingEvent == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Event Not Found"})
-		return
-	}
-	if existingEvent.OwnerId != user.ID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not Authorize to Delete"})
-		return
-	}
-	err = app.models.Events.Delete(id)
-	if err != nil {
-		if err.Error() == "record not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "event not found"})
-			return
+	err = app.models.WithTx(c.Request.Context(), func(tx database.Models) error {
+		existingEvent, err := tx.Events.Get(c.Request.Context(), id)
+		if errors.Is(err, database.ErrNotFound) {
+			return notFound("Event not found")
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete event"})
+		if err != nil {
+			return err
+		}
+		if !canModifyEvent(user, existingEvent) {
+			return forbidden("You are not allowed to delete this event")
+		}
+		return tx.Events.Delete(c.Request.Context(), id)
+	})
+	if err != nil {
+		handleError(c, err, "Failed to delete event")
 		return
 	}
 
@@ -162,148 +283,218 @@ func (app *Application) deleteEvent(c *gin.Context) {
 }
 
 // @Summary Add attendee to event
-// @Description Add an attendee to an event
+// @Description Add an attendee to an event. When the event is at capacity the attendee is waitlisted instead.
 // @Tags Attendees
-// @Param event_id path int true "Event ID"
+// @Param id path int true "Event ID"
 // @Param user_id path int true "User ID"
 // @Success 201 {object} database.Attendee
-// @Failure 400,403,404,409,500 {object} map[string]string
-// @Router /events/{event_id}/attendees/{user_id} [post]
+// @Failure 400,403,404,409,500 {object} problem
+// @Router /events/{id}/attendees/{user_id} [post]
 // @Security BearerAuth
 func (app *Application) addAttendeeToEvent(c *gin.Context) {
-	eventId, err := strconv.Atoi(c.Param("event_id"))
+	eventId, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		errorResponse(c, http.StatusBadRequest, "Invalid event ID")
 		return
 	}
 	userID, err := strconv.Atoi(c.Param("user_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		errorResponse(c, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
-	// Retrieve the event and user from the database
-	event, err := app.models.Events.Get(eventId)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve event"})
-		return
-	}
-	if event == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
-		return
-	}
 	user := app.GetUserFromContext(c)
-	if event.OwnerId != user.ID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not Authorize to Add Attendee"})
-		return
-	}
-	// Retrieve the user from the database
-	userToAdd, err := app.models.Users.GetUser(userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
-		return
-	}
-	if userToAdd == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
-	}
-
-	existingAttendee, err := app.models.Attendees.GetByEventAndAttendee(event.ID, userToAdd.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve existing attendee"})
-		return
-	}
-	if existingAttendee != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Attendee Already Exists"})
-		return
-	}
-	// Add the attendee to the event
-	attendee := database.Attendee{EventID: event.ID, UserID: userToAdd.ID}
-	_, err = app.models.Attendees.Insert(&attendee)
+	var attendee database.Attendee
+	// The check for an existing attendee and the insert share a
+	// transaction, so concurrent requests cannot add the user twice.
+	err = app.models.WithTx(c.Request.Context(), func(tx database.Models) error {
+		event, err := tx.Events.Get(c.Request.Context(), eventId)
+		if errors.Is(err, database.ErrNotFound) {
+			return notFound("Event not found")
+		}
+		if err != nil {
+			return err
+		}
+		if !canModifyEvent(user, event) {
+			return forbidden("You are not allowed to add attendees to this event")
+		}
+		userToAdd, err := tx.Users.GetUser(c.Request.Context(), userID)
+		if errors.Is(err, database.ErrNotFound) {
+			return notFound("User not found")
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.Attendees.GetByEventAndAttendee(c.Request.Context(), event.ID, userToAdd.ID)
+		if err == nil {
+			return conflict("The user already attends this event")
+		}
+		if !errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+		attendee = database.Attendee{EventID: event.ID, UserID: userToAdd.ID}
+		_, err = tx.Attendees.Insert(c.Request.Context(), &attendee)
+		if errors.Is(err, database.ErrDuplicate) {
+			return conflict("The user already attends this event")
+		}
+		return err
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add attendee"})
+		handleError(c, err, "Failed to add attendee")
 		return
 	}
+	countRegistration(nil, &attendee)
 	c.JSON(http.StatusCreated, attendee)
 }
 
 // @Summary Get attendees for event
-// @Description Get all attendees for an event
+// @Description Get the attendees of an event one page at a time, including their registration status and waitlist position
 // @Tags Attendees
 // @Param id path int true "Event ID"
-// @Success 200 {array} database.User
-// @Failure 400,500 {object} map[string]string
+// @Param limit query int false "Page size (1-100, default 20)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field: id or username; prefix with - for descending" default(id)
+// @Success 200 {object} attendeePage
+// @Failure 400,500 {object} problem
 // @Router /events/{id}/attendees [get]
 func (app *Application) getAttendeesForEvent(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		errorResponse(c, http.StatusBadRequest, "Invalid event ID")
+		return
+	}
+	page, err := readPageRequest(c)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
-	users, err := app.models.Attendees.GetAttendeesByEvent(id)
+	users, err := app.models.Attendees.GetAttendeesByEvent(c.Request.Context(), id, page)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attendees"})
+		if isPageError(err) {
+			errorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		serverError(c, err, "Failed to retrieve attendees")
 		return
 	}
 	c.JSON(http.StatusOK, users)
 }
 
 // @Summary Delete attendee from event
-// @Description Delete an attendee from an event
+// @Description Delete an attendee from an event. If a seat frees up, the oldest waitlisted attendee is promoted.
 // @Tags Attendees
 // @Param id path int true "Event ID"
 // @Param user_id path int true "User ID"
 // @Success 200 {string} string "Attendee Delete Successfully"
-// @Failure 400,403,404,500 {object} map[string]string
+// @Failure 400,403,404,500 {object} problem
 // @Router /events/{id}/attendees/{user_id} [delete]
 // @Security BearerAuth
 func (app *Application) deleteAttendeeFromEvent(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		errorResponse(c, http.StatusBadRequest, "Invalid event ID")
 		return
 	}
 	userID, err := strconv.Atoi(c.Param("user_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		errorResponse(c, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
-	event, err := app.models.Events.Get(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something Went Wrong"})
-	}
-	if event == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Event Not Found"})
-	}
 	user := app.GetUserFromContext(c)
-	if event.OwnerId != user.ID {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "You ate not Auth to Delete Attendee from Event"})
-	}
-	err = app.models.Attendees.Delete(id, userID)
+	var before *database.Attendee
+	err = app.models.WithTx(c.Request.Context(), func(tx database.Models) error {
+		event, err := tx.Events.Get(c.Request.Context(), id)
+		if errors.Is(err, database.ErrNotFound) {
+			return notFound("Event not found")
+		}
+		if err != nil {
+			return err
+		}
+		if !canModifyEvent(user, event) {
+			return forbidden("You are not allowed to remove attendees from this event")
+		}
+		before, err = tx.Attendees.GetByEventAndAttendee(c.Request.Context(), id, userID)
+		if errors.Is(err, database.ErrNotFound) {
+			return notFound("Attendee not found")
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Attendees.Delete(c.Request.Context(), id, userID)
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attendee"})
+		handleError(c, err, "Failed to delete attendee")
 		return
 	}
+	countRegistration(before, nil)
 
 	c.JSON(http.StatusOK, "Attendee Delete Successfully")
 }
 
 // @Summary Get events by attendee
-// @Description Get all events for an attendee
+// @Description Get the events of an attendee one page at a time, with the same filters as GET /events
 // @Tags Attendees
 // @Param id path int true "Attendee ID"
-// @Success 200 {array} database.Event
-// @Failure 400,500 {object} map[string]string
+// @Param limit query int false "Page size (1-100, default 20)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field: id, starts_at or name; prefix with - for descending" default(id)
+// @Param from query string false "Only events starting on or after this UTC date (YYYY-MM-DD)"
+// @Param to query string false "Only events starting on or before this UTC date (YYYY-MM-DD)"
+// @Param tz query string false "IANA timezone to render times in; defaults to each event's own timezone"
+// @Param location query string false "Only events whose location contains this text"
+// @Param owner_id query int false "Only events owned by this user"
+// @Param expand query bool false "Expand recurring events into their occurrences between from and to (both required, at most 366 days apart); the response is then an occurrencePage sorted by start"
+// @Success 200 {object} eventPage
+// @Failure 400,500 {object} problem
 // @Router /attendees/{id}/events [get]
 func (app *Application) getEventsByAttendee(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Attendee ID"})
+		errorResponse(c, http.StatusBadRequest, "Invalid attendee ID")
+		return
 	}
-	events, err := app.models.Attendees.GetEventsByAttendee(id)
+	page, err := readPageRequest(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve events"})
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, err := readEventFilter(c)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	loc, err := readTimezone(c)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if c.Query("expand") == "true" {
+		if ok, msg := readOccurrenceWindow(filter); !ok {
+			errorResponse(c, http.StatusBadRequest, msg)
+			return
+		}
+		occurrences, err := app.models.Attendees.GetOccurrencesByAttendee(c.Request.Context(), id, filter, page)
+		if err != nil {
+			if isPageError(err) {
+				errorResponse(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			serverError(c, err, "Failed to retrieve events")
+			return
+		}
+		renderOccurrences(occurrences.Data, loc)
+		c.JSON(http.StatusOK, occurrences)
+		return
+	}
+	events, err := app.models.Attendees.GetEventsByAttendee(c.Request.Context(), id, filter, page)
+	if err != nil {
+		if isPageError(err) {
+			errorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		serverError(c, err, "Failed to retrieve events")
 		return
 	}
+	renderEvents(events.Data, loc)
 	c.JSON(http.StatusOK, events)
 }
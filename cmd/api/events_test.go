@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"go-rest/internal/database"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestEventCRUD(t *testing.T) {
+	app := newTestApp(t)
+	owner, tokens := app.signUp(t, "alice", "")
+	event := app.createEvent(t, tokens.Token, map[string]any{"timezone": "Europe/Berlin", "capacity": 2})
+	if event.ID == 0 || event.OwnerId != owner.ID || event.Timezone != "Europe/Berlin" || *event.Capacity != 2 {
+		t.Fatalf("created event = %+v", event)
+	}
+	// Times are rendered in the event's timezone.
+	if _, offset := event.StartsAt.Zone(); offset != 3600 {
+		t.Errorf("starts_at = %v, want it in Europe/Berlin", event.StartsAt)
+	}
+
+	path := fmt.Sprintf("/api/v1/events/%d", event.ID)
+	var got database.Event
+	expect(t, app.do(t, http.MethodGet, path, nil, ""), http.StatusOK, &got)
+	if got.Name != "Go meetup" || !got.StartsAt.Equal(time.Date(2030, 3, 10, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("fetched event = %+v", got)
+	}
+
+	update := map[string]any{
+		"name":        "Go meetup #2",
+		"description": "Talks and more pizza",
+		"location":    "Hamburg",
+		"starts_at":   "2030-03-11T18:00:00.5Z",
+		"ends_at":     "2030-03-11T21:00:00Z",
+		"owner_id":    owner.ID + 1,
+	}
+	expect(t, app.do(t, http.MethodPut, path, update, tokens.Token), http.StatusOK, &got)
+	if got.Name != "Go meetup #2" || got.Location != "Hamburg" || got.OwnerId != owner.ID {
+		t.Errorf("updated event = %+v", got)
+	}
+	// The answer is the event as stored, not the body.
+	if !got.StartsAt.Equal(time.Date(2030, 3, 11, 18, 0, 0, 0, time.UTC)) || got.Timezone != "UTC" {
+		t.Errorf("updated event = %+v, want it starting at 18:00:00 UTC", got)
+	}
+
+	var page database.Page[*database.Event]
+	expect(t, app.do(t, http.MethodGet, "/api/v1/events?location=Hamburg", nil, ""), http.StatusOK, &page)
+	if page.Total != 1 || page.Data[0].ID != event.ID {
+		t.Errorf("events in Hamburg = %+v", page)
+	}
+
+	expect(t, app.do(t, http.MethodDelete, path, nil, tokens.Token), http.StatusNoContent, nil)
+	expectProblem(t, app.do(t, http.MethodGet, path, nil, ""), http.StatusNotFound, "/problems/not-found")
+	expectProblem(t, app.do(t, http.MethodDelete, path, nil, tokens.Token), http.StatusNotFound, "/problems/not-found")
+	expectProblem(t, app.do(t, http.MethodPut, path, update, tokens.Token), http.StatusNotFound, "/problems/not-found")
+}
+
+func TestEventValidation(t *testing.T) {
+	app := newTestApp(t)
+	_, tokens := app.signUp(t, "alice", "")
+	rec := app.do(t, http.MethodPost, "/api/v1/events", map[string]any{
+		"name":        "Go meetup",
+		"description": "Talks and pizza",
+		"location":    "Berlin",
+		"starts_at":   "2030-03-10T18:00:00Z",
+		"ends_at":     "2030-03-10T17:00:00Z",
+	}, tokens.Token)
+	p := expectProblem(t, rec, http.StatusBadRequest, "/problems/validation-failed")
+	if len(p.Errors) != 1 || p.Errors[0].Field != "ends_at" || p.Errors[0].Rule != "gtfield" {
+		t.Errorf("errors = %+v, want ends_at before starts_at", p.Errors)
+	}
+	expectProblem(t, app.do(t, http.MethodGet, "/api/v1/events/abc", nil, ""), http.StatusBadRequest, "/problems/bad-request")
+	expectProblem(t, app.do(t, http.MethodGet, "/api/v1/events/9999", nil, ""), http.StatusNotFound, "/problems/not-found")
+}
+
+func TestEventPermissions(t *testing.T) {
+	app := newTestApp(t)
+	_, owner := app.signUp(t, "alice", "")
+	_, other := app.signUp(t, "bob", "")
+	_, member := app.signUp(t, "carol", database.RoleMember)
+	_, admin := app.signUp(t, "dave", database.RoleAdmin)
+	event := app.createEvent(t, owner.Token, nil)
+	path := fmt.Sprintf("/api/v1/events/%d", event.ID)
+
+	expectProblem(t, app.do(t, http.MethodPost, "/api/v1/events", map[string]any{}, ""), http.StatusUnauthorized, "/problems/unauthorized")
+	expectProblem(t, app.do(t, http.MethodPost, "/api/v1/events", map[string]any{}, member.Token), http.StatusForbidden, "/problems/forbidden")
+	expectProblem(t, app.do(t, http.MethodDelete, path, nil, other.Token), http.StatusForbidden, "/problems/forbidden")
+	expectProblem(t, app.do(t, http.MethodDelete, path, nil, member.Token), http.StatusForbidden, "/problems/forbidden")
+	// Admins moderate every event.
+	expect(t, app.do(t, http.MethodDelete, path, nil, admin.Token), http.StatusNoContent, nil)
+}
+
+func TestAttendees(t *testing.T) {
+	app := newTestApp(t)
+	_, owner := app.signUp(t, "alice", "")
+	bob, other := app.signUp(t, "bob", "")
+	carol, _ := app.signUp(t, "carol", "")
+	event := app.createEvent(t, owner.Token, map[string]any{"capacity": 1})
+	attendees := fmt.Sprintf("/api/v1/events/%d/attendees", event.ID)
+
+	var attendee database.Attendee
+	expect(t, app.do(t, http.MethodPost, fmt.Sprintf("%s/%d", attendees, bob.ID), nil, owner.Token), http.StatusCreated, &attendee)
+	if attendee.Status != database.AttendeeRegistered {
+		t.Errorf("first attendee = %+v, want registered", attendee)
+	}
+	expect(t, app.do(t, http.MethodPost, fmt.Sprintf("%s/%d", attendees, carol.ID), nil, owner.Token), http.StatusCreated, &attendee)
+	if attendee.Status != database.AttendeeWaitlisted {
+		t.Errorf("attendee beyond the capacity = %+v, want waitlisted", attendee)
+	}
+	expectProblem(t, app.do(t, http.MethodPost, fmt.Sprintf("%s/%d", attendees, bob.ID), nil, owner.Token), http.StatusConflict, "/problems/conflict")
+	expectProblem(t, app.do(t, http.MethodPost, attendees+"/9999", nil, owner.Token), http.StatusNotFound, "/problems/not-found")
+	expectProblem(t, app.do(t, http.MethodPost, fmt.Sprintf("%s/%d", attendees, carol.ID), nil, other.Token), http.StatusForbidden, "/problems/forbidden")
+
+	var page database.Page[*database.EventAttendee]
+	expect(t, app.do(t, http.MethodGet, attendees, nil, ""), http.StatusOK, &page)
+	if page.Total != 2 {
+		t.Errorf("attendees = %+v, want 2", page)
+	}
+
+	// Removing bob frees his seat for carol.
+	expect(t, app.do(t, http.MethodDelete, fmt.Sprintf("%s/%d", attendees, bob.ID), nil, owner.Token), http.StatusOK, nil)
+	expectProblem(t, app.do(t, http.MethodDelete, fmt.Sprintf("%s/%d", attendees, bob.ID), nil, owner.Token), http.StatusNotFound, "/problems/not-found")
+	expect(t, app.do(t, http.MethodGet, attendees, nil, ""), http.StatusOK, &page)
+	if len(page.Data) != 1 || page.Data[0].ID != carol.ID || page.Data[0].Status != database.AttendeeRegistered {
+		t.Errorf("attendees after removing bob = %+v, want carol registered", page.Data)
+	}
+
+	var events database.Page[*database.Event]
+	expect(t, app.do(t, http.MethodGet, fmt.Sprintf("/api/v1/attendees/%d/events", carol.ID), nil, ""), http.StatusOK, &events)
+	if len(events.Data) != 1 || events.Data[0].ID != event.ID {
+		t.Errorf("events of carol = %+v", events.Data)
+	}
+}
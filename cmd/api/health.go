@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-rest/cmd/migrate/migrations"
+	"go-rest/internal/database"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// version and commit describe the build. They are set with
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD)"
+//
+// and otherwise taken from the version control information Go embeds.
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// checkTimeout bounds each readiness check.
+const checkTimeout = 2 * time.Second
+
+// healthCheck is one of the conditions of readiness.
+type healthCheck struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// checkResult is the outcome of a health check as reported by /readyz.
+type checkResult struct {
+	Status     string  `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// readinessChecks returns the checks of the database that /readyz runs:
+// that it answers, that its schema is the one this build expects, and for
+// SQLite that the disk it is on can be written to.
+func readinessChecks(db *sql.DB, dialect database.Dialect, databaseURL string) []healthCheck {
+	checks := []healthCheck{
+		{"database", db.PingContext},
+		{"migrations", func(ctx context.Context) error {
+			state, err := migrations.CurrentState(ctx, db, dialect)
+			if err != nil {
+				return err
+			}
+			return state.Check()
+		}},
+	}
+	if file := database.SQLiteFile(databaseURL); file != "" {
+		checks = append(checks, healthCheck{"disk", func(ctx context.Context) error {
+			return checkWritable(filepath.Dir(file))
+		}})
+	}
+	return checks
+}
+
+// checkWritable creates and removes a file in dir, where SQLite keeps its
+// journal next to the database.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte("ok"))
+	return errors.Join(err, f.Close(), os.Remove(f.Name()))
+}
+
+// getHealth reports that the process is alive and serving. It checks
+// nothing else, so that an orchestrator does not restart the API because
+// its database is down.
+func (app *Application) getHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// getReadiness reports whether the API can take traffic, with the outcome
+// and duration of each check. It fails as soon as shutdown begins, so that
+// load balancers stop sending requests while the ones in flight drain.
+func (app *Application) getReadiness(c *gin.Context) {
+	if !app.lifecycle.ready.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting down"})
+		return
+	}
+	status, code := "ready", http.StatusOK
+	results := map[string]checkResult{}
+	for _, check := range app.readinessChecks {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), checkTimeout)
+		start := time.Now()
+		err := check.run(ctx)
+		cancel()
+		result := checkResult{Status: "ok", DurationMS: float64(time.Since(start).Microseconds()) / 1000}
+		if err != nil {
+			result.Status, result.Error = "failing", err.Error()
+			status, code = "not ready", http.StatusServiceUnavailable
+		}
+		results[check.name] = result
+	}
+	c.JSON(code, gin.H{"status": status, "checks": results})
+}
+
+// getVersion reports what build is running and the schema version it
+// expects.
+func (app *Application) getVersion(c *gin.Context) {
+	info := gin.H{
+		"version":        version,
+		"commit":         commit,
+		"go_version":     runtime.Version(),
+		"schema_version": app.schemaVersion,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if commit == "" {
+					info["commit"] = setting.Value
+				}
+			case "vcs.time":
+				info["commit_time"] = setting.Value
+			case "vcs.modified":
+				info["modified"] = setting.Value == "true"
+			}
+		}
+	}
+	c.JSON(http.StatusOK, info)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"go-rest/internal/config"
+	"math/big"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// minRSABits is the smallest RSA key accepted for signing tokens.
+const minRSABits = 2048
+
+// signingKey is a key that signs or verifies access tokens.
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	// private signs tokens. It is nil for keys that only verify the
+	// tokens they signed before their private half was retired.
+	private interface{}
+	// public verifies tokens; for HMAC keys it is the secret itself.
+	public interface{}
+}
+
+// loadKeys reads the configured keys, the one that signs new tokens first.
+func loadKeys(keys []config.JWTKey) ([]signingKey, error) {
+	var loaded []signingKey
+	for _, key := range keys {
+		if key.File == "" {
+			secret := []byte(key.Secret)
+			loaded = append(loaded, signingKey{id: key.ID, method: jwt.SigningMethodHS256, private: secret, public: secret})
+			continue
+		}
+		k, err := loadKeyFile(key)
+		if err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, k)
+	}
+	if len(loaded) > 0 && loaded[0].private == nil {
+		return nil, fmt.Errorf("JWT key %q signs new tokens but %s holds only a public key", loaded[0].id, keys[0].File)
+	}
+	return loaded, nil
+}
+
+// loadKeyFile reads an RSA or Ed25519 key, private or public, from a PEM
+// file.
+func loadKeyFile(key config.JWTKey) (signingKey, error) {
+	data, err := os.ReadFile(key.File)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("JWT key %q: %w", key.ID, err)
+	}
+	k := signingKey{id: key.ID}
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		k.method, k.private, k.public = jwt.SigningMethodRS256, private, &private.PublicKey
+	} else if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+		k.method, k.private, k.public = jwt.SigningMethodEdDSA, private, private.(ed25519.PrivateKey).Public()
+	} else if public, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		k.method, k.public = jwt.SigningMethodRS256, public
+	} else if public, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		k.method, k.public = jwt.SigningMethodEdDSA, public
+	} else {
+		return signingKey{}, fmt.Errorf("JWT key %q: %s holds no RSA or Ed25519 key in PEM format", key.ID, key.File)
+	}
+	if public, ok := k.public.(*rsa.PublicKey); ok && public.N.BitLen() < minRSABits {
+		return signingKey{}, fmt.Errorf("JWT key %q: RSA keys must have at least %d bits, %s has %d", key.ID, minRSABits, key.File, public.N.BitLen())
+	}
+	return k, nil
+}
+
+// jwk returns the public key in JWK format, or nil for HMAC keys, whose
+// secret must not be published.
+func (k signingKey) jwk() gin.H {
+	encode := base64.RawURLEncoding.EncodeToString
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		return gin.H{
+			"kty": "RSA",
+			"kid": k.id,
+			"use": "sig",
+			"alg": k.method.Alg(),
+			"n":   encode(public.N.Bytes()),
+			"e":   encode(big.NewInt(int64(public.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return gin.H{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"kid": k.id,
+			"use": "sig",
+			"alg": k.method.Alg(),
+			"x":   encode(public),
+		}
+	}
+	return nil
+}
+
+// getJWKS publishes the public halves of the RSA and Ed25519 keys as a JSON
+// Web Key Set, for other services to verify access tokens with. It is
+// served outside /api/v1, where verifiers look for it, and so is not part
+// of the Swagger docs.
+func (app *Application) getJWKS(c *gin.Context) {
+	keys := []gin.H{}
+	for _, key := range app.jwtKeys {
+		if jwk := key.jwk(); jwk != nil {
+			keys = append(keys, jwk)
+		}
+	}
+	// Verifiers may cache the set, but not for long, so that a new key
+	// is picked up soon after it is added.
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
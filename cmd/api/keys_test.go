@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"go-rest/internal/config"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// writePEM writes der as a PEM block of the given type to a file in a
+// temporary directory and returns its path.
+func writePEM(t *testing.T, typ string, der []byte) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func rsaKey(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func edKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func marshalPKIX(t *testing.T, public any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func marshalPKCS8(t *testing.T, private any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	rsaPrivate := rsaKey(t, 2048)
+	edPrivate := edKey(t)
+	tests := []struct {
+		name    string
+		file    string
+		method  jwt.SigningMethod
+		private bool
+	}{
+		{"RSA private PKCS#1", writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPrivate)), jwt.SigningMethodRS256, true},
+		{"RSA private PKCS#8", writePEM(t, "PRIVATE KEY", marshalPKCS8(t, rsaPrivate)), jwt.SigningMethodRS256, true},
+		{"Ed25519 private", writePEM(t, "PRIVATE KEY", marshalPKCS8(t, edPrivate)), jwt.SigningMethodEdDSA, true},
+		{"RSA public", writePEM(t, "PUBLIC KEY", marshalPKIX(t, &rsaPrivate.PublicKey)), jwt.SigningMethodRS256, false},
+		{"Ed25519 public", writePEM(t, "PUBLIC KEY", marshalPKIX(t, edPrivate.Public())), jwt.SigningMethodEdDSA, false},
+	}
+	for _, tt := range tests {
+		k, err := loadKeyFile(config.JWTKey{ID: "k1", File: tt.file})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if k.id != "k1" || k.method != tt.method || (k.private != nil) != tt.private || k.public == nil {
+			t.Errorf("%s: loaded %+v, want %s with private key %v", tt.name, k, tt.method.Alg(), tt.private)
+		}
+	}
+}
+
+func TestLoadKeyFileErrors(t *testing.T) {
+	tests := []struct {
+		name, file, want string
+	}{
+		{"small RSA key", writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey(t, 1024))), "at least 2048 bits"},
+		{"small RSA public key", writePEM(t, "PUBLIC KEY", marshalPKIX(t, &rsaKey(t, 1024).PublicKey)), "at least 2048 bits"},
+		{"no key", writePEM(t, "CERTIFICATE", []byte("garbage")), "holds no RSA or Ed25519 key"},
+		{"missing file", filepath.Join(t.TempDir(), "missing.pem"), "no such file"},
+	}
+	for _, tt := range tests {
+		if _, err := loadKeyFile(config.JWTKey{ID: "k1", File: tt.file}); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestLoadKeysNeedsPrivateSigningKey(t *testing.T) {
+	public := writePEM(t, "PUBLIC KEY", marshalPKIX(t, edKey(t).Public()))
+	if _, err := loadKeys([]config.JWTKey{{ID: "old", File: public}, {ID: "new", Secret: "secret"}}); err == nil {
+		t.Errorf("loadKeys with a public key first succeeded, want an error")
+	}
+	keys, err := loadKeys([]config.JWTKey{{ID: "new", Secret: "secret"}, {ID: "old", File: public}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].method != jwt.SigningMethodHS256 || keys[1].private != nil {
+		t.Errorf("loaded keys = %+v", keys)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaPrivate := rsaKey(t, 2048)
+	edPrivate := edKey(t)
+	app := newTestApp(t)
+	app.jwtKeys = []signingKey{
+		{id: "rsa", method: jwt.SigningMethodRS256, private: rsaPrivate, public: &rsaPrivate.PublicKey},
+		{id: "ed", method: jwt.SigningMethodEdDSA, private: edPrivate, public: edPrivate.Public()},
+		{id: "hmac", method: jwt.SigningMethodHS256, private: testSecret, public: testSecret},
+	}
+
+	rec := app.do(t, http.MethodGet, "/.well-known/jwks.json", nil, "")
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	expect(t, rec, http.StatusOK, &set)
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=300" {
+		t.Errorf("Cache-Control = %q", cc)
+	}
+	// The HMAC secret is never published.
+	if len(set.Keys) != 2 {
+		t.Fatalf("keys = %v, want the RSA and Ed25519 keys", set.Keys)
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	wantRSA := map[string]string{
+		"kty": "RSA", "kid": "rsa", "use": "sig", "alg": "RS256",
+		"n": encode(rsaPrivate.N.Bytes()),
+		"e": encode(big.NewInt(int64(rsaPrivate.E)).Bytes()),
+	}
+	wantEd := map[string]string{
+		"kty": "OKP", "crv": "Ed25519", "kid": "ed", "use": "sig", "alg": "EdDSA",
+		"x": encode(edPrivate.Public().(ed25519.PublicKey)),
+	}
+	for i, want := range []map[string]string{wantRSA, wantEd} {
+		if len(set.Keys[i]) != len(want) {
+			t.Errorf("key %d = %v, want %v", i, set.Keys[i], want)
+			continue
+		}
+		for k, v := range want {
+			if set.Keys[i][k] != v {
+				t.Errorf("key %d: %s = %q, want %q", i, k, set.Keys[i][k], v)
+			}
+		}
+	}
+	if set.Keys[0]["e"] != "AQAB" {
+		t.Errorf("e = %q, want AQAB", set.Keys[0]["e"])
+	}
+}
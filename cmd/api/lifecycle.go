@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// lifecycle runs the background workers of the application next to the
+// HTTP server and tracks whether the application is ready for traffic.
+type lifecycle struct {
+	ready   atomic.Bool
+	workers []*worker
+}
+
+// worker is a background job that runs until its context is cancelled.
+type worker struct {
+	name   string
+	run    func(ctx context.Context)
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// register adds a worker, to be started with the server. Workers are
+// stopped in the reverse order, so a worker may rely on those registered
+// before it until it has stopped itself.
+func (l *lifecycle) register(name string, run func(ctx context.Context)) {
+	l.workers = append(l.workers, &worker{name: name, run: run})
+}
+
+// start starts every registered worker.
+func (l *lifecycle) start() {
+	for _, w := range l.workers {
+		ctx, cancel := context.WithCancel(context.Background())
+		w.cancel, w.done = cancel, make(chan struct{})
+		go func() {
+			defer close(w.done)
+			w.run(ctx)
+		}()
+	}
+}
+
+// stop stops the workers one after the other, newest first, abandoning
+// those that have not returned when ctx ends.
+func (l *lifecycle) stop(ctx context.Context) {
+	for i := len(l.workers) - 1; i >= 0; i-- {
+		w := l.workers[i]
+		if w.cancel == nil {
+			continue
+		}
+		w.cancel()
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			slog.Warn("Worker did not stop in time", "worker", w.name)
+		}
+	}
+}
+
+// every returns a worker body that calls fn every interval until its
+// context is cancelled. An interval of zero or less disables the worker.
+func every(interval time.Duration, fn func(ctx context.Context)) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		if interval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			fn(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// deleteEndedSessions removes the expired and revoked sessions, and with
+// them their refresh tokens, which can never be used again. A session is
+// kept for an access token lifetime after it ended, so that it outlives
+// every access token naming it.
+func (app *Application) deleteEndedSessions(ctx context.Context) {
+	n, err := app.models.Sessions.DeleteEnded(ctx, time.Now().Add(-app.accessTokenTTL))
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Deleting ended sessions failed", "error", err)
+		}
+		return
+	}
+	if n > 0 {
+		slog.InfoContext(ctx, "Deleted ended sessions", "count", n)
+	}
+}
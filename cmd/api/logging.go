@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"go-rest/internal/logging"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validRequestID matches the X-Request-ID values taken over from clients
+// and proxies; anything else is replaced, so that it cannot forge log lines.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestID gives every request an ID, taken from its X-Request-ID header
+// if it has a usable one, and returns it in the X-Request-ID response
+// header. The ID travels with the request context into every log record.
+func (app *Application) RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !validRequestID.MatchString(id) {
+			b := make([]byte, 16)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		c.Header("X-Request-ID", id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// AccessLog logs every request once it has been answered, as an error if
+// the server failed it.
+func (app *Application) AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// Calendar feed URLs carry a secret token, so only their route
+		// is logged.
+		path := c.Request.URL.Path
+		if route := c.FullPath(); strings.Contains(route, ":token") {
+			path = route
+		}
+		level := slog.LevelInfo
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.Int("status", c.Writer.Status()),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if user := app.GetUserFromContext(c); user != nil && user.ID != 0 {
+			attrs = append(attrs, slog.Int("user_id", user.ID))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "Request", attrs...)
+	}
+}
+
+// Recovery answers a request whose handler panicked with a 500 and logs
+// the panic with its stack.
+func (app *Application) Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		slog.ErrorContext(c.Request.Context(), "Handler panicked", "panic", err, "stack", string(debug.Stack()))
+		errorResponse(c, http.StatusInternalServerError, "")
+		c.Abort()
+	})
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"flag"
+	"fmt"
+	"go-rest/cmd/migrate/migrations"
+	"go-rest/internal/config"
 	"go-rest/internal/database"
-	"go-rest/internal/env"
-	"log"
+	"go-rest/internal/logging"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
 
 	_ "go-rest/docs" // Import generated Swagger docs
 
+	"github.com/gin-gonic/gin"
 	_ "github.com/joho/godotenv/autoload" // Automatically load .env file
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	// Swagger handler
 	// Swagger files
 )
@@ -27,30 +36,136 @@ import (
 // @schemes http https
 
 type Application struct {
-	port      int
-	jwtSecret string
-	models    database.Models
+	port           int
+	trustedProxies []string
+	// shutdownDelay and shutdownTimeout pace the shutdown; see serve.
+	shutdownDelay   time.Duration
+	shutdownTimeout time.Duration
+	// jwtKeys verify access tokens by their kid header; the first one
+	// signs new tokens.
+	jwtKeys []signingKey
+	// issuer and audience are the iss and aud claims of access tokens.
+	issuer   string
+	audience string
+	// accessTokenTTL and refreshTokenTTL are the lifetimes of the tokens
+	// issued on login and refresh.
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	// calendarDomain is the domain part of the UIDs of exported events.
+	calendarDomain string
+	// calendarBaseURL is the public URL of the API without a trailing
+	// slash, which calendar feed and event URLs start with.
+	calendarBaseURL string
+	models          database.Models
+	lifecycle       lifecycle
+	// readinessChecks are run by /readyz.
+	readinessChecks []healthCheck
+	// schemaVersion is the newest migration this build knows.
+	schemaVersion uint
 }
 
 func main() {
-	db, err := sql.Open("sqlite3", "./data.db")
+	flags := flag.NewFlagSet("api", flag.ExitOnError)
+	printConfig := flags.Bool("print-config", false, "print the effective configuration, secrets redacted, and exit")
+	cfg, err := config.Load(flags, os.Args[1:])
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+	if *printConfig {
+		cfg.Print(os.Stdout)
+		return
+	}
+
+	slog.SetDefault(logging.New(os.Stdout, cfg.Log.Format, cfg.Log.Level))
+	if cfg.Server.Environment != config.Development {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	shutdownTracing, err := setupTracing(cfg.Tracing)
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
+		}
+	}()
+
+	jwtKeys, err := loadKeys(cfg.Auth.Keys())
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+
+	if cfg.Database.AutoMigrate {
+		if err := migrations.Up(cfg.Database.URL, migrationLogger{}); err != nil {
+			fatal("Failed to migrate the database", err)
+		}
+	}
+	state, err := migrations.ReadState(cfg.Database.URL)
 	if err != nil {
-		log.Fatalf("Failed to connect to the database: %v", err)
+		fatal("Failed to read the database schema version", err)
+	}
+	if err := state.Check(); err != nil {
+		if !state.Dirty {
+			err = fmt.Errorf("%w, or set DB_AUTO_MIGRATE=true", err)
+		}
+		fatal("Refusing to start", err)
 	}
-	_, err = db.Exec("PRAGMA foreign_keys = ON;")
+	if state.Ahead() {
+		slog.Warn("The database schema is newer than this build expects", "version", state.Version, "expected", state.Latest)
+	}
+
+	db, dialect, err := database.Open(cfg.Database.URL)
 	if err != nil {
-		log.Fatalf("Failed to enable foreign keys: %v", err)
+		fatal("Failed to connect to the database", err)
 	}
 	defer db.Close()
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, "main"))
 
-	models := database.NewModels(db)
+	models := database.NewModels(db, dialect, database.Timeouts{
+		Read:      cfg.Database.ReadTimeout,
+		Write:     cfg.Database.WriteTimeout,
+		Search:    cfg.Database.SearchTimeout,
+		SlowQuery: cfg.Database.SlowQueryThreshold,
+	})
 	app := &Application{
-		port:      env.GetEnvInt("PORT", 8080),
-		jwtSecret: env.GetEnvString("JWT_SECRET", "secret"),
-		models:    models,
+		port:            cfg.Server.Port,
+		trustedProxies:  cfg.Server.TrustedProxies,
+		shutdownDelay:   cfg.Server.ShutdownDelay,
+		shutdownTimeout: cfg.Server.ShutdownTimeout,
+		jwtKeys:         jwtKeys,
+		issuer:          cfg.Auth.Issuer,
+		audience:        cfg.Auth.Audience,
+		accessTokenTTL:  cfg.Auth.AccessTokenTTL,
+		refreshTokenTTL: cfg.Auth.RefreshTokenTTL,
+		calendarDomain:  cfg.Calendar.Domain,
+		calendarBaseURL: strings.TrimSuffix(cfg.Calendar.BaseURL, "/"),
+		models:          models,
+		readinessChecks: readinessChecks(db, dialect, cfg.Database.URL),
+		schemaVersion:   state.Latest,
 	}
 
+	app.lifecycle.register("session cleanup", every(cfg.Auth.SessionCleanupInterval, app.deleteEndedSessions))
+
 	if err := app.serve(); err != nil {
-		log.Fatalf("Error starting server: %v", err)
+		fatal("Error starting server", err)
 	}
 }
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// migrationLogger logs the migrations applied on startup.
+type migrationLogger struct{}
+
+func (migrationLogger) Printf(format string, v ...any) {
+	slog.Info("migrate: " + strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+func (migrationLogger) Verbose() bool { return false }
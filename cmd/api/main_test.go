@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-rest/internal/database"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// The handler tests run the routes on in-memory models, so they need no
+// database and each test starts empty.
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// testApp is an Application on in-memory models with its routes.
+type testApp struct {
+	*Application
+	handler http.Handler
+}
+
+var testSecret = []byte("test-secret")
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+	app := &Application{
+		jwtKeys:         []signingKey{{method: jwt.SigningMethodHS256, private: testSecret, public: testSecret}},
+		issuer:          "go-rest",
+		audience:        "go-rest",
+		accessTokenTTL:  15 * time.Minute,
+		refreshTokenTTL: 24 * time.Hour,
+		calendarDomain:  "events.example.com",
+		calendarBaseURL: "https://events.example.com",
+		models:          database.NewMemoryModels(),
+	}
+	return &testApp{Application: app, handler: app.routes()}
+}
+
+// do sends a request to the app. body, unless nil, is sent as JSON and
+// token, unless empty, as a bearer token.
+func (a *testApp) do(t *testing.T, method, path string, body any, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, r)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// expect fails the test unless the response has the given status, and
+// decodes its body into v unless v is nil.
+func expect(t *testing.T, rec *httptest.ResponseRecorder, status int, v any) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, status, rec.Body)
+	}
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("decoding %s: %v", rec.Body, err)
+		}
+	}
+}
+
+// expectProblem fails the test unless the response is a problem of the
+// given status and type, and returns it.
+func expectProblem(t *testing.T, rec *httptest.ResponseRecorder, status int, typ string) problem {
+	t.Helper()
+	var p problem
+	expect(t, rec, status, &p)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q, want application/problem+json", ct)
+	}
+	if p.Type != typ || p.Status != status {
+		t.Errorf("problem = %+v, want type %s and status %d", p, typ, status)
+	}
+	return p
+}
+
+// signUp registers name as name@example.com with the given role and logs
+// them in.
+func (a *testApp) signUp(t *testing.T, name, role string) (*database.User, loginResponse) {
+	t.Helper()
+	rec := a.do(t, http.MethodPost, "/api/v1/auth/register", registerRequest{Email: name + "@example.com", Password: "password123", UserName: name}, "")
+	var user database.User
+	expect(t, rec, http.StatusCreated, &user)
+	if role != "" && role != user.Role {
+		if err := a.models.Users.UpdateRole(t.Context(), user.ID, role); err != nil {
+			t.Fatal(err)
+		}
+		user.Role = role
+	}
+	rec = a.do(t, http.MethodPost, "/api/v1/auth/login", loginRequest{Email: name + "@example.com", Password: "password123"}, "")
+	var tokens loginResponse
+	expect(t, rec, http.StatusOK, &tokens)
+	return &user, tokens
+}
+
+// createEvent creates an event owned by the holder of token.
+func (a *testApp) createEvent(t *testing.T, token string, event map[string]any) *database.Event {
+	t.Helper()
+	body := map[string]any{
+		"name":        "Go meetup",
+		"description": "Talks and pizza",
+		"location":    "Berlin",
+		"starts_at":   "2030-03-10T18:00:00Z",
+		"ends_at":     "2030-03-10T21:00:00Z",
+	}
+	for k, v := range event {
+		body[k] = v
+	}
+	var created database.Event
+	expect(t, a.do(t, http.MethodPost, "/api/v1/events", body, token), http.StatusCreated, &created)
+	return &created
+}
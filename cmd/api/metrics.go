@@ -0,0 +1,87 @@
+package main
+
+import (
+	"go-rest/internal/database"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// The HTTP metrics are labelled by route template, such as
+// /api/v1/events/:id, so that every event does not get series of its own.
+// Requests that match no route share the route "unmatched".
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Requests answered, by method, route and status.",
+	}, []string{"method", "route", "status"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to answer requests, by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	httpRequestsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Requests being answered, by method and route.",
+	}, []string{"method", "route"})
+)
+
+var (
+	eventsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "events_created_total",
+		Help: "Events created.",
+	})
+	usersRegistered = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "users_registered_total",
+		Help: "Users registered.",
+	})
+	loginsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "logins_failed_total",
+		Help: "Failed logins, by reason: unknown_user or wrong_password.",
+	}, []string{"reason"})
+	eventRegistrations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_registrations_total",
+		Help: "Changes of attendees to and from going, by status: going, waitlisted or cancelled.",
+	}, []string{"status"})
+)
+
+// countRegistration records in eventRegistrations an attendee's change from
+// before to after. Either is nil when the user does not attend the event.
+// Only answering going, or no longer going, counts; a waitlisted attendee
+// who is promoted later is not counted again.
+func countRegistration(before, after *database.Attendee) {
+	going := func(a *database.Attendee) bool { return a != nil && a.RSVP == database.RSVPGoing }
+	switch {
+	case !going(before) && going(after):
+		if after.Status == database.AttendeeWaitlisted {
+			eventRegistrations.WithLabelValues("waitlisted").Inc()
+		} else {
+			eventRegistrations.WithLabelValues("going").Inc()
+		}
+	case going(before) && !going(after):
+		eventRegistrations.WithLabelValues("cancelled").Inc()
+	}
+}
+
+// Metrics records the HTTP metrics of every request.
+func (app *Application) Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		inFlight := httpRequestsInFlight.WithLabelValues(method, route)
+		inFlight.Inc()
+		start := time.Now()
+
+		c.Next()
+
+		inFlight.Dec()
+		httpRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	}
+}
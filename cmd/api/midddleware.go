@@ -1,58 +1,72 @@
 package main
 
 import (
-	"fmt"
+	"errors"
+	"go-rest/internal/database"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 )
 
 func (app *Application) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing"})
+			errorResponse(c, http.StatusUnauthorized, "Authorization header missing")
 			c.Abort()
 			return
 		}
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == authHeader {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Authorization header"})
+			errorResponse(c, http.StatusUnauthorized, "Invalid Authorization header")
 			c.Abort()
 			return
 		}
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(app.jwtSecret), nil
-		})
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		claims, err := app.parseAccessToken(tokenString)
+		if err != nil {
+			errorResponse(c, http.StatusUnauthorized, "Invalid token")
+			c.Abort()
+			return
+		}
+		userID, err := strconv.Atoi(claims.Subject)
+		if err != nil {
+			errorResponse(c, http.StatusUnauthorized, "Invalid user ID")
 			c.Abort()
 			return
 		}
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid claims"})
+		session, err := app.models.Sessions.Get(c.Request.Context(), claims.SessionID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			serverError(c, err, "Something went Wrong in Getting Session")
 			c.Abort()
 			return
 		}
-		userID, ok := claims["user_id"].(float64)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		if err != nil || session.UserID != userID || !session.Active() {
+			errorResponse(c, http.StatusUnauthorized, "Session revoked")
+			c.Abort()
+			return
+		}
+		user, err := app.models.Users.GetUser(c.Request.Context(), userID)
+		if errors.Is(err, database.ErrNotFound) {
+			errorResponse(c, http.StatusUnauthorized, "Invalid user ID")
 			c.Abort()
 			return
 		}
-		user, err := app.models.Users.GetUser(int(userID))
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+			serverError(c, err, "Something went Wrong in Getting User")
+			c.Abort()
+			return
+		}
+		// The role is carried in the token but the database is the source of
+		// truth; a token minted before a role change must not keep working.
+		if claims.Role != user.Role {
+			errorResponse(c, http.StatusUnauthorized, "Token role is out of date, please refresh")
 			c.Abort()
 			return
 		}
 		c.Set("user", user)
+		c.Set("session_id", session.ID)
 		c.Next()
 	}
 }
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"go-rest/internal/database"
+	"go-rest/internal/recurrence"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxOccurrenceWindow bounds how far a listing expands recurring events.
+const maxOccurrenceWindow = 366 * 24 * time.Hour
+
+// occurrenceRequest changes one occurrence. Moving StartsAt alone keeps the
+// event's duration.
+type occurrenceRequest struct {
+	Cancelled   bool       `json:"cancelled"`
+	Name        *string    `json:"name" binding:"omitempty,min=3,max=255"`
+	Description *string    `json:"description" binding:"omitempty,min=10,max=100"`
+	StartsAt    *time.Time `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+	Location    *string    `json:"location" binding:"omitempty,min=3,max=255"`
+}
+
+// normalizeRecurrence validates the recurrence rule of an event and stores it
+// in canonical form.
+func normalizeRecurrence(event *database.Event) error {
+	if event.RRule == "" {
+		event.ExDates = nil
+		return nil
+	}
+	rule, err := recurrence.Parse(event.RRule)
+	if err != nil {
+		return err
+	}
+	event.RRule = rule.String()
+	return nil
+}
+
+// readOccurrenceWindow checks that an expanded listing has a bounded window.
+func readOccurrenceWindow(filter database.EventFilter) (bool, string) {
+	if filter.From == "" || filter.To == "" {
+		return false, "from and to are required when expand=true"
+	}
+	from, _ := time.Parse("2006-01-02", filter.From)
+	to, _ := time.Parse("2006-01-02", filter.To)
+	if to.Before(from) {
+		return false, "to must not be before from"
+	}
+	if to.Sub(from) > maxOccurrenceWindow {
+		return false, "the window between from and to must not exceed 366 days"
+	}
+	return true, ""
+}
+
+// @Summary Override occurrence
+// @Description Change or cancel a single occurrence of a recurring event without touching the rest of the series. Fields left out keep the series' value; an empty body restores the occurrence.
+// @Tags Events
+// @Accept json
+// @Produce json
+// @Param id path int true "Event ID"
+// @Param date path string true "Date the series puts the occurrence on (YYYY-MM-DD)"
+// @Param occurrenceRequest body occurrenceRequest true "Override"
+// @Success 200 {object} database.OccurrenceOverride
+// @Failure 400,403,404,500 {object} problem
+// @Router /events/{id}/occurrences/{date} [put]
+// @Security BearerAuth
+func (app *Application) overrideOccurrence(c *gin.Context) {
+	var req occurrenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		bindError(c, err)
+		return
+	}
+	id, day, ok := readOccurrence(c)
+	if !ok {
+		return
+	}
+	user := app.GetUserFromContext(c)
+	var override *database.OccurrenceOverride
+	var zone *time.Location
+	err := app.models.WithTx(c.Request.Context(), func(tx database.Models) error {
+		target, err := findOccurrence(c.Request.Context(), tx, user, id, day)
+		if err != nil {
+			return err
+		}
+		event := target.event
+		start, end := target.start, target.start.Add(event.EndsAt.Sub(event.StartsAt))
+		if req.StartsAt != nil {
+			start, end = *req.StartsAt, req.StartsAt.Add(event.EndsAt.Sub(event.StartsAt))
+		}
+		if req.EndsAt != nil {
+			end = *req.EndsAt
+		}
+		if !end.After(start) {
+			return badRequest("ends_at must be after starts_at")
+		}
+		override = &database.OccurrenceOverride{
+			EventID:      event.ID,
+			OriginalDate: target.originalDate,
+			Cancelled:    req.Cancelled,
+			Name:         req.Name,
+			Description:  req.Description,
+			StartsAt:     req.StartsAt,
+			EndsAt:       req.EndsAt,
+			Location:     req.Location,
+		}
+		zone = event.Zone()
+		return tx.Events.SetOverride(c.Request.Context(), override)
+	})
+	if err != nil {
+		handleError(c, err, "Failed to save occurrence")
+		return
+	}
+	c.JSON(http.StatusOK, renderOverride(override, zone))
+}
+
+// @Summary Cancel occurrence
+// @Description Cancel a single occurrence of a recurring event
+// @Tags Events
+// @Param id path int true "Event ID"
+// @Param date path string true "Date the series puts the occurrence on (YYYY-MM-DD)"
+// @Success 204
+// @Failure 400,403,404,500 {object} problem
+// @Router /events/{id}/occurrences/{date} [delete]
+// @Security BearerAuth
+func (app *Application) cancelOccurrence(c *gin.Context) {
+	id, day, ok := readOccurrence(c)
+	if !ok {
+		return
+	}
+	user := app.GetUserFromContext(c)
+	err := app.models.WithTx(c.Request.Context(), func(tx database.Models) error {
+		target, err := findOccurrence(c.Request.Context(), tx, user, id, day)
+		if err != nil {
+			return err
+		}
+		override := &database.OccurrenceOverride{EventID: target.event.ID, OriginalDate: target.originalDate, Cancelled: true}
+		return tx.Events.SetOverride(c.Request.Context(), override)
+	})
+	if err != nil {
+		handleError(c, err, "Failed to cancel occurrence")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// occurrenceTarget is the occurrence of a recurring event addressed by a
+// request, with the start the series gives it.
+type occurrenceTarget struct {
+	event        *database.Event
+	originalDate string
+	start        time.Time
+}
+
+// readOccurrence reads the event id and occurrence date in the URL and
+// writes an error response if they are malformed.
+func readOccurrence(c *gin.Context) (int, string, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "Invalid event ID")
+		return 0, "", false
+	}
+	if _, err := time.Parse("2006-01-02", c.Param("date")); err != nil {
+		errorResponse(c, http.StatusBadRequest, "Invalid occurrence date, expected YYYY-MM-DD")
+		return 0, "", false
+	}
+	return id, c.Param("date"), true
+}
+
+// findOccurrence resolves the occurrence of an event on a date and checks
+// that the user may modify the event.
+func findOccurrence(ctx context.Context, models database.Models, user *database.User, id int, day string) (*occurrenceTarget, error) {
+	event, err := models.Events.Get(ctx, id)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, notFound("Event not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !canModifyEvent(user, event) {
+		return nil, forbidden("You are not allowed to change this event")
+	}
+	if event.RRule == "" {
+		return nil, badRequest("Event is not recurring, update the event instead")
+	}
+	// The date is the local date of the occurrence in the event's timezone.
+	date, _ := time.ParseInLocation("2006-01-02", day, event.Zone())
+	start, err := event.OccurrenceOn(date)
+	if err != nil {
+		return nil, err
+	}
+	if start == nil {
+		return nil, notFound("Event has no occurrence on that date")
+	}
+	return &occurrenceTarget{event: event, originalDate: date.Format("2006-01-02"), start: *start}, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"go-rest/internal/database"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type permission string
+
+const (
+	// permManageEvents allows creating events and managing the ones a user
+	// is allowed to modify according to canModifyEvent.
+	permManageEvents permission = "events:manage"
+	// permModerateEvents allows modifying any event regardless of owner.
+	permModerateEvents permission = "events:moderate"
+	// permManageUsers allows changing other users' roles.
+	permManageUsers permission = "users:manage"
+	// permAttendEvents allows RSVPing to events as oneself.
+	permAttendEvents permission = "events:attend"
+)
+
+var rolePermissions = map[string][]permission{
+	database.RoleAdmin:     {permAttendEvents, permManageEvents, permModerateEvents, permManageUsers},
+	database.RoleOrganizer: {permAttendEvents, permManageEvents},
+	database.RoleMember:    {permAttendEvents},
+}
+
+func hasPermission(user *database.User, perm permission) bool {
+	if user == nil {
+		return false
+	}
+	for _, p := range rolePermissions[user.Role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// canModifyEvent is the policy for changing an event or its attendees:
+// moderators may touch any event, everybody else only the events they own.
+func canModifyEvent(user *database.User, event *database.Event) bool {
+	if hasPermission(user, permModerateEvents) {
+		return true
+	}
+	return hasPermission(user, permManageEvents) && event.OwnerId == user.ID
+}
+
+// RequirePermission aborts the request with 403 unless the authenticated
+// user's role grants perm. It must run after AuthMiddleware.
+func (app *Application) RequirePermission(perm permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := app.GetUserFromContext(c)
+		if !hasPermission(user, perm) {
+			errorResponse(c, http.StatusForbidden, "You do not have permission to perform this action")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
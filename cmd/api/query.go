@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go-rest/internal/database"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventPage, occurrencePage and attendeePage only exist to document the paginated responses in
+// Swagger, which cannot describe generic types.
+type eventPage struct {
+	Data       []database.Event `json:"data"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+	Total      int              `json:"total"`
+}
+
+type occurrencePage struct {
+	Data       []database.Occurrence `json:"data"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+	Total      int                   `json:"total"`
+}
+
+type attendeePage struct {
+	Data       []database.EventAttendee `json:"data"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+	Total      int                      `json:"total"`
+}
+
+// readPageRequest reads the limit, cursor and sort query parameters. A sort
+// field prefixed with "-" sorts in descending order, e.g. ?sort=-date.
+func readPageRequest(c *gin.Context) (database.PageRequest, error) {
+	page := database.PageRequest{Cursor: c.Query("cursor")}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > database.MaxPageLimit {
+			return page, fmt.Errorf("limit must be between 1 and %d", database.MaxPageLimit)
+		}
+		page.Limit = n
+	}
+	sort := c.Query("sort")
+	if strings.HasPrefix(sort, "-") {
+		page.Desc = true
+		sort = sort[1:]
+	}
+	page.Sort = sort
+	return page, nil
+}
+
+// isPageError reports whether err was caused by an invalid sort or cursor.
+func isPageError(err error) bool {
+	return errors.Is(err, database.ErrInvalidCursor) || errors.Is(err, database.ErrInvalidSort)
+}
+
+// readEventFilter reads the from, to, location and owner_id query parameters.
+func readEventFilter(c *gin.Context) (database.EventFilter, error) {
+	filter := database.EventFilter{
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+		Location: c.Query("location"),
+	}
+	for name, value := range map[string]string{"from": filter.From, "to": filter.To} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return filter, fmt.Errorf("%s must be a date in YYYY-MM-DD format", name)
+		}
+	}
+	if owner := c.Query("owner_id"); owner != "" {
+		id, err := strconv.Atoi(owner)
+		if err != nil {
+			return filter, fmt.Errorf("owner_id must be an integer")
+		}
+		filter.OwnerID = id
+	}
+	return filter, nil
+}
+
+// readTimezone reads the tz query parameter, the IANA timezone to render
+// event times in. It returns nil when absent, meaning each event's own
+// timezone.
+func readTimezone(c *gin.Context) (*time.Location, error) {
+	tz := c.Query("tz")
+	if tz == "" {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil || tz == "Local" {
+		return nil, fmt.Errorf("tz must be an IANA timezone such as Europe/Berlin")
+	}
+	return loc, nil
+}
+
+// renderEvent returns the event with its times in loc, or in the event's
+// own timezone if loc is nil.
+func renderEvent(event *database.Event, loc *time.Location) *database.Event {
+	if loc == nil {
+		loc = event.Zone()
+	}
+	return event.In(loc)
+}
+
+func renderEvents(events []*database.Event, loc *time.Location) {
+	for i, e := range events {
+		events[i] = renderEvent(e, loc)
+	}
+}
+
+func renderOccurrences(occurrences []*database.Occurrence, loc *time.Location) {
+	for _, o := range occurrences {
+		o.Event = *renderEvent(&o.Event, loc)
+	}
+}
+
+func renderOverride(o *database.OccurrenceOverride, loc *time.Location) *database.OccurrenceOverride {
+	c := *o
+	if o.StartsAt != nil {
+		t := o.StartsAt.In(loc)
+		c.StartsAt = &t
+	}
+	if o.EndsAt != nil {
+		t := o.EndsAt.In(loc)
+		c.EndsAt = &t
+	}
+	return &c
+}
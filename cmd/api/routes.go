@@ -1,15 +1,27 @@
 package main
 
 import (
+	"log/slog"
 	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerFiles "github.com/swaggo/files"     // correct alias
 	ginSwagger "github.com/swaggo/gin-swagger" // correct alias
 )
 
 func (app *Application) routes() http.Handler {
-	g := gin.Default()
+	useJSONFieldNames()
+	g := gin.New()
+	g.Use(app.Tracing(), app.RequestID(), app.AccessLog(), app.Metrics(), app.Recovery())
+	if len(app.trustedProxies) > 0 {
+		// The addresses have been validated by config.Load.
+		if err := g.SetTrustedProxies(app.trustedProxies); err != nil {
+			slog.Error("Invalid trusted proxies", "error", err)
+			os.Exit(1)
+		}
+	}
 
 	// Serve Swagger UI at /swagger/index.html
 	g.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -19,28 +31,64 @@ func (app *Application) routes() http.Handler {
 		c.Redirect(http.StatusMovedPermanently, "/swagger/index.html")
 	})
 
+	g.GET("/.well-known/jwks.json", app.getJWKS)
+	g.GET("/healthz", app.getHealth)
+	g.GET("/readyz", app.getReadiness)
+	g.GET("/version", app.getVersion)
+	g.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
 	v1 := g.Group("/api/v1")
 	{
 		// Event Routes
 		v1.GET("/events", app.getAllEvents)
+		v1.GET("/events/search", app.searchEvents)
 		v1.GET("/events/:id", app.getEvent)
 		v1.GET("/events/:id/attendees", app.getAttendeesForEvent)
 		v1.GET("/attendees/:id/events", app.getEventsByAttendee)
 		// User Routes
 		v1.POST("/auth/register", app.registerUser)
 		v1.POST("/auth/login", app.login)
+		v1.POST("/auth/refresh", app.refresh)
+		// Calendar feeds are authenticated by the token in their URL
+		v1.GET("/calendar/:token", app.getCalendarFeed)
 
 	}
 
 	authGroup := v1.Group("/")
 	authGroup.Use(app.AuthMiddleware())
 	{
-		authGroup.POST("/events", app.createEvent)
-		authGroup.PUT("/events/:id", app.updateEvent)
-		authGroup.DELETE("/events/:id", app.deleteEvent)
-		authGroup.POST("/events/:event_id/attendees/:user_id", app.addAttendeeToEvent)
-		authGroup.DELETE("/events/:id/attendees/:user_id", app.deleteAttendeeFromEvent)
+		authGroup.POST("/auth/logout", app.logout)
+		authGroup.POST("/auth/logout-all", app.logoutAll)
+		authGroup.POST("/calendar/token", app.createCalendarToken)
+		authGroup.DELETE("/calendar/token", app.deleteCalendarToken)
+	}
+
+	// RSVP Routes
+	attendGroup := authGroup.Group("/")
+	attendGroup.Use(app.RequirePermission(permAttendEvents))
+	{
+		attendGroup.POST("/events/:id/rsvp", app.rsvpToEvent)
+		attendGroup.DELETE("/events/:id/rsvp", app.cancelRSVP)
+	}
 
+	// Event Management Routes, ownership is checked per event in the handlers
+	eventsGroup := authGroup.Group("/")
+	eventsGroup.Use(app.RequirePermission(permManageEvents))
+	{
+		eventsGroup.POST("/events", app.createEvent)
+		eventsGroup.PUT("/events/:id", app.updateEvent)
+		eventsGroup.DELETE("/events/:id", app.deleteEvent)
+		eventsGroup.POST("/events/:id/attendees/:user_id", app.addAttendeeToEvent)
+		eventsGroup.DELETE("/events/:id/attendees/:user_id", app.deleteAttendeeFromEvent)
+		eventsGroup.PUT("/events/:id/occurrences/:date", app.overrideOccurrence)
+		eventsGroup.DELETE("/events/:id/occurrences/:date", app.cancelOccurrence)
+	}
+
+	// Admin Routes
+	adminGroup := authGroup.Group("/")
+	adminGroup.Use(app.RequirePermission(permManageUsers))
+	{
+		adminGroup.PUT("/users/:id/role", app.updateUserRole)
 	}
 	return g
 }
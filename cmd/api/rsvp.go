@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"go-rest/internal/database"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type rsvpRequest struct {
+	RSVP string `json:"rsvp" binding:"omitempty,oneof=going maybe declined"`
+}
+
+// @Summary RSVP to event
+// @Description Answer going, maybe or declined for the authenticated user. Going takes a seat, or a place on the waitlist when the event is full; the body may be omitted to RSVP going.
+// @Tags Attendees
+// @Accept json
+// @Produce json
+// @Param id path int true "Event ID"
+// @Param rsvpRequest body rsvpRequest false "RSVP answer"
+// @Success 200 {object} database.Attendee
+// @Failure 400,401,403,404,409,500 {object} problem
+// @Router /events/{id}/rsvp [post]
+// @Security BearerAuth
+func (app *Application) rsvpToEvent(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "Invalid event ID")
+		return
+	}
+	var req rsvpRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindError(c, err)
+			return
+		}
+	}
+	if req.RSVP == "" {
+		req.RSVP = database.RSVPGoing
+	}
+
+	user := app.GetUserFromContext(c)
+	var before, attendee *database.Attendee
+	err = app.models.WithTx(c.Request.Context(), func(tx database.Models) error {
+		event, err := tx.Events.Get(c.Request.Context(), id)
+		if errors.Is(err, database.ErrNotFound) {
+			return notFound("Event not found")
+		}
+		if err != nil {
+			return err
+		}
+		before, err = tx.Attendees.GetByEventAndAttendee(c.Request.Context(), event.ID, user.ID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+		attendee, err = tx.Attendees.SetRSVP(c.Request.Context(), event.ID, user.ID, req.RSVP)
+		if errors.Is(err, database.ErrDuplicate) {
+			// A concurrent RSVP of the same user added them first.
+			return conflict("The RSVP conflicted with a concurrent one, please retry")
+		}
+		return err
+	})
+	if err != nil {
+		handleError(c, err, "Failed to save RSVP")
+		return
+	}
+	countRegistration(before, attendee)
+	c.JSON(http.StatusOK, attendee)
+}
+
+// @Summary Cancel RSVP
+// @Description Remove the authenticated user from an event. If a seat frees up, the oldest waitlisted attendee is promoted.
+// @Tags Attendees
+// @Param id path int true "Event ID"
+// @Success 204
+// @Failure 400,401,403,404,500 {object} problem
+// @Router /events/{id}/rsvp [delete]
+// @Security BearerAuth
+func (app *Application) cancelRSVP(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "Invalid event ID")
+		return
+	}
+	user := app.GetUserFromContext(c)
+	var before *database.Attendee
+	err = app.models.WithTx(c.Request.Context(), func(tx database.Models) error {
+		event, err := tx.Events.Get(c.Request.Context(), id)
+		if errors.Is(err, database.ErrNotFound) {
+			return notFound("Event not found")
+		}
+		if err != nil {
+			return err
+		}
+		before, err = tx.Attendees.GetByEventAndAttendee(c.Request.Context(), event.ID, user.ID)
+		if errors.Is(err, database.ErrNotFound) {
+			return notFound("You have not RSVPed to this event")
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Attendees.Delete(c.Request.Context(), event.ID, user.ID)
+	})
+	if err != nil {
+		handleError(c, err, "Failed to cancel RSVP")
+		return
+	}
+	countRegistration(before, nil)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"go-rest/internal/database"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRSVP(t *testing.T) {
+	app := newTestApp(t)
+	_, owner := app.signUp(t, "alice", "")
+	_, bob := app.signUp(t, "bob", database.RoleMember)
+	_, carol := app.signUp(t, "carol", database.RoleMember)
+	event := app.createEvent(t, owner.Token, map[string]any{"capacity": 1})
+	path := fmt.Sprintf("/api/v1/events/%d/rsvp", event.ID)
+
+	// Without a body the answer is going.
+	var attendee database.Attendee
+	expect(t, app.do(t, http.MethodPost, path, nil, bob.Token), http.StatusOK, &attendee)
+	if attendee.RSVP != database.RSVPGoing || attendee.Status != database.AttendeeRegistered {
+		t.Errorf("RSVP = %+v, want going and registered", attendee)
+	}
+	attendee = database.Attendee{}
+	expect(t, app.do(t, http.MethodPost, path, rsvpRequest{database.RSVPGoing}, carol.Token), http.StatusOK, &attendee)
+	if attendee.Status != database.AttendeeWaitlisted || position(attendee.WaitlistPosition) != 1 {
+		t.Errorf("RSVP beyond the capacity = %+v, want first on the waitlist", attendee)
+	}
+
+	// Changing the answer to maybe gives up the seat.
+	attendee = database.Attendee{}
+	expect(t, app.do(t, http.MethodPost, path, rsvpRequest{database.RSVPMaybe}, bob.Token), http.StatusOK, &attendee)
+	if attendee.RSVP != database.RSVPMaybe || attendee.Status != "" {
+		t.Errorf("RSVP after answering maybe = %+v", attendee)
+	}
+	attendee = database.Attendee{}
+	expect(t, app.do(t, http.MethodPost, path, rsvpRequest{database.RSVPGoing}, carol.Token), http.StatusOK, &attendee)
+	if attendee.Status != database.AttendeeRegistered {
+		t.Errorf("waitlisted attendee after a seat was freed = %+v, want registered", attendee)
+	}
+
+	p := expectProblem(t, app.do(t, http.MethodPost, path, rsvpRequest{"perhaps"}, bob.Token), http.StatusBadRequest, "/problems/validation-failed")
+	if len(p.Errors) != 1 || p.Errors[0].Field != "rsvp" || p.Errors[0].Rule != "oneof" {
+		t.Errorf("errors of an unknown answer = %+v", p.Errors)
+	}
+	expectProblem(t, app.do(t, http.MethodPost, "/api/v1/events/9999/rsvp", nil, bob.Token), http.StatusNotFound, "/problems/not-found")
+	expectProblem(t, app.do(t, http.MethodPost, path, nil, ""), http.StatusUnauthorized, "/problems/unauthorized")
+
+	expect(t, app.do(t, http.MethodDelete, path, nil, bob.Token), http.StatusNoContent, nil)
+	expectProblem(t, app.do(t, http.MethodDelete, path, nil, bob.Token), http.StatusNotFound, "/problems/not-found")
+}
+
+func TestRegistrationMetrics(t *testing.T) {
+	app := newTestApp(t)
+	_, owner := app.signUp(t, "alice", "")
+	bobUser, bob := app.signUp(t, "bob", database.RoleMember)
+	carolUser, carol := app.signUp(t, "carol", database.RoleMember)
+	event := app.createEvent(t, owner.Token, map[string]any{"capacity": 1})
+	path := fmt.Sprintf("/api/v1/events/%d/rsvp", event.ID)
+
+	counts := func() [3]float64 {
+		return [3]float64{
+			testutil.ToFloat64(eventRegistrations.WithLabelValues("going")),
+			testutil.ToFloat64(eventRegistrations.WithLabelValues("waitlisted")),
+			testutil.ToFloat64(eventRegistrations.WithLabelValues("cancelled")),
+		}
+	}
+	start := counts()
+	check := func(step string, going, waitlisted, cancelled float64) {
+		t.Helper()
+		got := counts()
+		want := [3]float64{start[0] + going, start[1] + waitlisted, start[2] + cancelled}
+		if got != want {
+			t.Errorf("%s: registrations going, waitlisted, cancelled = %v, want %v", step, got, want)
+		}
+	}
+
+	expect(t, app.do(t, http.MethodPost, path, nil, bob.Token), http.StatusOK, nil)
+	check("RSVP going", 1, 0, 0)
+	expect(t, app.do(t, http.MethodPost, path, nil, bob.Token), http.StatusOK, nil)
+	check("RSVP going again", 1, 0, 0)
+	expect(t, app.do(t, http.MethodPost, path, nil, carol.Token), http.StatusOK, nil)
+	check("RSVP going to a full event", 1, 1, 0)
+	expect(t, app.do(t, http.MethodPost, path, rsvpRequest{database.RSVPMaybe}, bob.Token), http.StatusOK, nil)
+	check("RSVP maybe", 1, 1, 1)
+	expect(t, app.do(t, http.MethodDelete, path, nil, bob.Token), http.StatusNoContent, nil)
+	check("cancelling a maybe", 1, 1, 1)
+	expect(t, app.do(t, http.MethodDelete, path, nil, carol.Token), http.StatusNoContent, nil)
+	check("cancelling a going", 1, 1, 2)
+
+	attendees := fmt.Sprintf("/api/v1/events/%d/attendees/", event.ID)
+	expect(t, app.do(t, http.MethodPost, attendees+fmt.Sprint(bobUser.ID), nil, owner.Token), http.StatusCreated, nil)
+	check("adding an attendee", 2, 1, 2)
+	expect(t, app.do(t, http.MethodPost, attendees+fmt.Sprint(carolUser.ID), nil, owner.Token), http.StatusCreated, nil)
+	check("adding an attendee to a full event", 2, 2, 2)
+	expect(t, app.do(t, http.MethodDelete, attendees+fmt.Sprint(bobUser.ID), nil, owner.Token), http.StatusOK, nil)
+	check("removing an attendee", 2, 2, 3)
+}
+
+func position(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+func TestCancelRSVP(t *testing.T) {
+	app := newTestApp(t)
+	_, owner := app.signUp(t, "alice", "")
+	_, bob := app.signUp(t, "bob", database.RoleMember)
+	carolUser, carol := app.signUp(t, "carol", database.RoleMember)
+	event := app.createEvent(t, owner.Token, map[string]any{"capacity": 1})
+	path := fmt.Sprintf("/api/v1/events/%d/rsvp", event.ID)
+	expect(t, app.do(t, http.MethodPost, path, nil, bob.Token), http.StatusOK, nil)
+	expect(t, app.do(t, http.MethodPost, path, nil, carol.Token), http.StatusOK, nil)
+
+	// Cancelling frees the seat for the waitlisted attendee.
+	expect(t, app.do(t, http.MethodDelete, path, nil, bob.Token), http.StatusNoContent, nil)
+	attendee, err := app.models.Attendees.GetByEventAndAttendee(t.Context(), event.ID, carolUser.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attendee.Status != database.AttendeeRegistered {
+		t.Errorf("waitlisted attendee after a cancellation = %+v, want registered", attendee)
+	}
+
+	expectProblem(t, app.do(t, http.MethodDelete, "/api/v1/events/9999/rsvp", nil, carol.Token), http.StatusNotFound, "/problems/not-found")
+	expect(t, app.do(t, http.MethodDelete, fmt.Sprintf("/api/v1/events/%d", event.ID), nil, owner.Token), http.StatusNoContent, nil)
+	expectProblem(t, app.do(t, http.MethodDelete, path, nil, carol.Token), http.StatusNotFound, "/problems/not-found")
+}
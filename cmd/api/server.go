@@ -1,24 +1,75 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 // server starts a new HTTP server listening on the port specified in the
-// application configuration.
+// application configuration, together with the background workers. It
+// returns once SIGINT or SIGTERM has shut both down: readiness fails first,
+// then after the shutdown delay the server stops accepting connections and
+// the requests in flight and the workers get the shutdown timeout to
+// finish.
 func (app *Application) serve() error {
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", app.port),
 		Handler:      app.routes(),
+		ErrorLog:     slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
 
-	log.Printf("Starting server on port %d", app.port)
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	return server.ListenAndServe()
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("Starting server", "port", app.port)
+
+	app.lifecycle.start()
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+	app.lifecycle.ready.Store(true)
+
+	select {
+	case err = <-serveErr:
+	case <-signals.Done():
+		// A second signal kills the process right away.
+		stop()
+		slog.Info("Shutting down")
+	}
+	app.lifecycle.ready.Store(false)
+
+	if err == nil && app.shutdownDelay > 0 {
+		time.Sleep(app.shutdownDelay)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), app.shutdownTimeout)
+	defer cancel()
+	if err == nil {
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Warn("Requests still in flight were cut off", "timeout", app.shutdownTimeout.String())
+			server.Close()
+		}
+	}
+	app.lifecycle.stop(ctx)
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	slog.Info("Server stopped")
+	return nil
 }
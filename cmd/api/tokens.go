@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-rest/internal/database"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// accessClaims are the claims of an access token: the registered ones,
+// with the user ID as the subject, and the user's role and session.
+type accessClaims struct {
+	jwt.StandardClaims
+	Role      string `json:"role"`
+	SessionID int    `json:"sid"`
+}
+
+// generateAccessToken signs a short-lived JWT for the user bound to the given
+// session. AuthMiddleware rejects the token as soon as the session is revoked
+// or the user's role no longer matches the one in the claims.
+func (app *Application) generateAccessToken(user *database.User, sessionID int) (string, error) {
+	id, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	key := app.jwtKeys[0]
+	token := jwt.NewWithClaims(key.method, accessClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    app.issuer,
+			Audience:  app.audience,
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(app.accessTokenTTL).Unix(),
+			Id:        id,
+		},
+		Role:      user.Role,
+		SessionID: sessionID,
+	})
+	if key.id != "" {
+		token.Header["kid"] = key.id
+	}
+	return token.SignedString(key.private)
+}
+
+// verificationKey returns the key a token names in its kid header, or the
+// unnamed key for tokens without one. The token must use the key's
+// algorithm, so that for example a public RSA key cannot be passed off as
+// an HMAC secret.
+func (app *Application) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	for _, key := range app.jwtKeys {
+		if key.id == kid {
+			if token.Method.Alg() != key.method.Alg() {
+				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+			}
+			return key.public, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown signing key %q", kid)
+}
+
+// parseAccessToken verifies an access token and returns its claims.
+func (app *Application) parseAccessToken(tokenString string) (*accessClaims, error) {
+	var claims accessClaims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, app.verificationKey)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if !claims.VerifyIssuer(app.issuer, true) || !claims.VerifyAudience(app.audience, true) {
+		return nil, errors.New("token issued by or for someone else")
+	}
+	return &claims, nil
+}
+
+// generateRefreshToken creates a new random refresh token for the session and
+// stores its hash with tokens. The plain token is only ever returned to the
+// client.
+func (app *Application) generateRefreshToken(ctx context.Context, tokens database.RefreshTokenRepository, session *database.Session) (string, error) {
+	plain, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	refreshToken := database.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: hashToken(plain),
+		ExpiresAt: session.ExpiresAt,
+	}
+	if err := tokens.Insert(ctx, &refreshToken); err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+// issueTokens returns a fresh access/refresh token pair for the session,
+// storing the refresh token through models.
+func (app *Application) issueTokens(ctx context.Context, models database.Models, user *database.User, session *database.Session) (*loginResponse, error) {
+	accessToken, err := app.generateAccessToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := app.generateRefreshToken(ctx, models.RefreshTokens, session)
+	if err != nil {
+		return nil, err
+	}
+	return &loginResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(app.accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// randomToken returns 32 random bytes encoded for use in URLs.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"go-rest/internal/database"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+var tokenUser = &database.User{ID: 7, Role: database.RoleOrganizer}
+
+// signToken signs claims for tokenUser with key, naming it in the kid
+// header when it has an ID.
+func signToken(t *testing.T, key signingKey, claims jwt.StandardClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(key.method, accessClaims{StandardClaims: claims, Role: tokenUser.Role, SessionID: 1})
+	if key.id != "" {
+		token.Header["kid"] = key.id
+	}
+	s, err := token.SignedString(key.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// validClaims returns claims that newTestApp accepts, changed by the
+// given functions.
+func validClaims(changes ...func(*jwt.StandardClaims)) jwt.StandardClaims {
+	now := time.Now()
+	c := jwt.StandardClaims{
+		Issuer:    "go-rest",
+		Audience:  "go-rest",
+		Subject:   "7",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	}
+	for _, change := range changes {
+		change(&c)
+	}
+	return c
+}
+
+func TestParseAccessToken(t *testing.T) {
+	app := newTestApp(t)
+	token, err := app.generateAccessToken(tokenUser, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := app.parseAccessToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "7" || claims.Role != tokenUser.Role || claims.SessionID != 3 || claims.Id == "" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	key := app.jwtKeys[0]
+	otherSecret := []byte("another-secret")
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"wrong issuer", signToken(t, key, validClaims(func(c *jwt.StandardClaims) { c.Issuer = "someone-else" })), "someone else"},
+		{"wrong audience", signToken(t, key, validClaims(func(c *jwt.StandardClaims) { c.Audience = "another-api" })), "someone else"},
+		{"expired", signToken(t, key, validClaims(func(c *jwt.StandardClaims) { c.ExpiresAt = time.Now().Add(-time.Minute).Unix() })), "expired"},
+		{"wrong secret", signToken(t, signingKey{method: jwt.SigningMethodHS256, private: otherSecret}, validClaims()), "signature is invalid"},
+		{"unknown kid", signToken(t, signingKey{id: "unknown", method: jwt.SigningMethodHS256, private: testSecret}, validClaims()), "Unknown signing key"},
+		{"other algorithm", signToken(t, signingKey{method: jwt.SigningMethodHS512, private: testSecret}, validClaims()), "Unexpected signing method"},
+	}
+	for _, tt := range tests {
+		if _, err := app.parseAccessToken(tt.token); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestKeyConfusion checks that a token cannot name an asymmetric key and
+// be verified as if its public key were an HMAC secret.
+func TestKeyConfusion(t *testing.T) {
+	rsaPrivate := rsaKey(t, 2048)
+	app := newTestApp(t)
+	app.jwtKeys = []signingKey{{id: "rsa", method: jwt.SigningMethodRS256, private: rsaPrivate, public: &rsaPrivate.PublicKey}}
+
+	forged := signToken(t, signingKey{id: "rsa", method: jwt.SigningMethodHS256, private: marshalPKIX(t, &rsaPrivate.PublicKey)}, validClaims())
+	if _, err := app.parseAccessToken(forged); err == nil || !strings.Contains(err.Error(), "Unexpected signing method") {
+		t.Errorf("HS256 token naming an RSA key: error = %v, want an unexpected signing method", err)
+	}
+	if _, err := app.parseAccessToken(signToken(t, app.jwtKeys[0], validClaims())); err != nil {
+		t.Errorf("RS256 token: %v", err)
+	}
+}
+
+// TestKeyRotation follows a key rotation: tokens signed with the old key
+// stay valid while it is configured behind the new one, and stop being
+// accepted once it is removed.
+func TestKeyRotation(t *testing.T) {
+	oldKey := signingKey{id: "2029", method: jwt.SigningMethodHS256, private: testSecret, public: testSecret}
+	edPrivate := edKey(t)
+	newKey := signingKey{id: "2030", method: jwt.SigningMethodEdDSA, private: edPrivate, public: edPrivate.Public()}
+
+	app := newTestApp(t)
+	app.jwtKeys = []signingKey{oldKey}
+	oldToken, err := app.generateAccessToken(tokenUser, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.jwtKeys = []signingKey{newKey, oldKey}
+	newToken, err := app.generateAccessToken(tokenUser, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := new(jwt.Parser).ParseUnverified(newToken, &accessClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header["kid"] != "2030" || parsed.Method.Alg() != "EdDSA" {
+		t.Errorf("new token header = %v, want kid 2030 and EdDSA", parsed.Header)
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := app.parseAccessToken(token); err != nil {
+			t.Errorf("%s token during the rotation: %v", name, err)
+		}
+	}
+
+	app.jwtKeys = []signingKey{newKey}
+	if _, err := app.parseAccessToken(oldToken); err == nil {
+		t.Errorf("old token after its key was removed was accepted")
+	}
+	if _, err := app.parseAccessToken(newToken); err != nil {
+		t.Errorf("new token after the rotation: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"go-rest/internal/database"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type updateRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin organizer member"`
+}
+
+// @Summary Update user role
+// @Description Change the role of a user (admin only)
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param updateRoleRequest body updateRoleRequest true "New role"
+// @Success 200 {object} database.User
+// @Failure 400,403,404,500 {object} problem
+// @Router /users/{id}/role [put]
+// @Security BearerAuth
+func (app *Application) updateUserRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req updateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		bindError(c, err)
+		return
+	}
+	var user *database.User
+	err = app.models.WithTx(c.Request.Context(), func(tx database.Models) error {
+		found, err := tx.Users.GetUser(c.Request.Context(), id)
+		if errors.Is(err, database.ErrNotFound) {
+			return notFound("User not found")
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Users.UpdateRole(c.Request.Context(), found.ID, req.Role); err != nil {
+			return err
+		}
+		found.Role = req.Role
+		user = found
+		return nil
+	})
+	if err != nil {
+		handleError(c, err, "Failed to update role")
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-rest/internal/database"
+	"net/http"
+	"testing"
+)
+
+func TestUpdateUserRole(t *testing.T) {
+	app := newTestApp(t)
+	_, admin := app.signUp(t, "alice", database.RoleAdmin)
+	bob, member := app.signUp(t, "bob", "")
+	path := fmt.Sprintf("/api/v1/users/%d/role", bob.ID)
+
+	rec := app.do(t, http.MethodPut, path, updateRoleRequest{database.RoleMember}, admin.Token)
+	var fields map[string]any
+	expect(t, rec, http.StatusOK, &fields)
+	if fields["role"] != database.RoleMember {
+		t.Errorf("role = %v, want %s", fields["role"], database.RoleMember)
+	}
+	if _, ok := fields["password"]; ok {
+		t.Errorf("response carries the password hash: %s", rec.Body)
+	}
+
+	expectProblem(t, app.do(t, http.MethodPut, "/api/v1/users/9999/role", updateRoleRequest{database.RoleMember}, admin.Token), http.StatusNotFound, "/problems/not-found")
+	expectProblem(t, app.do(t, http.MethodPut, path, updateRoleRequest{"owner"}, admin.Token), http.StatusBadRequest, "/problems/validation-failed")
+	// bob's token was minted for his old role.
+	expectProblem(t, app.do(t, http.MethodPut, path, updateRoleRequest{database.RoleAdmin}, member.Token), http.StatusUnauthorized, "/problems/unauthorized")
+}
+
+func TestRegisterHidesPassword(t *testing.T) {
+	app := newTestApp(t)
+	rec := app.do(t, http.MethodPost, "/api/v1/auth/register", registerRequest{Email: "alice@example.com", Password: "password123", UserName: "alice"}, "")
+	var fields map[string]json.RawMessage
+	expect(t, rec, http.StatusCreated, &fields)
+	if _, ok := fields["password"]; ok {
+		t.Errorf("response carries the password hash: %s", rec.Body)
+	}
+}
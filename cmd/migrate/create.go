@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+var nonWord = regexp.MustCompile(`[^a-z0-9]+`)
+
+// create adds the next numbered pair of empty up and down migrations to dir
+// and the same pair to its postgres subdirectory, since every schema change
+// needs both, and writes their paths to w. The migrations are embedded, so
+// the binary has to be rebuilt before it can apply them.
+func create(w io.Writer, dir, name string, dryRun bool) error {
+	name = strings.Trim(nonWord.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return fmt.Errorf("the name must contain letters or digits")
+	}
+	dirs := []struct{ path, engine string }{
+		{dir, "SQLite"},
+		{filepath.Join(dir, "postgres"), "PostgreSQL"},
+	}
+
+	var last uint
+	for _, d := range dirs {
+		entries, err := os.ReadDir(d.path)
+		if err != nil {
+			return fmt.Errorf("%w; run from the repository root or pass --dir", err)
+		}
+		for _, e := range entries {
+			if m, err := source.Parse(e.Name()); err == nil {
+				last = max(last, m.Version)
+			}
+		}
+	}
+
+	base := fmt.Sprintf("%06d_%s", last+1, name)
+	for _, d := range dirs {
+		for _, direction := range []string{"up", "down"} {
+			path := filepath.Join(d.path, base+"."+direction+".sql")
+			if dryRun {
+				fmt.Fprintf(w, "-- would create %s\n", path)
+				continue
+			}
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(f, "-- %s %s (%s)\n", base, direction, d.engine)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(w, path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// migrationDir returns a migrations directory holding the given files, whose
+// names may start with postgres/.
+func migrationDir(t *testing.T, files ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "postgres"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCreate(t *testing.T) {
+	// The postgres directory is ahead, so it decides the next number.
+	dir := migrationDir(t,
+		"000001_a.up.sql", "000001_a.down.sql", "README.md",
+		"postgres/000001_a.up.sql", "postgres/000003_b.up.sql")
+
+	var out strings.Builder
+	if err := create(&out, dir, "Add index on Events!", false); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "000004_add_index_on_events.up.sql"),
+		filepath.Join(dir, "000004_add_index_on_events.down.sql"),
+		filepath.Join(dir, "postgres", "000004_add_index_on_events.up.sql"),
+		filepath.Join(dir, "postgres", "000004_add_index_on_events.down.sql"),
+	}
+	if got := strings.Fields(out.String()); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("created %q, want %q", got, want)
+	}
+	b, err := os.ReadFile(want[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "-- 000004_add_index_on_events up (PostgreSQL)\n" {
+		t.Errorf("content = %q", b)
+	}
+
+	out.Reset()
+	if err := create(&out, dir, "next", true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "-- would create "+filepath.Join(dir, "000005_next.up.sql")+"\n") {
+		t.Errorf("dry run = %q", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "000005_next.up.sql")); !os.IsNotExist(err) {
+		t.Errorf("dry run created a file: %v", err)
+	}
+}
+
+func TestCreateErrors(t *testing.T) {
+	var out strings.Builder
+	if err := create(&out, migrationDir(t), "!!!", false); err == nil {
+		t.Errorf("create with a name without letters succeeded")
+	}
+	if err := create(&out, t.TempDir(), "name", false); err == nil || !strings.Contains(err.Error(), "--dir") {
+		t.Errorf("create without a postgres directory: error = %v", err)
+	}
+}
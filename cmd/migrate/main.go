@@ -1,88 +1,181 @@
 package main
 
 import (
-	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"go-rest/cmd/migrate/migrations"
+	"go-rest/internal/config"
+	"go-rest/internal/database"
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/sqlite3"
-	"github.com/golang-migrate/migrate/v4/source/file"
-	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/joho/godotenv/autoload" // Automatically load .env file
 )
 
-func main() {
-	if len(os.Args) < 2 {
-		log.Fatal("Please provide a migration direction: `up` or `down`")
-	}
+const usage = `Usage: migrate [flags] <command> [arguments]
 
-	direction := os.Args[1]
+Commands:
+  up            apply every pending migration
+  down          revert every applied migration
+  goto N        migrate up or down to version N
+  steps N       apply the next N migrations, or revert the last -N
+  force N       record version N as applied and clean, without running
+                anything; use after fixing a failed migration by hand
+  version       print the current version
+  status        list the migrations and which of them are applied
+  create NAME   add empty up and down migrations for SQLite and PostgreSQL
 
-	// Connect to SQLite database
-	db, err := sql.Open("sqlite3", "./data.db")
-	if err != nil {
-		log.Fatalf("Failed to connect to the database: %v", err)
+The database of the API's configuration, database.url in $CONFIG_FILE or
+DATABASE_URL in the environment or .env, is the default of --database.
+
+Flags:
+`
+
+// logger prints the migrations golang-migrate runs.
+type logger struct{}
+
+func (logger) Printf(format string, v ...any) { log.Printf(format, v...) }
+func (logger) Verbose() bool                  { return false }
+
+func main() {
+	// The API's configuration, from $CONFIG_FILE and the environment,
+	// names the database to migrate by default. Only its database
+	// settings matter here, so the JWT keys need not be configured.
+	cfg, err := config.Load(flag.NewFlagSet("config", flag.ContinueOnError), nil)
+	if err == nil {
+		err = cfg.Database.Validate()
 	}
-	_, err = db.Exec("PRAGMA foreign_keys = ON;")
 	if err != nil {
-		log.Fatalf("Failed to enable foreign keys: %v", err)
+		log.Fatalf("Invalid configuration: %v", err)
 	}
+	databaseURL := flag.String("database", cfg.Database.URL, "database to migrate, a SQLite path or a postgres:// URL")
+	dryRun := flag.Bool("dry-run", false, "print the SQL that would run instead of running it")
+	dir := flag.String("dir", "cmd/migrate/migrations", "source directory that create adds migrations to")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	command, args := flag.Arg(0), flag.Args()[1:]
 
-	defer db.Close()
-
-	// Set up migrate with sqlite3
-	driver, err := sqlite3.WithInstance(db, &sqlite3.Config{})
-	if err != nil {
-		log.Fatalf("Failed to create SQLite migration driver: %v", err)
+	if command == "create" {
+		if len(args) != 1 {
+			log.Fatal("Usage: migrate create NAME")
+		}
+		if err := create(os.Stdout, *dir, args[0], *dryRun); err != nil {
+			log.Fatalf("Failed to create migration: %v", err)
+		}
+		return
 	}
 
-	sourceDriver, err := (&file.File{}).Open("cmd/migrate/migrations")
+	// Connect to the database named by --database, SQLite by default
+	db, dialect, err := database.Open(*databaseURL)
 	if err != nil {
-		log.Fatalf("Failed to open migration source: %v", err)
+		log.Fatalf("Failed to connect to the database: %v", err)
 	}
+	defer db.Close()
 
-	m, err := migrate.NewWithInstance(
-		"file",
-		sourceDriver,
-		"sqlite3",
-		driver,
-	)
+	// Set up migrate with the migrations of the database's dialect
+	m, err := migrations.New(db, dialect)
 	if err != nil {
 		log.Fatalf("Failed to create migration instance: %v", err)
 	}
+	m.Log = logger{}
 
-	switch direction {
-	case "up":
-		err := m.Up()
-		if err != nil {
-			if err.Error() == "dirty database" || err.Error() == "Dirty database version 3. Fix and force version." {
-				version, dirty, verr := m.Version()
-				if verr != nil {
-					log.Fatalf("Failed to get current migration version: %v", verr)
-				}
-				if dirty {
-					log.Printf("Dirty database detected at version %d. Forcing clean state...", version)
-					if forceErr := m.Force(int(version)); forceErr != nil {
-						log.Fatalf("Failed to force migration version: %v", forceErr)
-					}
-					log.Println("Forced migration version. Retrying migration...")
-					err = m.Up()
-					if err != nil && err != migrate.ErrNoChange {
-						log.Fatalf("Migration failed again after forcing: %v", err)
-					}
-				}
-			} else if err != migrate.ErrNoChange {
-				log.Fatalf("Failed to apply migrations up: %v", err)
-			}
+	switch command {
+	case "version":
+		version, dirty, err := m.Version()
+		switch {
+		case errors.Is(err, migrate.ErrNilVersion):
+			fmt.Println("No migrations applied")
+		case err != nil:
+			log.Fatalf("Failed to read the version: %v", err)
+		case dirty:
+			fmt.Printf("%d (dirty)\n", version)
+		default:
+			fmt.Println(version)
 		}
-		log.Println("Migrations applied successfully (up)")
+		return
+	case "status":
+		if err := status(os.Stdout, m, dialect); err != nil {
+			log.Fatalf("Failed to read the status: %v", err)
+		}
+		return
+	}
+
+	var target plan
+	switch command {
+	case "up":
+		target = planUp()
 	case "down":
-		err := m.Down()
-		if err != nil && err != migrate.ErrNoChange {
-			log.Fatalf("Failed to apply migrations down: %v", err)
+		target = planDown()
+	case "goto":
+		n := intArg(command, args)
+		if n < 0 {
+			log.Fatal("Usage: migrate goto N, with N >= 0")
+		}
+		target = planGoto(uint(n))
+	case "steps":
+		n := intArg(command, args)
+		if n == 0 {
+			log.Fatal("Usage: migrate steps N, with N != 0")
+		}
+		target = planSteps(n)
+	case "force":
+		n := intArg(command, args)
+		if *dryRun {
+			fmt.Printf("-- would record version %d as applied and clean\n", n)
+			return
+		}
+		if err := m.Force(n); err != nil {
+			log.Fatalf("Failed to force version %d: %v", n, err)
+		}
+		log.Printf("Forced version %d", n)
+		return
+	default:
+		log.Fatalf("Unknown command %q; run migrate -h for help", command)
+	}
+
+	// Work out the migrations first, so that a command that cannot
+	// complete fails before it changes anything.
+	steps, err := target.resolve(m, dialect)
+	if err == nil && *dryRun {
+		if err := printSteps(os.Stdout, dialect, steps); err != nil {
+			log.Fatal(err)
 		}
-		log.Println("Migrations applied successfully (down)")
+		return
+	}
+	if err == nil {
+		err = target.run(m)
+	}
+	var dirty migrate.ErrDirty
+	switch {
+	case errors.Is(err, migrate.ErrNoChange):
+		log.Println("Nothing to migrate")
+	case errors.As(err, &dirty):
+		log.Fatalf("Migration %d failed and left the database dirty. Fix the schema by hand, then record the version it is in with `migrate force N`", dirty.Version)
+	case err != nil:
+		log.Fatalf("Migration failed: %v", err)
 	default:
-		log.Fatalf("Invalid direction: %s. Use `up` or `down`", direction)
+		log.Printf("Migrated %s", command)
+	}
+}
+
+// intArg returns the single integer argument of a command.
+func intArg(command string, args []string) int {
+	if len(args) != 1 {
+		log.Fatalf("Usage: migrate %s N", command)
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		log.Fatalf("Usage: migrate %s N: %v", command, err)
 	}
+	return n
 }
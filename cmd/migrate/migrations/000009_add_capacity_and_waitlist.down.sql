@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_attendees_event_status;
+ALTER TABLE attendees DROP COLUMN created_at;
+ALTER TABLE attendees DROP COLUMN status;
+ALTER TABLE events DROP COLUMN capacity;
@@ -0,0 +1,7 @@
+ALTER TABLE events ADD COLUMN capacity INTEGER CHECK (capacity IS NULL OR capacity > 0);
+
+ALTER TABLE attendees ADD COLUMN status TEXT NOT NULL DEFAULT 'registered' CHECK (status IN ('registered', 'waitlisted'));
+ALTER TABLE attendees ADD COLUMN created_at DATETIME;
+UPDATE attendees SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_attendees_event_status ON attendees(event_id, status, created_at, id);
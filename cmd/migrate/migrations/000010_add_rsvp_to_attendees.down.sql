@@ -0,0 +1,19 @@
+CREATE TABLE attendees_old (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    event_id INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'registered' CHECK (status IN ('registered', 'waitlisted')),
+    created_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE
+);
+
+INSERT INTO attendees_old (id, user_id, event_id, status, created_at)
+SELECT id, user_id, event_id, status, created_at FROM attendees WHERE rsvp = 'going';
+
+DROP TABLE attendees;
+ALTER TABLE attendees_old RENAME TO attendees;
+
+CREATE INDEX IF NOT EXISTS idx_attendees_event_id ON attendees(event_id);
+CREATE INDEX IF NOT EXISTS idx_attendees_user_id ON attendees(user_id);
+CREATE INDEX IF NOT EXISTS idx_attendees_event_status ON attendees(event_id, status, created_at, id);
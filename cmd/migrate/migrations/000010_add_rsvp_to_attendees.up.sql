@@ -0,0 +1,24 @@
+-- SQLite cannot change a column's constraints in place, so the table is
+-- rebuilt: status becomes NULL for attendees who are not going, since only
+-- they hold or wait for a seat.
+CREATE TABLE attendees_new (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    event_id INTEGER NOT NULL,
+    rsvp TEXT NOT NULL DEFAULT 'going' CHECK (rsvp IN ('going', 'maybe', 'declined')),
+    status TEXT CHECK (status IN ('registered', 'waitlisted')),
+    created_at DATETIME,
+    CHECK ((rsvp = 'going') = (status IS NOT NULL)),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE
+);
+
+INSERT INTO attendees_new (id, user_id, event_id, rsvp, status, created_at)
+SELECT id, user_id, event_id, 'going', status, created_at FROM attendees;
+
+DROP TABLE attendees;
+ALTER TABLE attendees_new RENAME TO attendees;
+
+CREATE INDEX IF NOT EXISTS idx_attendees_event_id ON attendees(event_id);
+CREATE INDEX IF NOT EXISTS idx_attendees_user_id ON attendees(user_id);
+CREATE INDEX IF NOT EXISTS idx_attendees_event_status ON attendees(event_id, status, created_at, id);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS calendar_tokens;
+DELETE FROM events WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_events_deleted_at;
+ALTER TABLE events DROP COLUMN deleted_at;
+ALTER TABLE events DROP COLUMN updated_at;
+ALTER TABLE events DROP COLUMN sequence;
@@ -0,0 +1,16 @@
+-- Deleted events are kept as tombstones so calendar feeds can tell
+-- subscribers they were cancelled. sequence counts the revisions of an event
+-- as required by iCalendar.
+ALTER TABLE events ADD COLUMN sequence INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE events ADD COLUMN updated_at DATETIME;
+ALTER TABLE events ADD COLUMN deleted_at DATETIME;
+UPDATE events SET updated_at = CURRENT_TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_events_deleted_at ON events(deleted_at);
+
+CREATE TABLE IF NOT EXISTS calendar_tokens (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL UNIQUE,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,12 @@
+ALTER TABLE event_occurrence_overrides ADD COLUMN date TEXT;
+UPDATE event_occurrence_overrides SET date = date(starts_at) WHERE starts_at IS NOT NULL;
+ALTER TABLE event_occurrence_overrides DROP COLUMN ends_at;
+ALTER TABLE event_occurrence_overrides DROP COLUMN starts_at;
+
+ALTER TABLE events ADD COLUMN date DATETIME NOT NULL DEFAULT '';
+UPDATE events SET date = date(starts_at);
+DROP INDEX IF EXISTS idx_events_starts_at;
+ALTER TABLE events DROP COLUMN timezone;
+ALTER TABLE events DROP COLUMN ends_at;
+ALTER TABLE events DROP COLUMN starts_at;
+CREATE INDEX IF NOT EXISTS idx_events_date ON events(date, id);
@@ -0,0 +1,21 @@
+-- Events get a start and end instant, stored in UTC as RFC 3339 text so that
+-- they sort correctly, plus the IANA timezone they take place in. Existing
+-- events only had a date and become all-day events in UTC.
+ALTER TABLE events ADD COLUMN starts_at DATETIME;
+ALTER TABLE events ADD COLUMN ends_at DATETIME;
+ALTER TABLE events ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
+UPDATE events SET
+    starts_at = strftime('%Y-%m-%dT%H:%M:%SZ', date),
+    ends_at = strftime('%Y-%m-%dT%H:%M:%SZ', date, '+1 day');
+DROP INDEX IF EXISTS idx_events_date;
+ALTER TABLE events DROP COLUMN date;
+CREATE INDEX IF NOT EXISTS idx_events_starts_at ON events(starts_at, id);
+
+-- Moved occurrences get a start and end as well.
+ALTER TABLE event_occurrence_overrides ADD COLUMN starts_at DATETIME;
+ALTER TABLE event_occurrence_overrides ADD COLUMN ends_at DATETIME;
+UPDATE event_occurrence_overrides SET
+    starts_at = strftime('%Y-%m-%dT%H:%M:%SZ', date),
+    ends_at = strftime('%Y-%m-%dT%H:%M:%SZ', date, '+1 day')
+WHERE date IS NOT NULL;
+ALTER TABLE event_occurrence_overrides DROP COLUMN date;
@@ -0,0 +1,30 @@
+-- Plain INTEGER PRIMARY KEY ids may be reused again; see the up migration
+-- for why the tables are rebuilt in this order.
+CREATE TABLE sessions_old (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO sessions_old (id, user_id, created_at, expires_at, revoked_at)
+    SELECT id, user_id, created_at, expires_at, revoked_at FROM sessions;
+
+CREATE TABLE refresh_tokens_old (
+    id INTEGER PRIMARY KEY,
+    session_id INTEGER NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    FOREIGN KEY (session_id) REFERENCES sessions_old(id) ON DELETE CASCADE
+);
+INSERT INTO refresh_tokens_old (id, session_id, token_hash, created_at, expires_at, used_at)
+    SELECT id, session_id, token_hash, created_at, expires_at, used_at FROM refresh_tokens;
+
+DROP TABLE refresh_tokens;
+DROP TABLE sessions;
+ALTER TABLE sessions_old RENAME TO sessions;
+ALTER TABLE refresh_tokens_old RENAME TO refresh_tokens;
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
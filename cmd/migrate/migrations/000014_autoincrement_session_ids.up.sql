@@ -0,0 +1,35 @@
+-- Access tokens name their session by id, so an id must never be handed out
+-- again once its session is deleted. Without AUTOINCREMENT SQLite reuses the
+-- ids of deleted rows, and a column cannot be made AUTOINCREMENT in place, so
+-- both tables are rebuilt. refresh_tokens moves first: dropping sessions while
+-- it still references them would delete its rows by cascade.
+CREATE TABLE sessions_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO sessions_new (id, user_id, created_at, expires_at, revoked_at)
+    SELECT id, user_id, created_at, expires_at, revoked_at FROM sessions;
+
+CREATE TABLE refresh_tokens_new (
+    id INTEGER PRIMARY KEY,
+    session_id INTEGER NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    FOREIGN KEY (session_id) REFERENCES sessions_new(id) ON DELETE CASCADE
+);
+INSERT INTO refresh_tokens_new (id, session_id, token_hash, created_at, expires_at, used_at)
+    SELECT id, session_id, token_hash, created_at, expires_at, used_at FROM refresh_tokens;
+
+DROP TABLE refresh_tokens;
+DROP TABLE sessions;
+-- Renaming sessions_new also points the foreign key of refresh_tokens_new
+-- at the new name.
+ALTER TABLE sessions_new RENAME TO sessions;
+ALTER TABLE refresh_tokens_new RENAME TO refresh_tokens;
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
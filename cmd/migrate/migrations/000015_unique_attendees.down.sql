@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_attendees_event_user;
@@ -0,0 +1,7 @@
+-- A user attends an event at most once. Before this index a check and an
+-- insert racing with another could add a user twice; such duplicates are
+-- removed first, keeping the earliest row.
+DELETE FROM attendees WHERE id NOT IN (
+    SELECT MIN(id) FROM attendees GROUP BY event_id, user_id
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_attendees_event_user ON attendees(event_id, user_id);
@@ -0,0 +1,148 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	migratedb "github.com/golang-migrate/migrate/v4/database"
+	gosqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// LockTimeout is how long a migration waits for one that another process
+// is running to finish.
+const LockTimeout = 5 * time.Minute
+
+const (
+	// staleLockAge is how long the SQLite lock has to go without a
+	// heartbeat before it is taken to be abandoned. Heartbeats cannot be
+	// written while a migration holds the database, so it has to be well
+	// beyond the longest migration, not just beyond LockTimeout.
+	staleLockAge = 30 * time.Minute
+	// lockHeartbeat is how often the holder of the SQLite lock refreshes it.
+	lockHeartbeat = 10 * time.Second
+)
+
+// sqliteLock makes the SQLite driver's lock, which only guards against
+// other migrations in the same process, hold across processes, so that
+// several API instances starting at once do not apply the same migration.
+//
+// The lock is a row in schema_migrations_lock, whose locked_at the holder
+// keeps refreshing. A process that dies while holding it cannot delete it,
+// so a row not refreshed for staleAfter is taken to be abandoned and taken
+// over.
+type sqliteLock struct {
+	migratedb.Driver
+	db *sql.DB
+	// timeout, staleAfter and heartbeat are LockTimeout, staleLockAge
+	// and lockHeartbeat outside tests.
+	timeout    time.Duration
+	staleAfter time.Duration
+	heartbeat  time.Duration
+
+	mu sync.Mutex
+	// lockedAt is the locked_at of the row while this lock holds it, by
+	// which it tells its row from one that took it over.
+	lockedAt int64
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+func newSQLiteLock(driver migratedb.Driver, db *sql.DB) *sqliteLock {
+	return &sqliteLock{Driver: driver, db: db, timeout: LockTimeout, staleAfter: staleLockAge, heartbeat: lockHeartbeat}
+}
+
+func (l *sqliteLock) Lock() error {
+	if err := l.Driver.Lock(); err != nil {
+		return err
+	}
+	if err := l.acquire(); err != nil {
+		l.Driver.Unlock()
+		return err
+	}
+	l.stop, l.stopped = make(chan struct{}), make(chan struct{})
+	go l.refresh()
+	return nil
+}
+
+func (l *sqliteLock) Unlock() error {
+	close(l.stop)
+	<-l.stopped
+	// Only the own row is deleted; one that has taken it over stays.
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.db.Exec(`DELETE FROM schema_migrations_lock WHERE locked_at = $1`, l.lockedAt); err != nil {
+		return err
+	}
+	return l.Driver.Unlock()
+}
+
+func (l *sqliteLock) acquire() error {
+	_, err := l.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		locked_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(l.timeout)
+	for {
+		now := time.Now()
+		res, err := l.db.Exec(`INSERT INTO schema_migrations_lock (id, locked_at) VALUES (1, $1)
+			ON CONFLICT (id) DO UPDATE SET locked_at = excluded.locked_at
+			WHERE schema_migrations_lock.locked_at < $2`,
+			now.Unix(), now.Add(-l.staleAfter).Unix())
+		// A busy database means another process is writing, most likely
+		// taking the lock itself, so it is retried like a held lock.
+		if err != nil && !isBusy(err) {
+			return err
+		}
+		if err == nil {
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 1 {
+				l.mu.Lock()
+				l.lockedAt = now.Unix()
+				l.mu.Unlock()
+				return nil
+			}
+		}
+		if now.After(deadline) {
+			return migratedb.ErrLocked
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// refresh keeps the lock from looking abandoned until Unlock. A heartbeat
+// that fails, typically because a migration keeps the database busy, is
+// simply tried again on the next tick.
+func (l *sqliteLock) refresh() {
+	defer close(l.stopped)
+	ticker := time.NewTicker(l.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		l.mu.Lock()
+		now := time.Now().Unix()
+		res, err := l.db.Exec(`UPDATE schema_migrations_lock SET locked_at = $1 WHERE locked_at = $2`, now, l.lockedAt)
+		if err == nil {
+			if n, err := res.RowsAffected(); err == nil && n == 1 {
+				l.lockedAt = now
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+func isBusy(err error) bool {
+	var sqliteErr gosqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == gosqlite3.ErrBusy || sqliteErr.Code == gosqlite3.ErrLocked)
+}
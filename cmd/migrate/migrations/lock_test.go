@@ -0,0 +1,135 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"go-rest/internal/database"
+	"path/filepath"
+	"testing"
+	"time"
+
+	migratedb "github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/stub"
+)
+
+// newTestLock returns a lock on the SQLite database at path through a
+// connection of its own, as another process would have, that waits for
+// timeout and takes over locks not refreshed for a second.
+func newTestLock(t *testing.T, path string, timeout time.Duration) (*sqliteLock, *sql.DB) {
+	t.Helper()
+	db, _, err := database.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	driver, err := stub.WithInstance(nil, &stub.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newSQLiteLock(driver, db)
+	l.timeout, l.staleAfter, l.heartbeat = timeout, time.Second, 100*time.Millisecond
+	return l, db
+}
+
+func lockedAt(t *testing.T, db *sql.DB) int64 {
+	t.Helper()
+	var at int64
+	if err := db.QueryRow(`SELECT locked_at FROM schema_migrations_lock`).Scan(&at); err != nil {
+		t.Fatal(err)
+	}
+	return at
+}
+
+func TestSQLiteLockContention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	first, _ := newTestLock(t, path, time.Second)
+	second, _ := newTestLock(t, path, 300*time.Millisecond)
+
+	if err := first.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Lock(); !errors.Is(err, migratedb.ErrLocked) {
+		t.Fatalf("Lock while another process holds it: error = %v, want ErrLocked", err)
+	}
+
+	// The waiting process gets the lock once it is released.
+	second.timeout = 5 * time.Second
+	locked := make(chan error)
+	go func() { locked <- second.Lock() }()
+	time.Sleep(200 * time.Millisecond)
+	if err := first.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-locked; err != nil {
+		t.Fatalf("Lock after the other process released it: %v", err)
+	}
+	if err := second.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSQLiteLockHeartbeat checks that a lock held for longer than
+// staleAfter is not taken over while its holder is alive.
+func TestSQLiteLockHeartbeat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	holder, db := newTestLock(t, path, time.Second)
+	waiter, _ := newTestLock(t, path, 2500*time.Millisecond)
+
+	if err := holder.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	before := lockedAt(t, db)
+	if err := waiter.Lock(); !errors.Is(err, migratedb.ErrLocked) {
+		t.Fatalf("Lock of a live holder's lock: error = %v, want ErrLocked", err)
+	}
+	if after := lockedAt(t, db); after <= before {
+		t.Errorf("locked_at = %d after waiting, want it refreshed from %d", after, before)
+	}
+	if err := holder.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteLockTakeover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	crashed, db := newTestLock(t, path, time.Second)
+	taker, _ := newTestLock(t, path, time.Second)
+
+	// A process that died while holding the lock stops refreshing it.
+	if err := crashed.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	close(crashed.stop)
+	<-crashed.stopped
+	stale := time.Now().Add(-time.Minute).Unix()
+	if _, err := db.Exec(`UPDATE schema_migrations_lock SET locked_at = $1`, stale); err != nil {
+		t.Fatal(err)
+	}
+	crashed.lockedAt = stale
+
+	start := time.Now()
+	if err := taker.Lock(); err != nil {
+		t.Fatalf("Lock of an abandoned lock: %v", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("taking over the abandoned lock took %v", d)
+	}
+
+	// Should the stalled process come back, it leaves the new holder's
+	// row alone.
+	crashed.stop, crashed.stopped = make(chan struct{}), make(chan struct{})
+	close(crashed.stopped)
+	if err := crashed.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if at := lockedAt(t, db); at != taker.lockedAt {
+		t.Errorf("locked_at = %d after the old holder unlocked, want the new holder's %d", at, taker.lockedAt)
+	}
+	if err := taker.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations_lock`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("lock rows after unlocking = %d, %v; want none", n, err)
+	}
+}
@@ -0,0 +1,106 @@
+// Package migrations embeds the SQL migrations so they can be applied
+// without the source tree at hand. The SQLite migrations live in this
+// directory and their PostgreSQL counterparts, numbered alike, in postgres/.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"go-rest/internal/database"
+	"io/fs"
+	"path"
+	"sort"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratedb "github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+//go:embed *.sql postgres/*.sql
+var files embed.FS
+
+// Dir returns the directory, relative to this package, that holds the
+// migrations of dialect.
+func Dir(dialect database.Dialect) string {
+	if dialect == database.Postgres {
+		return "postgres"
+	}
+	return "."
+}
+
+// New returns a migrator applying the migrations of dialect to db. It waits
+// up to LockTimeout for migrations run by other processes, also on SQLite.
+// Closing it closes db.
+func New(db *sql.DB, dialect database.Dialect) (*migrate.Migrate, error) {
+	var driver migratedb.Driver
+	var err error
+	switch dialect {
+	case database.Postgres:
+		driver, err = pgx.WithInstance(db, &pgx.Config{})
+	default:
+		driver, err = sqlite3.WithInstance(db, &sqlite3.Config{})
+		if err == nil {
+			driver = newSQLiteLock(driver, db)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	source, err := iofs.New(files, Dir(dialect))
+	if err != nil {
+		return nil, err
+	}
+	m, err := migrate.NewWithInstance("iofs", source, string(dialect), driver)
+	if err != nil {
+		return nil, err
+	}
+	m.LockTimeout = LockTimeout
+	return m, nil
+}
+
+// Migration is one of the embedded migrations.
+type Migration struct {
+	Version uint
+	Name    string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%06d_%s", m.Version, m.Name)
+}
+
+// List returns the embedded migrations of dialect, oldest first.
+func List(dialect database.Dialect) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, Dir(dialect))
+	if err != nil {
+		return nil, err
+	}
+	var list []Migration
+	for _, e := range entries {
+		m, err := source.Parse(e.Name())
+		if err != nil || m.Direction != source.Up {
+			continue
+		}
+		list = append(list, Migration{Version: m.Version, Name: m.Identifier})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// Read returns the SQL of a migration, either the up part that applies it
+// or the down part that reverts it.
+func Read(dialect database.Dialect, m Migration, up bool) (string, error) {
+	direction := source.Down
+	if up {
+		direction = source.Up
+	}
+	name := fmt.Sprintf("%s.%s.sql", m, direction)
+	b, err := fs.ReadFile(files, path.Join(Dir(dialect), name))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
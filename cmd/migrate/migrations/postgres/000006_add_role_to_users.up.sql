@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'organizer' CHECK (role IN ('admin', 'organizer', 'member'));
@@ -0,0 +1,9 @@
+-- The PostgreSQL counterpart of the SQLite events_fts table: a generated
+-- tsvector weighing the name above the description above the location.
+ALTER TABLE events ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', name), 'A') ||
+    setweight(to_tsvector('simple', description), 'B') ||
+    setweight(to_tsvector('simple', location), 'C')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_events_search ON events USING GIN (search);
@@ -0,0 +1,5 @@
+DELETE FROM attendees WHERE rsvp <> 'going';
+ALTER TABLE attendees DROP CONSTRAINT attendees_seat_check;
+ALTER TABLE attendees ALTER COLUMN status SET DEFAULT 'registered';
+ALTER TABLE attendees ALTER COLUMN status SET NOT NULL;
+ALTER TABLE attendees DROP COLUMN rsvp;
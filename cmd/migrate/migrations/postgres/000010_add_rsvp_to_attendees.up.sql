@@ -0,0 +1,6 @@
+-- status becomes NULL for attendees who are not going, since only they hold
+-- or wait for a seat.
+ALTER TABLE attendees ADD COLUMN rsvp TEXT NOT NULL DEFAULT 'going' CHECK (rsvp IN ('going', 'maybe', 'declined'));
+ALTER TABLE attendees ALTER COLUMN status DROP NOT NULL;
+ALTER TABLE attendees ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE attendees ADD CONSTRAINT attendees_seat_check CHECK ((rsvp = 'going') = (status IS NOT NULL));
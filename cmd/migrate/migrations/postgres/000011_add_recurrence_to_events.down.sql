@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS event_occurrence_overrides;
+ALTER TABLE events DROP COLUMN exdates;
+ALTER TABLE events DROP COLUMN rrule;
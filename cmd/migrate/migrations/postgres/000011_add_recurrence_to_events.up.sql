@@ -0,0 +1,14 @@
+ALTER TABLE events ADD COLUMN rrule TEXT;
+ALTER TABLE events ADD COLUMN exdates TEXT;
+
+CREATE TABLE IF NOT EXISTS event_occurrence_overrides (
+    event_id INTEGER NOT NULL,
+    original_date TEXT NOT NULL,
+    cancelled BOOLEAN NOT NULL DEFAULT FALSE,
+    name TEXT,
+    description TEXT,
+    date TEXT,
+    location TEXT,
+    PRIMARY KEY (event_id, original_date),
+    FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+ALTER TABLE event_occurrence_overrides ADD COLUMN date TEXT;
+UPDATE event_occurrence_overrides SET date = to_char(starts_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') WHERE starts_at IS NOT NULL;
+ALTER TABLE event_occurrence_overrides DROP COLUMN ends_at;
+ALTER TABLE event_occurrence_overrides DROP COLUMN starts_at;
+
+ALTER TABLE events ADD COLUMN date TIMESTAMPTZ;
+UPDATE events SET date = date_trunc('day', starts_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC';
+ALTER TABLE events ALTER COLUMN date SET NOT NULL;
+DROP INDEX IF EXISTS idx_events_starts_at;
+ALTER TABLE events DROP COLUMN timezone;
+ALTER TABLE events DROP COLUMN ends_at;
+ALTER TABLE events DROP COLUMN starts_at;
+CREATE INDEX IF NOT EXISTS idx_events_date ON events(date, id);
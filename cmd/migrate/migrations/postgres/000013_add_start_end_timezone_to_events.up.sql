@@ -0,0 +1,22 @@
+-- Events get a start and end instant plus the IANA timezone they take place
+-- in. Existing events only had a date and become all-day events in UTC.
+ALTER TABLE events ADD COLUMN starts_at TIMESTAMPTZ;
+ALTER TABLE events ADD COLUMN ends_at TIMESTAMPTZ;
+ALTER TABLE events ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
+UPDATE events SET
+    starts_at = date_trunc('day', date AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+    ends_at = (date_trunc('day', date AT TIME ZONE 'UTC') + INTERVAL '1 day') AT TIME ZONE 'UTC';
+ALTER TABLE events ALTER COLUMN starts_at SET NOT NULL;
+ALTER TABLE events ALTER COLUMN ends_at SET NOT NULL;
+DROP INDEX IF EXISTS idx_events_date;
+ALTER TABLE events DROP COLUMN date;
+CREATE INDEX IF NOT EXISTS idx_events_starts_at ON events(starts_at, id);
+
+-- Moved occurrences get a start and end as well.
+ALTER TABLE event_occurrence_overrides ADD COLUMN starts_at TIMESTAMPTZ;
+ALTER TABLE event_occurrence_overrides ADD COLUMN ends_at TIMESTAMPTZ;
+UPDATE event_occurrence_overrides SET
+    starts_at = CAST(date AS TIMESTAMP) AT TIME ZONE 'UTC',
+    ends_at = (CAST(date AS TIMESTAMP) + INTERVAL '1 day') AT TIME ZONE 'UTC'
+WHERE date IS NOT NULL;
+ALTER TABLE event_occurrence_overrides DROP COLUMN date;
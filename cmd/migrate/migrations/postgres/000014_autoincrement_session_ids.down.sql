@@ -0,0 +1,3 @@
+-- Identity columns never hand out a value twice, so session ids are not
+-- reused on PostgreSQL already. This migration only keeps the numbering in
+-- step with SQLite, whose sessions table it rebuilds.
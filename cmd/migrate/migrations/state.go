@@ -0,0 +1,120 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-rest/internal/database"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// State is the schema version of a database compared with the embedded
+// migrations.
+type State struct {
+	// Version is the last migration applied, -1 if there is none.
+	Version int
+	// Dirty means that migration Version failed halfway.
+	Dirty bool
+	// Latest is the newest embedded migration.
+	Latest uint
+}
+
+// ReadState returns the state of the database at dsn.
+func ReadState(dsn string) (State, error) {
+	var state State
+	err := withMigrate(dsn, func(m *migrate.Migrate, dialect database.Dialect) error {
+		latest, err := Latest(dialect)
+		if err != nil {
+			return err
+		}
+		state.Latest = latest
+		version, dirty, err := m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			state.Version = -1
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		state.Version, state.Dirty = int(version), dirty
+		return nil
+	})
+	return state, err
+}
+
+// CurrentState returns the state of db, which has to have been migrated
+// before. Unlike ReadState it uses db itself, rather than a connection of
+// its own, and so is cheap enough to call on every readiness probe.
+func CurrentState(ctx context.Context, db *sql.DB, dialect database.Dialect) (State, error) {
+	latest, err := Latest(dialect)
+	if err != nil {
+		return State{}, err
+	}
+	state := State{Version: -1, Latest: latest}
+	err = db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&state.Version, &state.Dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return State{}, err
+	}
+	return state, nil
+}
+
+// Latest returns the version of the newest embedded migration of dialect.
+func Latest(dialect database.Dialect) (uint, error) {
+	list, err := List(dialect)
+	if err != nil || len(list) == 0 {
+		return 0, err
+	}
+	return list[len(list)-1].Version, nil
+}
+
+// Check returns an error unless every embedded migration has been applied
+// cleanly. A database migrated further, by a newer build, passes.
+func (s State) Check() error {
+	switch {
+	case s.Dirty:
+		return fmt.Errorf("the database schema is dirty: migration %d failed halfway and has to be repaired by hand and recorded with `migrate force N`", s.Version)
+	case s.Version < 0:
+		return fmt.Errorf("the database schema has no migrations applied, expected version %d; run `migrate up`", s.Latest)
+	case s.Version < int(s.Latest):
+		return fmt.Errorf("the database schema is at version %d, expected version %d; run `migrate up`", s.Version, s.Latest)
+	}
+	return nil
+}
+
+// Ahead reports whether the database has migrations this build does not
+// know about.
+func (s State) Ahead() bool {
+	return s.Version > int(s.Latest)
+}
+
+// Up applies the pending migrations to the database at dsn, logging each
+// to logger if it is not nil. It waits for migrations run elsewhere at the
+// same time, which makes it safe to call from every instance of a
+// service on startup.
+func Up(dsn string, logger migrate.Logger) error {
+	return withMigrate(dsn, func(m *migrate.Migrate, _ database.Dialect) error {
+		m.Log = logger
+		if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+		return nil
+	})
+}
+
+// withMigrate runs fn with a migrator on a connection of its own to dsn,
+// which is closed afterwards.
+func withMigrate(dsn string, fn func(m *migrate.Migrate, dialect database.Dialect) error) error {
+	db, dialect, err := database.Open(dsn)
+	if err != nil {
+		return err
+	}
+	m, err := New(db, dialect)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	defer m.Close()
+	return fn(m, dialect)
+}
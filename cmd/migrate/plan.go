@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go-rest/cmd/migrate/migrations"
+	"go-rest/internal/database"
+	"io"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// plan is a command that moves the database between versions: how to run
+// it, and which migrations it runs starting from a version, so that
+// --dry-run can print them instead.
+type plan struct {
+	run   func(m *migrate.Migrate) error
+	steps func(list []migrations.Migration, current int) ([]step, error)
+}
+
+// step is a migration applied (up) or reverted.
+type step struct {
+	migration migrations.Migration
+	up        bool
+}
+
+// split returns the migrations after current, oldest first, and applied
+// those up to current, newest first. current is -1 on a fresh database.
+func split(list []migrations.Migration, current int) (pending, applied []step) {
+	for _, mig := range list {
+		if int(mig.Version) > current {
+			pending = append(pending, step{mig, true})
+		} else {
+			applied = append([]step{{mig, false}}, applied...)
+		}
+	}
+	return pending, applied
+}
+
+func planUp() plan {
+	return plan{
+		run: func(m *migrate.Migrate) error { return m.Up() },
+		steps: func(list []migrations.Migration, current int) ([]step, error) {
+			pending, _ := split(list, current)
+			return pending, nil
+		},
+	}
+}
+
+func planDown() plan {
+	return plan{
+		run: func(m *migrate.Migrate) error { return m.Down() },
+		steps: func(list []migrations.Migration, current int) ([]step, error) {
+			_, applied := split(list, current)
+			return applied, nil
+		},
+	}
+}
+
+func planGoto(version uint) plan {
+	return plan{
+		run: func(m *migrate.Migrate) error { return m.Migrate(version) },
+		steps: func(list []migrations.Migration, current int) ([]step, error) {
+			known := false
+			for _, mig := range list {
+				known = known || mig.Version == version
+			}
+			if !known {
+				return nil, fmt.Errorf("there is no migration with version %d", version)
+			}
+			pending, applied := split(list, current)
+			var steps []step
+			for _, s := range pending {
+				if s.migration.Version <= version {
+					steps = append(steps, s)
+				}
+			}
+			for _, s := range applied {
+				if s.migration.Version > version {
+					steps = append(steps, s)
+				}
+			}
+			return steps, nil
+		},
+	}
+}
+
+func planSteps(n int) plan {
+	return plan{
+		run: func(m *migrate.Migrate) error { return m.Steps(n) },
+		steps: func(list []migrations.Migration, current int) ([]step, error) {
+			pending, applied := split(list, current)
+			steps, count := pending, n
+			if n < 0 {
+				steps, count = applied, -n
+			}
+			if count > len(steps) {
+				return nil, fmt.Errorf("cannot move %d steps, only %d are possible", n, len(steps))
+			}
+			return steps[:count], nil
+		},
+	}
+}
+
+// currentVersion returns the version of the database, -1 if no migration
+// has been applied, and an error if the database is dirty.
+func currentVersion(m *migrate.Migrate) (int, error) {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, migrate.ErrDirty{Version: int(version)}
+	}
+	return int(version), nil
+}
+
+// resolve returns the migrations the command would run on the database.
+func (p plan) resolve(m *migrate.Migrate, dialect database.Dialect) ([]step, error) {
+	list, err := migrations.List(dialect)
+	if err != nil {
+		return nil, err
+	}
+	current, err := currentVersion(m)
+	if err != nil {
+		return nil, err
+	}
+	return p.steps(list, current)
+}
+
+// printSteps writes the SQL of the given migrations to w.
+func printSteps(w io.Writer, dialect database.Dialect, steps []step) error {
+	if len(steps) == 0 {
+		fmt.Fprintln(w, "-- nothing to migrate")
+		return nil
+	}
+	for _, s := range steps {
+		sql, err := migrations.Read(dialect, s.migration, s.up)
+		if err != nil {
+			return err
+		}
+		direction := "down"
+		if s.up {
+			direction = "up"
+		}
+		fmt.Fprintf(w, "-- %s (%s)\n%s\n\n", s.migration, direction, strings.TrimSpace(sql))
+	}
+	return nil
+}
+
+// status writes every migration to w with whether it has been applied.
+func status(w io.Writer, m *migrate.Migrate, dialect database.Dialect) error {
+	list, err := migrations.List(dialect)
+	if err != nil {
+		return err
+	}
+	version, dirty, err := m.Version()
+	current := int(version)
+	switch {
+	case errors.Is(err, migrate.ErrNilVersion):
+		current = -1
+		fmt.Fprintln(w, "Version: none")
+	case err != nil:
+		return err
+	case dirty:
+		fmt.Fprintf(w, "Version: %d (dirty)\n", version)
+	default:
+		fmt.Fprintf(w, "Version: %d\n", version)
+	}
+
+	known := current < 0
+	for _, mig := range list {
+		state := "pending"
+		switch {
+		case int(mig.Version) == current && dirty:
+			state = "dirty"
+		case int(mig.Version) <= current:
+			state = "applied"
+		}
+		known = known || int(mig.Version) == current
+		fmt.Fprintf(w, "  %-8s %s\n", state, mig)
+	}
+	if !known {
+		fmt.Fprintf(w, "The database is at version %d, which this build does not know; it was migrated by a newer one.\n", current)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go-rest/cmd/migrate/migrations"
+	"go-rest/internal/database"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// testList has a gap at 4, as a list does after migrations were squashed.
+var testList = []migrations.Migration{{Version: 1, Name: "a"}, {Version: 2, Name: "b"}, {Version: 3, Name: "c"}, {Version: 5, Name: "e"}}
+
+// format writes steps as +N for applying migration N and -N for reverting
+// it.
+func format(steps []step) string {
+	s := make([]string, len(steps))
+	for i, st := range steps {
+		sign := "-"
+		if st.up {
+			sign = "+"
+		}
+		s[i] = fmt.Sprintf("%s%d", sign, st.migration.Version)
+	}
+	return strings.Join(s, " ")
+}
+
+func TestPlanSteps(t *testing.T) {
+	tests := []struct {
+		name    string
+		plan    plan
+		current int
+		want    string
+		err     string
+	}{
+		{name: "up on a fresh database", plan: planUp(), current: -1, want: "+1 +2 +3 +5"},
+		{name: "up", plan: planUp(), current: 2, want: "+3 +5"},
+		{name: "up to date", plan: planUp(), current: 5, want: ""},
+		{name: "down", plan: planDown(), current: 3, want: "-3 -2 -1"},
+		{name: "down on a fresh database", plan: planDown(), current: -1, want: ""},
+		{name: "goto up", plan: planGoto(2), current: -1, want: "+1 +2"},
+		{name: "goto down", plan: planGoto(1), current: 5, want: "-5 -3 -2"},
+		{name: "goto the current version", plan: planGoto(3), current: 3, want: ""},
+		{name: "goto an unknown version", plan: planGoto(4), current: 3, err: "there is no migration with version 4"},
+		{name: "steps up", plan: planSteps(2), current: 1, want: "+2 +3"},
+		{name: "steps across the gap", plan: planSteps(1), current: 3, want: "+5"},
+		{name: "steps down", plan: planSteps(-1), current: 5, want: "-5"},
+		{name: "more steps down", plan: planSteps(-2), current: 3, want: "-3 -2"},
+		{name: "too many steps up", plan: planSteps(5), current: -1, err: "cannot move 5 steps, only 4 are possible"},
+		{name: "too many steps down", plan: planSteps(-4), current: 3, err: "cannot move -4 steps, only 3 are possible"},
+	}
+	for _, tt := range tests {
+		steps, err := tt.plan.steps(testList, tt.current)
+		switch {
+		case tt.err != "":
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case format(steps) != tt.want:
+			t.Errorf("%s: steps = %q, want %q", tt.name, format(steps), tt.want)
+		}
+	}
+}
+
+// newStub returns a migrator running the SQLite migrations against a
+// driver that only records the version, and the driver.
+func newStub(t *testing.T) (*migrate.Migrate, *stub.Stub) {
+	t.Helper()
+	src, err := iofs.New(os.DirFS("migrations"), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := stub.WithInstance(nil, &stub.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewWithInstance("iofs", src, "stub", driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, driver.(*stub.Stub)
+}
+
+// TestPlanRun checks that each plan runs the migrations it resolves to.
+func TestPlanRun(t *testing.T) {
+	m, driver := newStub(t)
+	list, err := migrations.List(database.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := int(list[len(list)-1].Version)
+
+	for _, tt := range []struct {
+		plan    plan
+		want    string
+		version int
+	}{
+		{planGoto(3), "+1 +2 +3", 3},
+		{planSteps(2), "+4 +5", 5},
+		{planSteps(-3), "-5 -4 -3", 2},
+		{planUp(), "", latest},
+		{planDown(), "", -1},
+	} {
+		steps, err := tt.plan.resolve(m, database.SQLite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.want != "" && format(steps) != tt.want {
+			t.Errorf("steps = %q, want %q", format(steps), tt.want)
+		}
+		if err := tt.plan.run(m); err != nil {
+			t.Fatal(err)
+		}
+		if driver.CurrentVersion != tt.version || len(steps) != len(driver.MigrationSequence) {
+			t.Errorf("after %q: version %d with %d migrations run, want %d with %d", format(steps), driver.CurrentVersion, len(driver.MigrationSequence), tt.version, len(steps))
+		}
+		driver.MigrationSequence = nil
+	}
+}
+
+func TestForceDirty(t *testing.T) {
+	m, driver := newStub(t)
+	if err := planGoto(2).run(m); err != nil {
+		t.Fatal(err)
+	}
+	// A failed migration leaves its version dirty.
+	driver.SetVersion(3, true)
+
+	var dirty migrate.ErrDirty
+	if _, err := planUp().resolve(m, database.SQLite); !errors.As(err, &dirty) || dirty.Version != 3 {
+		t.Errorf("resolving on a dirty database: error = %v, want ErrDirty for 3", err)
+	}
+	var out strings.Builder
+	if err := status(&out, m, database.SQLite); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Version: 3 (dirty)\n", "  applied  000002_", "  dirty    000003_", "  pending  000004_"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("status lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	// After fixing the schema by hand, force records where it is.
+	if err := m.Force(3); err != nil {
+		t.Fatal(err)
+	}
+	steps, err := planSteps(1).resolve(m, database.SQLite)
+	if err != nil || format(steps) != "+4" {
+		t.Errorf("steps after force = %q, %v; want +4", format(steps), err)
+	}
+}
+
+func TestStatusUnknownVersion(t *testing.T) {
+	m, driver := newStub(t)
+	driver.SetVersion(999999, false)
+	var out strings.Builder
+	if err := status(&out, m, database.SQLite); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "which this build does not know") {
+		t.Errorf("status of a newer database:\n%s", out.String())
+	}
+}
+
+func TestPrintSteps(t *testing.T) {
+	var out strings.Builder
+	if err := printSteps(&out, database.SQLite, nil); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "-- nothing to migrate\n" {
+		t.Errorf("dry run without steps = %q", out.String())
+	}
+
+	out.Reset()
+	users := migrations.Migration{Version: 1, Name: "create_users_table"}
+	for _, dialect := range []database.Dialect{database.SQLite, database.Postgres} {
+		if err := printSteps(&out, dialect, []step{{users, true}, {users, false}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := out.String()
+	for _, want := range []string{
+		"-- 000001_create_users_table (up)\nCREATE TABLE users (\n    id INTEGER PRIMARY KEY",
+		"-- 000001_create_users_table (down)\nDROP TABLE",
+		"-- 000001_create_users_table (up)\nCREATE TABLE users (\n    id INTEGER GENERATED BY DEFAULT AS IDENTITY",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("dry run lacks %q:\n%s", want, got)
+		}
+	}
+}
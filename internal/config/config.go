@@ -0,0 +1,258 @@
+// Package config holds the settings of the API and where they come from.
+// Every setting has a default and can be set, in increasing order of
+// precedence, in a YAML or TOML file, in an environment variable and with a
+// command-line flag. Malformed values are errors rather than falling back
+// to the default.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// Config is the configuration of the API.
+type Config struct {
+	Log      Log
+	Tracing  Tracing
+	Server   Server
+	Database Database
+	Auth     Auth
+	Calendar Calendar
+}
+
+// Development is the environment in which the API runs without a
+// configured JWT key, signing with DevelopmentSecret.
+const Development = "development"
+
+// DevelopmentSecret is the JWT secret of development runs. Being public,
+// it is refused everywhere else.
+const DevelopmentSecret = "secret"
+
+// minSecretLength is the shortest JWT secret accepted outside development,
+// the size of the HS256 hash.
+const minSecretLength = 32
+
+type Log struct {
+	// Level is the least severe level logged.
+	Level slog.Level
+	// Format is "json" or "text".
+	Format string
+}
+
+type Tracing struct {
+	// Exporter is where spans are sent: "none", "otlp" to an OpenTelemetry
+	// collector, or "stdout" or "file" as JSON.
+	Exporter string
+	// Endpoint is the OTLP/HTTP URL of the collector.
+	Endpoint string
+	// File is the path the file exporter appends to.
+	File string
+	// ServiceName identifies the API in the traces.
+	ServiceName string
+}
+
+type Server struct {
+	// Environment is "development" on a developer's machine and anything
+	// else, "production" by default, where the API must be secured.
+	Environment string
+	// Port is the TCP port the API listens on.
+	Port int
+	// TrustedProxies are the addresses and CIDR ranges of the proxies
+	// whose X-Forwarded-For headers are believed. Empty trusts every
+	// proxy.
+	TrustedProxies []string
+	// ShutdownDelay is how long the API keeps serving after a SIGTERM,
+	// with readiness failing, so that load balancers can take it out of
+	// rotation before it stops accepting connections.
+	ShutdownDelay time.Duration
+	// ShutdownTimeout is how long requests in flight and background
+	// workers get to finish after that.
+	ShutdownTimeout time.Duration
+}
+
+type Database struct {
+	// URL is a SQLite path or a postgres:// URL.
+	URL string
+	// AutoMigrate applies pending migrations on startup.
+	AutoMigrate bool
+	// ReadTimeout, WriteTimeout and SearchTimeout bound single database
+	// calls; zero disables the limit.
+	ReadTimeout   time.Duration
+	WriteTimeout  time.Duration
+	SearchTimeout time.Duration
+	// SlowQueryThreshold is how long a statement may take before it is
+	// logged as slow; zero disables the log.
+	SlowQueryThreshold time.Duration
+}
+
+type Auth struct {
+	// JWTSecret signs the access tokens. Tokens signed with it carry no
+	// kid header.
+	JWTSecret string
+	// JWTKeys are keys identified by the kid header of the tokens. The
+	// first one signs new tokens, ahead of JWTSecret; the others only
+	// verify the tokens signed before it was added.
+	JWTKeys []JWTKey
+	// JWTKeyFiles are RSA or Ed25519 keys in PEM files, which sign ahead
+	// of JWTKeys and whose public halves other services can fetch to
+	// verify tokens themselves.
+	JWTKeyFiles []JWTKey
+	// Issuer and Audience are the iss and aud claims of the tokens.
+	Issuer   string
+	Audience string
+	// AccessTokenTTL and RefreshTokenTTL are how long the tokens issued
+	// on login and refresh stay valid.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// SessionCleanupInterval is how often ended sessions are deleted;
+	// zero disables it.
+	SessionCleanupInterval time.Duration
+}
+
+// JWTKey is a key that signs or verifies JWTs and the ID under which tokens
+// refer to it. It is either an HMAC secret or the path of a PEM file
+// holding a private key, or just the public key of one that no longer signs.
+type JWTKey struct {
+	ID     string
+	Secret string
+	File   string
+}
+
+// Keys returns the JWT keys, the one to sign new tokens with first.
+func (a Auth) Keys() []JWTKey {
+	keys := slices.Concat(a.JWTKeyFiles, a.JWTKeys)
+	if a.JWTSecret != "" {
+		keys = append(keys, JWTKey{Secret: a.JWTSecret})
+	}
+	return keys
+}
+
+type Calendar struct {
+	// Domain is the domain part of the UIDs of exported events.
+	Domain string
+	// BaseURL is the public URL of the API, which feed and event URLs are
+	// built from. It is configured rather than taken from the request so
+	// that a client cannot choose the host through the Host header.
+	BaseURL string
+}
+
+// Default returns the configuration used where nothing else is set.
+func Default() *Config {
+	return &Config{
+		Log: Log{
+			Level:  slog.LevelInfo,
+			Format: "json",
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			Endpoint:    "http://localhost:4318",
+			ServiceName: "go-rest",
+		},
+		Server: Server{
+			Environment:     "production",
+			Port:            8080,
+			ShutdownTimeout: 15 * time.Second,
+		},
+		Database: Database{
+			URL:                "./data.db",
+			ReadTimeout:        3 * time.Second,
+			WriteTimeout:       3 * time.Second,
+			SearchTimeout:      3 * time.Second,
+			SlowQueryThreshold: 200 * time.Millisecond,
+		},
+		Auth: Auth{
+			Issuer:                 "go-rest",
+			Audience:               "go-rest",
+			AccessTokenTTL:         15 * time.Minute,
+			RefreshTokenTTL:        30 * 24 * time.Hour,
+			SessionCleanupInterval: time.Hour,
+		},
+		Calendar: Calendar{
+			Domain:  "go-rest.local",
+			BaseURL: "http://localhost:8080",
+		},
+	}
+}
+
+// problems collects the settings whose value is out of range.
+type problems []error
+
+func (p *problems) check(ok bool, format string, args ...any) {
+	if !ok {
+		*p = append(*p, fmt.Errorf(format, args...))
+	}
+}
+
+// Validate reports every setting whose value is out of range. The API
+// checks all of them; commands that only use the database, such as
+// migrate, check just that with Database.Validate.
+func (c *Config) Validate() error {
+	var errs problems
+	check := errs.check
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format must be json or text, got %q", c.Log.Format)
+	check(slices.Contains([]string{"none", "otlp", "stdout", "file"}, c.Tracing.Exporter), "tracing.exporter must be none, otlp, stdout or file, got %q", c.Tracing.Exporter)
+	if c.Tracing.Exporter == "otlp" {
+		u, err := url.Parse(c.Tracing.Endpoint)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "tracing.endpoint must be an http or https URL, got %q", c.Tracing.Endpoint)
+	}
+	check(c.Tracing.Exporter != "file" || c.Tracing.File != "", "tracing.file must be set for the file exporter")
+	check(c.Tracing.ServiceName != "", "tracing.service_name must not be empty")
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil, "server.trusted_proxies: %q is neither an IP address nor a CIDR range", proxy)
+	}
+	check(c.Server.ShutdownDelay >= 0, "server.shutdown_delay must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	c.Database.check(&errs)
+	keys := c.Auth.Keys()
+	check(len(keys) > 0, "no JWT key is configured; set auth.jwt_secret, auth.jwt_keys or auth.jwt_key_files, or server.environment to %s", Development)
+	ids := map[string]bool{}
+	for _, key := range keys {
+		check(!ids[key.ID] || key.ID == "", "JWT key ID %q is used twice", key.ID)
+		ids[key.ID] = true
+	}
+	check(c.Auth.Issuer != "", "auth.issuer must not be empty")
+	check(c.Auth.Audience != "", "auth.audience must not be empty")
+	if c.Server.Environment != Development {
+		for _, key := range keys {
+			if key.File != "" {
+				continue
+			}
+			name := "auth.jwt_secret"
+			if key.ID != "" {
+				name = fmt.Sprintf("auth.jwt_keys[%s]", key.ID)
+			}
+			check(key.Secret != DevelopmentSecret && len(key.Secret) >= minSecretLength,
+				"%s must be at least %d bytes and not the development default in environment %q; generate one with `openssl rand -base64 32`", name, minSecretLength, c.Server.Environment)
+		}
+	}
+	check(c.Auth.AccessTokenTTL > 0, "auth.access_token_ttl must be positive")
+	check(c.Auth.RefreshTokenTTL > c.Auth.AccessTokenTTL, "auth.refresh_token_ttl must be longer than auth.access_token_ttl")
+	check(c.Auth.SessionCleanupInterval >= 0, "auth.session_cleanup_interval must not be negative")
+	check(c.Calendar.Domain != "", "calendar.domain must not be empty")
+	u, err := url.Parse(c.Calendar.BaseURL)
+	check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.RawQuery == "" && u.Fragment == "",
+		"calendar.base_url must be an http or https URL without query, got %q", c.Calendar.BaseURL)
+	return errors.Join(errs...)
+}
+
+// Validate reports the database settings whose value is out of range.
+func (d Database) Validate() error {
+	var errs problems
+	d.check(&errs)
+	return errors.Join(errs...)
+}
+
+func (d Database) check(errs *problems) {
+	errs.check(d.URL != "", "database.url must not be empty")
+	errs.check(d.ReadTimeout >= 0, "database.read_timeout must not be negative")
+	errs.check(d.WriteTimeout >= 0, "database.write_timeout must not be negative")
+	errs.check(d.SearchTimeout >= 0, "database.search_timeout must not be negative")
+	errs.check(d.SlowQueryThreshold >= 0, "database.slow_query_threshold must not be negative")
+}
@@ -0,0 +1,441 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// setting is one configuration value: its key in the config file, the
+// environment variable that sets it, and the flag named after the key.
+type setting struct {
+	key   string
+	env   string
+	usage string
+	value value
+	// redact, if set, hides the secret parts of the value when printed.
+	redact func(string) string
+	// source describes where the value came from.
+	source string
+}
+
+// value parses and prints a setting. *string, *int and so on are wrapped
+// in the types below to provide it.
+type value interface {
+	Set(string) error
+	String() string
+}
+
+func (c *Config) settings() []*setting {
+	return []*setting{
+		{key: "log.level", env: "LOG_LEVEL", usage: "least severe level logged: debug, info, warn or error", value: (*levelValue)(&c.Log.Level)},
+		{key: "log.format", env: "LOG_FORMAT", usage: "json or text", value: (*stringValue)(&c.Log.Format)},
+		{key: "tracing.exporter", env: "TRACING_EXPORTER", usage: "where to send traces: none, otlp, stdout or file", value: (*stringValue)(&c.Tracing.Exporter)},
+		{key: "tracing.endpoint", env: "TRACING_ENDPOINT", usage: "URL of the OTLP/HTTP collector for the otlp exporter", value: (*stringValue)(&c.Tracing.Endpoint)},
+		{key: "tracing.file", env: "TRACING_FILE", usage: "file the file exporter appends spans to as JSON", value: (*stringValue)(&c.Tracing.File)},
+		{key: "tracing.service_name", env: "TRACING_SERVICE_NAME", usage: "service.name of the spans", value: (*stringValue)(&c.Tracing.ServiceName)},
+		{key: "server.environment", env: "APP_ENV", usage: "development, or anything else to require a strong JWT key", value: (*stringValue)(&c.Server.Environment)},
+		{key: "server.port", env: "PORT", usage: "TCP port to listen on", value: (*intValue)(&c.Server.Port)},
+		{key: "server.trusted_proxies", env: "TRUSTED_PROXIES", usage: "comma-separated proxy addresses or CIDR ranges to trust X-Forwarded-For from; empty trusts all", value: (*listValue)(&c.Server.TrustedProxies)},
+		{key: "server.shutdown_delay", env: "SHUTDOWN_DELAY", usage: "how long to keep serving after SIGTERM with readiness failing", value: (*durationValue)(&c.Server.ShutdownDelay)},
+		{key: "server.shutdown_timeout", env: "SHUTDOWN_TIMEOUT", usage: "how long requests in flight and workers get to finish on shutdown", value: (*durationValue)(&c.Server.ShutdownTimeout)},
+		{key: "database.url", env: "DATABASE_URL", usage: "SQLite path or postgres:// URL", value: (*stringValue)(&c.Database.URL), redact: redactURL},
+		{key: "database.slow_query_threshold", env: "DB_SLOW_QUERY_THRESHOLD", usage: "log statements that take longer, 0 for none", value: (*durationValue)(&c.Database.SlowQueryThreshold)},
+		{key: "database.auto_migrate", env: "DB_AUTO_MIGRATE", usage: "apply pending migrations on startup", value: (*boolValue)(&c.Database.AutoMigrate)},
+		{key: "database.read_timeout", env: "DB_READ_TIMEOUT", usage: "limit of a single database read, 0 for none", value: (*durationValue)(&c.Database.ReadTimeout)},
+		{key: "database.write_timeout", env: "DB_WRITE_TIMEOUT", usage: "limit of a single database write, 0 for none", value: (*durationValue)(&c.Database.WriteTimeout)},
+		{key: "database.search_timeout", env: "DB_SEARCH_TIMEOUT", usage: "limit of a single full-text search, 0 for none", value: (*durationValue)(&c.Database.SearchTimeout)},
+		{key: "auth.jwt_secret", env: "JWT_SECRET", usage: "secret that signs access tokens", value: (*stringValue)(&c.Auth.JWTSecret), redact: redactAll},
+		{key: "auth.jwt_keys", env: "JWT_KEYS", usage: "comma-separated kid=secret pairs, the first of which signs new tokens", value: (*keysValue)(&c.Auth.JWTKeys), redact: redactAll},
+		{key: "auth.jwt_key_files", env: "JWT_KEY_FILES", usage: "comma-separated kid=path pairs of PEM files with RSA or Ed25519 keys, signing ahead of auth.jwt_keys", value: (*keyFilesValue)(&c.Auth.JWTKeyFiles)},
+		{key: "auth.issuer", env: "JWT_ISSUER", usage: "iss claim of the tokens", value: (*stringValue)(&c.Auth.Issuer)},
+		{key: "auth.audience", env: "JWT_AUDIENCE", usage: "aud claim of the tokens", value: (*stringValue)(&c.Auth.Audience)},
+		{key: "auth.access_token_ttl", env: "ACCESS_TOKEN_TTL", usage: "lifetime of access tokens", value: (*durationValue)(&c.Auth.AccessTokenTTL)},
+		{key: "auth.refresh_token_ttl", env: "REFRESH_TOKEN_TTL", usage: "lifetime of refresh tokens and sessions", value: (*durationValue)(&c.Auth.RefreshTokenTTL)},
+		{key: "auth.session_cleanup_interval", env: "SESSION_CLEANUP_INTERVAL", usage: "how often expired and revoked sessions are deleted, 0 for never", value: (*durationValue)(&c.Auth.SessionCleanupInterval)},
+		{key: "calendar.domain", env: "CALENDAR_DOMAIN", usage: "domain part of the UIDs of exported events", value: (*stringValue)(&c.Calendar.Domain)},
+		{key: "calendar.base_url", env: "CALENDAR_BASE_URL", usage: "public URL of the API that calendar feed and event URLs start with", value: (*stringValue)(&c.Calendar.BaseURL)},
+	}
+}
+
+// flagName returns the flag of a setting, e.g. --database-read-timeout for
+// database.read_timeout.
+func (s *setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+// Loaded is a configuration together with where each of its values came
+// from, for Print.
+type Loaded struct {
+	*Config
+	settings []*setting
+}
+
+// Load builds the configuration from the defaults, the file named by
+// --config or CONFIG_FILE, the environment and the flags in args, each
+// overriding the ones before. The setting flags are added to fs, which may
+// carry flags of the caller's own and is parsed with args. Malformed values
+// are errors, but whether they are in range is left to the caller, which
+// validates the settings it uses.
+func Load(fs *flag.FlagSet, args []string) (*Loaded, error) {
+	cfg := Default()
+	settings := cfg.settings()
+	for _, s := range settings {
+		s.source = "default"
+	}
+
+	// Flags are collected first, to find --config, and applied last.
+	flags := map[string]string{}
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML (.yaml, .yml) or TOML (.toml) config file; defaults to $CONFIG_FILE")
+	for _, s := range settings {
+		name := s.flagName()
+		_, isBool := s.value.(*boolValue)
+		usage := fmt.Sprintf("%s ($%s, default %s)", s.usage, s.env, s.print())
+		if !isBool {
+			// flag shows the backquoted word as the flag's argument.
+			usage = fmt.Sprintf("%s (`%s`, $%s, default %s)", s.usage, typeName(s.value), s.env, s.print())
+		}
+		fs.Var(flagValue{flags: flags, name: name, isBool: isBool}, name, usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range settings {
+			v, ok := values[s.key]
+			if !ok {
+				continue
+			}
+			delete(values, s.key)
+			if err := s.value.Set(v); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", *configFile, s.key, err)
+			}
+			s.source = *configFile
+		}
+		if len(values) > 0 {
+			return nil, fmt.Errorf("%s: unknown settings %s", *configFile, strings.Join(slices.Sorted(maps.Keys(values)), ", "))
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err := s.value.Set(v); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+			s.source = "$" + s.env
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := flags[s.flagName()]; ok {
+			if err := s.value.Set(v); err != nil {
+				return nil, fmt.Errorf("--%s: %w", s.flagName(), err)
+			}
+			s.source = "--" + s.flagName()
+		}
+	}
+
+	if cfg.Server.Environment == Development && len(cfg.Auth.Keys()) == 0 {
+		cfg.Auth.JWTSecret = DevelopmentSecret
+		for _, s := range settings {
+			if s.key == "auth.jwt_secret" {
+				s.source = "development default"
+			}
+		}
+	}
+
+	return &Loaded{Config: cfg, settings: settings}, nil
+}
+
+// readFile reads a config file into a map from the dotted keys of the
+// settings, such as database.url, to their values in the form the
+// environment would give them.
+func readFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &doc)
+	case ".toml":
+		err = toml.Unmarshal(b, &doc)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config file type %q, use .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	values := map[string]string{}
+	flatten(values, "", doc)
+	return values, nil
+}
+
+func flatten(values map[string]string, prefix string, doc map[string]any) {
+	for k, v := range doc {
+		key := prefix + k
+		switch v := v.(type) {
+		case map[string]any:
+			flatten(values, key+".", v)
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+// Print writes the configuration to w in the YAML format Load reads,
+// noting where each value came from. Secrets are redacted.
+func (l *Loaded) Print(w io.Writer) {
+	section := ""
+	for _, s := range l.settings {
+		group, name, _ := strings.Cut(s.key, ".")
+		if group != section {
+			section = group
+			fmt.Fprintf(w, "%s:\n", group)
+		}
+		fmt.Fprintf(w, "  %s: %s # %s\n", name, s.print(), s.source)
+	}
+}
+
+// print returns the value of a setting in YAML, redacted if it is secret.
+func (s *setting) print() string {
+	switch v := s.value.(type) {
+	case *listValue:
+		return quoteList(*v)
+	case *keysValue:
+		items := make([]string, len(*v))
+		for i, key := range *v {
+			items[i] = key.ID + "=" + s.redact(key.Secret)
+		}
+		return quoteList(items)
+	case *keyFilesValue:
+		items := make([]string, len(*v))
+		for i, key := range *v {
+			items[i] = key.ID + "=" + key.File
+		}
+		return quoteList(items)
+	}
+	v := s.value.String()
+	if s.redact != nil {
+		v = s.redact(v)
+	}
+	switch s.value.(type) {
+	case *stringValue, *durationValue, *levelValue:
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+func quoteList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = strconv.Quote(item)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func redactAll(v string) string {
+	if v == "" {
+		return ""
+	}
+	return "REDACTED"
+}
+
+// redactURL hides the password of a database URL.
+func redactURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil || u.User == nil {
+		return v
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "REDACTED")
+	}
+	return u.String()
+}
+
+// flagValue records a setting flag for Load to apply after the file and
+// the environment.
+type flagValue struct {
+	flags  map[string]string
+	name   string
+	isBool bool
+}
+
+func (f flagValue) Set(v string) error { f.flags[f.name] = v; return nil }
+func (f flagValue) String() string     { return "" }
+func (f flagValue) IsBoolFlag() bool   { return f.isBool }
+
+func typeName(v value) string {
+	switch v.(type) {
+	case *intValue:
+		return "int"
+	case *durationValue:
+		return "duration"
+	case *listValue, *keysValue, *keyFilesValue:
+		return "list"
+	case *levelValue:
+		return "level"
+	}
+	return "string"
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", s)
+	}
+	*v = intValue(n)
+	return nil
+}
+
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q, use true or false", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, use e.g. 3s, 500ms or 1h30m", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+
+type levelValue slog.Level
+
+func (v *levelValue) Set(s string) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return fmt.Errorf("invalid level %q, use debug, info, warn or error", s)
+	}
+	*v = levelValue(level)
+	return nil
+}
+
+func (v *levelValue) String() string { return strings.ToLower(slog.Level(*v).String()) }
+
+// listValue is a comma-separated list; blank items are dropped.
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+
+func (v *listValue) String() string { return strings.Join(*v, ",") }
+
+// keysValue is a comma-separated list of kid=secret pairs.
+type keysValue []JWTKey
+
+func (v *keysValue) Set(s string) error {
+	pairs, err := parseKeys(s, "secret")
+	if err != nil {
+		return err
+	}
+	*v = nil
+	for _, pair := range pairs {
+		*v = append(*v, JWTKey{ID: pair[0], Secret: pair[1]})
+	}
+	return nil
+}
+
+func (v *keysValue) String() string {
+	items := make([]string, len(*v))
+	for i, key := range *v {
+		items[i] = key.ID + "=" + key.Secret
+	}
+	return strings.Join(items, ",")
+}
+
+// keyFilesValue is a comma-separated list of kid=path pairs.
+type keyFilesValue []JWTKey
+
+func (v *keyFilesValue) Set(s string) error {
+	pairs, err := parseKeys(s, "path")
+	if err != nil {
+		return err
+	}
+	*v = nil
+	for _, pair := range pairs {
+		*v = append(*v, JWTKey{ID: pair[0], File: pair[1]})
+	}
+	return nil
+}
+
+func (v *keyFilesValue) String() string {
+	items := make([]string, len(*v))
+	for i, key := range *v {
+		items[i] = key.ID + "=" + key.File
+	}
+	return strings.Join(items, ",")
+}
+
+// parseKeys splits a comma-separated list of kid=value pairs.
+func parseKeys(s, value string) ([][2]string, error) {
+	var list listValue
+	list.Set(s)
+	var pairs [][2]string
+	for i, item := range list {
+		id, v, ok := strings.Cut(item, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" || v == "" {
+			// The item is not echoed, as it may be a secret.
+			return nil, fmt.Errorf("key %d is not of the form kid=%s", i+1, value)
+		}
+		pairs = append(pairs, [2]string{id, v})
+	}
+	return pairs, nil
+}
@@ -0,0 +1,253 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// clearEnv unsets the variables of all settings for the duration of the
+// test, so that the environment running it does not leak in.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, s := range Default().settings() {
+		t.Setenv(s.env, "")
+		os.Unsetenv(s.env)
+	}
+	t.Setenv("CONFIG_FILE", "")
+	os.Unsetenv("CONFIG_FILE")
+}
+
+// load loads and validates the configuration as the API does.
+func load(args ...string) (*Loaded, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg, err := Load(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Validate()
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func printed(l *Loaded) string {
+	var b strings.Builder
+	l.Print(&b)
+	return b.String()
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	file := writeFile(t, "config.yaml", `
+log:
+  format: text
+server:
+  port: 1000
+database:
+  url: ./file.db
+auth:
+  jwt_secret: `+testSecret+`
+`)
+	t.Setenv("PORT", "2000")
+	t.Setenv("DATABASE_URL", "./env.db")
+	cfg, err := load("--config", file, "--server-port", "3000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 3000 || cfg.Database.URL != "./env.db" || cfg.Log.Format != "text" || cfg.Tracing.ServiceName != "go-rest" {
+		t.Errorf("config = %+v %+v %+v %+v", cfg.Server, cfg.Database, cfg.Log, cfg.Tracing)
+	}
+	out := printed(cfg)
+	for _, want := range []string{
+		"  port: 3000 # --server-port\n",
+		`  url: "./env.db" # $DATABASE_URL` + "\n",
+		`  format: "text" # ` + file + "\n",
+		`  service_name: "go-rest" # default` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printed config lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.toml", `
+[server]
+port = 1000
+trusted_proxies = ["10.0.0.1", "10.1.0.0/16"]
+
+[database]
+auto_migrate = true
+read_timeout = "250ms"
+
+[auth]
+jwt_secret = "`+testSecret+`"
+`))
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 1000 || !slices.Equal(cfg.Server.TrustedProxies, []string{"10.0.0.1", "10.1.0.0/16"}) ||
+		!cfg.Database.AutoMigrate || cfg.Database.ReadTimeout != 250*time.Millisecond {
+		t.Errorf("config = %+v %+v", cfg.Server, cfg.Database)
+	}
+}
+
+func TestLoadValues(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("TRUSTED_PROXIES", " 10.0.0.1, ,10.0.0.0/8 ")
+	t.Setenv("DB_AUTO_MIGRATE", "false")
+	t.Setenv("LOG_LEVEL", "WARN")
+	t.Setenv("JWT_KEYS", "2030="+testSecret+", 2029 = "+testSecret)
+	// A bool flag without a value is true.
+	cfg, err := load("--database-auto-migrate", "--database-read-timeout", "1m30s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cfg.Server.TrustedProxies, []string{"10.0.0.1", "10.0.0.0/8"}) {
+		t.Errorf("trusted proxies = %q", cfg.Server.TrustedProxies)
+	}
+	if !cfg.Database.AutoMigrate || cfg.Database.ReadTimeout != 90*time.Second {
+		t.Errorf("database = %+v", cfg.Database)
+	}
+	if cfg.Log.Level.String() != "WARN" {
+		t.Errorf("log level = %v", cfg.Log.Level)
+	}
+	keys := cfg.Auth.Keys()
+	if len(keys) != 3 || keys[0].ID != "2030" || keys[1].ID != "2029" || keys[2].ID != "" {
+		t.Errorf("keys = %+v, want 2030, 2029 and the unnamed secret", keys)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		file string
+		args []string
+		want string
+	}{
+		{name: "malformed integer", env: map[string]string{"PORT": "abc"}, want: `PORT: invalid integer "abc"`},
+		{name: "malformed duration", env: map[string]string{"SHUTDOWN_TIMEOUT": "5"}, want: `SHUTDOWN_TIMEOUT: invalid duration "5"`},
+		{name: "malformed boolean", env: map[string]string{"DB_AUTO_MIGRATE": "yes"}, want: `DB_AUTO_MIGRATE: invalid boolean "yes"`},
+		{name: "malformed level", env: map[string]string{"LOG_LEVEL": "loud"}, want: `LOG_LEVEL: invalid level "loud"`},
+		{name: "malformed key", env: map[string]string{"JWT_KEYS": "no-id"}, want: "JWT_KEYS: key 1 is not of the form kid=secret"},
+		{name: "malformed flag", args: []string{"--server-port", "x"}, want: `--server-port: invalid integer "x"`},
+		{name: "unknown flag", args: []string{"--server-host", "x"}, want: "flag provided but not defined"},
+		{name: "malformed file value", file: "server:\n  port: abc\n", want: `server.port: invalid integer "abc"`},
+		{name: "unknown file key", file: "server:\n  host: x\n  prot: 1\n", want: "unknown settings server.host, server.prot"},
+		{name: "out of range", env: map[string]string{"PORT": "70000"}, want: "server.port must be between 1 and 65535"},
+		{name: "no JWT key", env: map[string]string{"JWT_SECRET": ""}, want: "no JWT key is configured"},
+		{name: "weak JWT key", env: map[string]string{"JWT_SECRET": "short"}, want: "auth.jwt_secret must be at least 32 bytes"},
+		{name: "calendar base URL", env: map[string]string{"CALENDAR_BASE_URL": "events.example.com"}, want: "calendar.base_url must be an http or https URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv("JWT_SECRET", testSecret)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"--config", writeFile(t, "config.yaml", tt.file)}, args...)
+			}
+			if _, err := load(args...); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	clearEnv(t)
+	if _, err := load("--config", writeFile(t, "config.json", "{}")); err == nil || !strings.Contains(err.Error(), "unsupported config file type") {
+		t.Errorf("error of a JSON file = %v", err)
+	}
+}
+
+func TestDevelopmentSecret(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("APP_ENV", Development)
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Auth.JWTSecret != DevelopmentSecret {
+		t.Errorf("JWT secret in development = %q, want the development default", cfg.Auth.JWTSecret)
+	}
+	if out := printed(cfg); !strings.Contains(out, `jwt_secret: "REDACTED" # development default`) {
+		t.Errorf("printed config:\n%s", out)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("JWT_KEYS", "2030=another-secret-that-is-long-enough")
+	t.Setenv("JWT_KEY_FILES", "rsa=/etc/keys/rsa.pem")
+	t.Setenv("DATABASE_URL", "postgres://app:hunter2@db:5432/events")
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := printed(cfg)
+	for _, secret := range []string{testSecret, "another-secret", "hunter2"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("printed config contains %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{
+		`  url: "postgres://app:REDACTED@db:5432/events" # $DATABASE_URL`,
+		`  jwt_secret: "REDACTED" # $JWT_SECRET`,
+		`  jwt_keys: ["2030=REDACTED"] # $JWT_KEYS`,
+		// Key files are paths, not secrets.
+		`  jwt_key_files: ["rsa=/etc/keys/rsa.pem"] # $JWT_KEY_FILES`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printed config lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+// TestDatabaseValidate checks what migrate, which only validates the
+// database settings, accepts: a production configuration without JWT keys,
+// but not an invalid database setting.
+func TestDatabaseValidate(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DATABASE_URL", "./migrate.db")
+	cfg, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Database.Validate(); err != nil {
+		t.Errorf("Database.Validate without JWT keys: %v", err)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "no JWT key is configured") {
+		t.Errorf("Validate without JWT keys: error = %v", err)
+	}
+
+	cfg.Database.URL = ""
+	cfg.Database.ReadTimeout = -time.Second
+	err = cfg.Database.Validate()
+	for _, want := range []string{"database.url must not be empty", "database.read_timeout must not be negative"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Database.Validate: error = %v, want one containing %q", err, want)
+		}
+	}
+}
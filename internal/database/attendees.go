@@ -3,103 +3,356 @@ package database
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
 )
 
 type AttendeeModel struct {
-	DB *sql.DB
+	DB       DBTX
+	Dialect  Dialect
+	Timeouts Timeouts
 }
 
+// RSVP answers. Only attendees who are going hold or wait for a seat.
+const (
+	RSVPGoing    = "going"
+	RSVPMaybe    = "maybe"
+	RSVPDeclined = "declined"
+)
+
+// Attendee statuses. Registrations beyond an event's capacity are
+// waitlisted and promoted in order when a seat frees up.
+const (
+	AttendeeRegistered = "registered"
+	AttendeeWaitlisted = "waitlisted"
+)
+
 type Attendee struct {
-	ID      int `json:"id"`
-	UserID  int `json:"user_id" binding:"required"`
-	EventID int `json:"event_id" binding:"required"`
+	ID      int    `json:"id"`
+	UserID  int    `json:"user_id" binding:"required"`
+	EventID int    `json:"event_id" binding:"required"`
+	RSVP    string `json:"rsvp"`
+	// Status is empty unless RSVP is going.
+	Status string `json:"status,omitempty"`
+	// WaitlistPosition is 1 for the next attendee to be promoted and nil
+	// for registered attendees.
+	WaitlistPosition *int `json:"waitlist_position,omitempty"`
 }
 
-func (m *AttendeeModel) Insert(Attendee *Attendee) (*Attendee, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// EventAttendee is a user as listed among the attendees of an event.
+type EventAttendee struct {
+	ID               int    `json:"id"`
+	UserName         string `json:"username"`
+	Email            string `json:"email"`
+	RSVP             string `json:"rsvp"`
+	Status           string `json:"status,omitempty"`
+	WaitlistPosition *int   `json:"waitlist_position,omitempty"`
+}
+
+// waitlistPosition computes the 1-based waitlist position of the attendee
+// row aliased as a, or NULL if it is not waitlisted.
+const waitlistPosition = `CASE WHEN a.status = 'waitlisted' THEN (
+	SELECT COUNT(*) FROM attendees w
+	WHERE w.event_id = a.event_id AND w.status = 'waitlisted'
+	AND (w.created_at < a.created_at OR (w.created_at = a.created_at AND w.id <= a.id))
+) END`
+
+// seatStatus decides the status of an attendee of the event row aliased as e
+// whose RSVP is bound to rsvpParam: a seat if one is free, the waitlist if
+// the event is full, and none unless they are going.
+func seatStatus(rsvpParam string) string {
+	return `CASE WHEN ` + rsvpParam + ` <> 'going' THEN NULL
+		WHEN e.capacity IS NULL OR (
+			SELECT COUNT(*) FROM attendees r WHERE r.event_id = e.id AND r.status = 'registered'
+		) < e.capacity THEN 'registered' ELSE 'waitlisted' END`
+}
+
+// Insert adds a user to an event. Users who are going get a seat, or are
+// waitlisted when the event is full. The seat count and the insert happen in
+// a single statement inside a transaction, so concurrent registrations can
+// never overbook an event.
+func (m *AttendeeModel) Insert(ctx context.Context, attendee *Attendee) (*Attendee, error) {
+	ctx, span := startSpan(ctx, "AttendeeModel.Insert")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
 	defer cancel()
 
-	query := "INSERT INTO attendees (user_id, event_id) VALUES ($1, $2) RETURNING id"
-	err := m.DB.QueryRowContext(ctx, query, Attendee.UserID, Attendee.EventID).Scan(&Attendee.ID)
+	tx, err := begin(ctx, m.DB, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	if err := m.Dialect.lockEvent(ctx, tx, attendee.EventID); err != nil {
+		return nil, err
+	}
+	if err := insertAttendee(ctx, tx, m.Dialect, attendee); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 
-	return Attendee, nil
+	return attendee, nil
 }
-func (m *AttendeeModel) GetByEventAndAttendee(eventID int, userID int) (*Attendee, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+
+func insertAttendee(ctx context.Context, tx DBTX, d Dialect, attendee *Attendee) error {
+	if attendee.RSVP == "" {
+		attendee.RSVP = RSVPGoing
+	}
+	query := `INSERT INTO attendees (user_id, created_at, rsvp, event_id, status)
+		SELECT ` + d.typed("$1", "integer") + `, ` + d.typed("$2", "timestamptz") + `, ` + d.typed("$3", "text") + `, e.id, ` + seatStatus("$3") + `
+		FROM events e WHERE e.id = $4 AND e.deleted_at IS NULL
+		RETURNING id`
+	err := tx.QueryRowContext(ctx, query, attendee.UserID, time.Now().UTC(), attendee.RSVP, attendee.EventID).Scan(&attendee.ID)
+	if err != nil {
+		// No row means that the event does not exist or was deleted.
+		return translate(err)
+	}
+	return loadAttendeeStatus(ctx, tx, attendee)
+}
+
+// loadAttendeeStatus refreshes the seat status and waitlist position of an
+// attendee that has just been written.
+func loadAttendeeStatus(ctx context.Context, tx DBTX, attendee *Attendee) error {
+	query := "SELECT COALESCE(a.status, ''), " + waitlistPosition + " FROM attendees a WHERE a.id = $1"
+	return tx.QueryRowContext(ctx, query, attendee.ID).Scan(&attendee.Status, &attendee.WaitlistPosition)
+}
+
+// SetRSVP records a user's answer for an event, adding them as an attendee
+// if needed. Switching to going queues them behind everyone already waiting;
+// switching away from going frees their seat for the waitlist.
+func (m *AttendeeModel) SetRSVP(ctx context.Context, eventID int, userID int, rsvp string) (*Attendee, error) {
+	ctx, span := startSpan(ctx, "AttendeeModel.SetRSVP")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
 	defer cancel()
 
-	query := "SELECT * FROM attendees WHERE event_id = $1 AND user_id = $2"
-	row := m.DB.QueryRowContext(ctx, query, eventID, userID)
-	attendee := &Attendee{}
-	err := row.Scan(&attendee.ID, &attendee.UserID, &attendee.EventID)
+	tx, err := begin(ctx, m.DB, nil)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := m.Dialect.lockEvent(ctx, tx, eventID); err != nil {
+		return nil, err
+	}
+	attendee := &Attendee{EventID: eventID, UserID: userID, RSVP: rsvp}
+	var current string
+	query := "SELECT id, rsvp FROM attendees WHERE event_id = $1 AND user_id = $2"
+	err = tx.QueryRowContext(ctx, query, eventID, userID).Scan(&attendee.ID, &current)
+	switch {
+	case err == sql.ErrNoRows:
+		if err := insertAttendee(ctx, tx, m.Dialect, attendee); err != nil {
+			return nil, err
 		}
+	case err != nil:
+		return nil, err
+	case current == rsvp:
+		if err := loadAttendeeStatus(ctx, tx, attendee); err != nil {
+			return nil, err
+		}
+	case rsvp == RSVPGoing:
+		query := `UPDATE attendees SET rsvp = $1, created_at = $2, status = (
+			SELECT ` + seatStatus("$1") + ` FROM events e WHERE e.id = attendees.event_id
+		) WHERE id = $3`
+		if _, err := tx.ExecContext(ctx, query, rsvp, time.Now().UTC(), attendee.ID); err != nil {
+			return nil, err
+		}
+		if err := loadAttendeeStatus(ctx, tx, attendee); err != nil {
+			return nil, err
+		}
+	default:
+		query := "UPDATE attendees SET rsvp = $1, status = NULL WHERE id = $2"
+		if _, err := tx.ExecContext(ctx, query, rsvp, attendee.ID); err != nil {
+			return nil, err
+		}
+		if _, err := promoteWaitlisted(ctx, tx, eventID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 	return attendee, nil
 }
 
-func (m *AttendeeModel) GetAttendeesByEvent(eventId int) ([]*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *AttendeeModel) GetByEventAndAttendee(ctx context.Context, eventID int, userID int) (*Attendee, error) {
+	ctx, span := startSpan(ctx, "AttendeeModel.GetByEventAndAttendee")
+	defer span.End()
+	ctx, cancel := m.Timeouts.read(ctx)
 	defer cancel()
 
-	query := "SELECT u.id, u.username, u.email FROM users u  JOIN attendees a ON u.id = a.user_id WHERE a.event_id = $1"
-	rows, err := m.DB.QueryContext(ctx, query, eventId)
+	query := "SELECT a.id, a.user_id, a.event_id, a.rsvp, COALESCE(a.status, ''), " + waitlistPosition + " FROM attendees a WHERE a.event_id = $1 AND a.user_id = $2"
+	row := m.DB.QueryRowContext(ctx, query, eventID, userID)
+	attendee := &Attendee{}
+	err := row.Scan(&attendee.ID, &attendee.UserID, &attendee.EventID, &attendee.RSVP, &attendee.Status, &attendee.WaitlistPosition)
+	if err != nil {
+		return nil, translate(err)
+	}
+	return attendee, nil
+}
+
+// attendeeSortColumns whitelists the columns attendees can be sorted by.
+var attendeeSortColumns = map[string]string{
+	"id":       "u.id",
+	"username": "u.username",
+}
+
+func (m *AttendeeModel) GetAttendeesByEvent(ctx context.Context, eventId int, page PageRequest) (*Page[*EventAttendee], error) {
+	ctx, span := startSpan(ctx, "AttendeeModel.GetAttendeesByEvent")
+	defer span.End()
+	ctx, cancel := m.Timeouts.read(ctx)
+	defer cancel()
+
+	k, err := newKeyset(page, attendeeSortColumns)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	var args queryArgs
+	conds := []string{"a.event_id = " + args.add(eventId)}
 
-	var users []*User
+	result := &Page[*EventAttendee]{Data: []*EventAttendee{}}
+	countQuery := "SELECT COUNT(*) FROM users u JOIN attendees a ON u.id = a.user_id" + whereClause(conds)
+	if err := m.DB.QueryRowContext(ctx, countQuery, args...).Scan(&result.Total); err != nil {
+		return nil, err
+	}
 
+	if cond := k.where(&args); cond != "" {
+		conds = append(conds, cond)
+	}
+	query := "SELECT u.id, u.username, u.email, a.rsvp, COALESCE(a.status, ''), " + waitlistPosition + ", " + k.sortKey() +
+		" FROM users u JOIN attendees a ON u.id = a.user_id" + whereClause(conds) + k.orderBy()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lastKey string
+	fetched := 0
 	for rows.Next() {
-		var user User
-		err := rows.Scan(&user.ID, &user.UserName, &user.Email)
+		fetched++
+		if fetched > k.limit {
+			break
+		}
+		var attendee EventAttendee
+		err := rows.Scan(&attendee.ID, &attendee.UserName, &attendee.Email, &attendee.RSVP, &attendee.Status, &attendee.WaitlistPosition, &lastKey)
 		if err != nil {
 			return nil, err
 		}
-		users = append(users, &user)
+		result.Data = append(result.Data, &attendee)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(result.Data) > 0 {
+		result.NextCursor = k.next(fetched, lastKey, result.Data[len(result.Data)-1].ID)
 	}
-	return users, nil
+	return result, nil
 }
 
-func (m *AttendeeModel) Delete(eventId int, userId int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// Delete removes a user from an event. If that frees a seat, the oldest
+// waitlisted attendee is promoted in the same transaction.
+func (m *AttendeeModel) Delete(ctx context.Context, eventId int, userId int) error {
+	ctx, span := startSpan(ctx, "AttendeeModel.Delete")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
 	defer cancel()
-	query := "DELETE FROM attendees WHERE event_id = $1, user_id = $2 "
-	_, err := m.DB.ExecContext(ctx, query, userId, eventId)
+
+	tx, err := begin(ctx, m.DB, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.Dialect.lockEvent(ctx, tx, eventId); err != nil {
+		return err
+	}
+	query := "DELETE FROM attendees WHERE event_id = $1 AND user_id = $2"
+	result, err := tx.ExecContext(ctx, query, eventId, userId)
 	if err != nil {
 		return err
 	}
-	return nil
+	if err := expectRow(result); err != nil {
+		return err
+	}
+	if _, err := promoteWaitlisted(ctx, tx, eventId); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (m *AttendeeModel) GetEventsByAttendee(attendeeId int) ([]*Event, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	query := "SELECT e.* FROM attendees a JOIN events e ON a.event_id = e.id WHERE a.user_id = $1"
-	rows, err := m.DB.QueryContext(ctx, query, attendeeId)
+// promoteWaitlisted moves waitlisted attendees of an event, oldest first,
+// into any free seats and returns how many were promoted.
+func promoteWaitlisted(ctx context.Context, tx DBTX, eventID int) (int64, error) {
+	var capacity sql.NullInt64
+	err := tx.QueryRowContext(ctx, "SELECT capacity FROM events WHERE id = $1", eventID).Scan(&capacity)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
+		return 0, err
+	}
+
+	var result sql.Result
+	if !capacity.Valid {
+		query := "UPDATE attendees SET status = 'registered' WHERE event_id = $1 AND status = 'waitlisted'"
+		result, err = tx.ExecContext(ctx, query, eventID)
+	} else {
+		var registered int64
+		query := "SELECT COUNT(*) FROM attendees WHERE event_id = $1 AND status = 'registered'"
+		if err := tx.QueryRowContext(ctx, query, eventID).Scan(&registered); err != nil {
+			return 0, err
 		}
-		return nil, err
+		free := capacity.Int64 - registered
+		if free <= 0 {
+			return 0, nil
+		}
+		query = `UPDATE attendees SET status = 'registered' WHERE id IN (
+			SELECT id FROM attendees WHERE event_id = $1 AND status = 'waitlisted'
+			ORDER BY created_at, id LIMIT $2
+		)`
+		result, err = tx.ExecContext(ctx, query, eventID, free)
 	}
-	defer rows.Close()
-	var events []*Event
-	for rows.Next() {
-		var event Event
-		err := rows.Scan(&event.ID, &event.OwnerId, &event.Description, &event.Date, &event.Location)
-		if err != nil {
-			return nil, err
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (m *AttendeeModel) GetEventsByAttendee(ctx context.Context, attendeeId int, filter EventFilter, page PageRequest) (*Page[*Event], error) {
+	ctx, span := startSpan(ctx, "AttendeeModel.GetEventsByAttendee")
+	defer span.End()
+	ctx, cancel := m.Timeouts.read(ctx)
+	defer cancel()
+
+	var args queryArgs
+	conds := attendeeConditions(attendeeId, filter, &args)
+	return listEvents(ctx, m.DB, m.Dialect, " JOIN attendees a ON a.event_id = e.id", conds, args, filter, page)
+}
+
+// GetOccurrencesByAttendee expands the events of an attendee into their
+// occurrences between filter.From and filter.To, like
+// EventModel.ListOccurrences.
+func (m *AttendeeModel) GetOccurrencesByAttendee(ctx context.Context, attendeeId int, filter EventFilter, page PageRequest) (*Page[*Occurrence], error) {
+	ctx, span := startSpan(ctx, "AttendeeModel.GetOccurrencesByAttendee")
+	defer span.End()
+	ctx, cancel := m.Timeouts.read(ctx)
+	defer cancel()
+
+	var args queryArgs
+	conds := attendeeConditions(attendeeId, filter, &args)
+	return listOccurrences(ctx, m.DB, m.Dialect, " JOIN attendees a ON a.event_id = e.id", conds, args, filter, page)
+}
+
+// attendeeConditions restricts an event listing joined with attendees as a to
+// the events of one attendee.
+func attendeeConditions(attendeeId int, filter EventFilter, args *queryArgs) []string {
+	conds := []string{"a.user_id = " + args.add(attendeeId)}
+	if len(filter.RSVP) > 0 {
+		placeholders := make([]string, len(filter.RSVP))
+		for i, rsvp := range filter.RSVP {
+			placeholders[i] = args.add(rsvp)
 		}
-		events = append(events, &event)
+		conds = append(conds, "a.rsvp IN ("+strings.Join(placeholders, ", ")+")")
 	}
-	return events, nil
+	return conds
 }
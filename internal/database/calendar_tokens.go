@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+type CalendarTokenModel struct {
+	DB       DBTX
+	Timeouts Timeouts
+}
+
+// Set stores the hash of a user's calendar feed token, replacing the previous
+// one so that old feed URLs stop working.
+func (m *CalendarTokenModel) Set(ctx context.Context, userID int, tokenHash string) error {
+	ctx, span := startSpan(ctx, "CalendarTokenModel.Set")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
+	defer cancel()
+
+	query := `INSERT INTO calendar_tokens (user_id, token_hash, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET token_hash = excluded.token_hash, created_at = excluded.created_at`
+	_, err := m.DB.ExecContext(ctx, query, userID, tokenHash, time.Now().UTC())
+	return translate(err)
+}
+
+// GetUserID returns the user a calendar feed token belongs to.
+func (m *CalendarTokenModel) GetUserID(ctx context.Context, tokenHash string) (int, error) {
+	ctx, span := startSpan(ctx, "CalendarTokenModel.GetUserID")
+	defer span.End()
+	ctx, cancel := m.Timeouts.read(ctx)
+	defer cancel()
+
+	var userID int
+	query := "SELECT user_id FROM calendar_tokens WHERE token_hash = $1"
+	if err := m.DB.QueryRowContext(ctx, query, tokenHash).Scan(&userID); err != nil {
+		return 0, translate(err)
+	}
+	return userID, nil
+}
+
+// Delete removes a user's calendar feed token.
+func (m *CalendarTokenModel) Delete(ctx context.Context, userID int) error {
+	ctx, span := startSpan(ctx, "CalendarTokenModel.Delete")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "DELETE FROM calendar_tokens WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
@@ -0,0 +1,982 @@
+// Package conformance checks that an implementation of database.Models
+// behaves like the SQL models. Run it from a test with a function returning
+// fresh, empty models:
+//
+//	func TestMemory(t *testing.T) {
+//		conformance.Run(t, conformance.Memory)
+//	}
+package conformance
+
+import (
+	"context"
+	"errors"
+	"go-rest/internal/database"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Run runs the suite. newModels is called once per subtest and must return
+// models backed by an empty store.
+func Run(t *testing.T, newModels func(t *testing.T) database.Models) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, m database.Models)
+	}{
+		{"Users", testUsers},
+		{"Events", testEvents},
+		{"EventListing", testEventListing},
+		{"Attendees", testAttendees},
+		{"RSVP", testRSVP},
+		{"AttendeeListing", testAttendeeListing},
+		{"Occurrences", testOccurrences},
+		{"Search", testSearch},
+		{"Sessions", testSessions},
+		{"DeleteEndedSessions", testDeleteEndedSessions},
+		{"RefreshTokens", testRefreshTokens},
+		{"CalendarTokens", testCalendarTokens},
+		{"Cancellation", testCancellation},
+		{"Transactions", testTransactions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newModels(t))
+		})
+	}
+}
+
+var berlin = mustLoadLocation("Europe/Berlin")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+func createUser(t *testing.T, m database.Models, name string) *database.User {
+	t.Helper()
+	user := &database.User{UserName: name, Email: name + "@example.com", Password: "hash"}
+	if err := m.Users.Insert(t.Context(), user); err != nil {
+		t.Fatalf("insert user %s: %v", name, err)
+	}
+	return user
+}
+
+func createEvent(t *testing.T, m database.Models, owner *database.User, name string, start time.Time) *database.Event {
+	t.Helper()
+	event := &database.Event{
+		OwnerId:     owner.ID,
+		Name:        name,
+		Description: "An event called " + name,
+		StartsAt:    start,
+		EndsAt:      start.Add(2 * time.Hour),
+		Location:    "Town Hall",
+	}
+	if err := m.Events.Insert(t.Context(), event); err != nil {
+		t.Fatalf("insert event %s: %v", name, err)
+	}
+	return event
+}
+
+func date(y int, mo time.Month, d int) time.Time {
+	return time.Date(y, mo, d, 18, 0, 0, 0, time.UTC)
+}
+
+func capacity(n int) *int { return &n }
+
+func eventNames(events []*database.Event) string {
+	names := make([]string, len(events))
+	for i, e := range events {
+		names[i] = e.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func pageNames(p *database.Page[*database.Event]) string { return eventNames(p.Data) }
+
+func testUsers(t *testing.T, m database.Models) {
+	alice := createUser(t, m, "alice")
+	if alice.ID == 0 || alice.Role != database.RoleOrganizer {
+		t.Fatalf("inserted user = %+v, want an id and the organizer role", alice)
+	}
+	bob := createUser(t, m, "bob")
+	if bob.ID == alice.ID {
+		t.Fatalf("both users got id %d", bob.ID)
+	}
+
+	got, err := m.Users.GetUser(t.Context(), alice.ID)
+	if err != nil || *got != *alice {
+		t.Fatalf("GetUser = %+v, %v; want %+v", got, err, alice)
+	}
+	got, err = m.Users.GetByEmail(t.Context(), "bob@example.com")
+	if err != nil || got.ID != bob.ID {
+		t.Fatalf("GetByEmail = %+v, %v; want user %d", got, err, bob.ID)
+	}
+	if _, err := m.Users.GetUser(t.Context(), 9999); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetUser of a missing user: err = %v, want ErrNotFound", err)
+	}
+	if _, err := m.Users.GetByEmail(t.Context(), "nobody@example.com"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetByEmail of a missing user: err = %v, want ErrNotFound", err)
+	}
+
+	duplicate := &database.User{UserName: "alice2", Email: "alice@example.com", Password: "hash"}
+	var dbErr *database.Error
+	if err := m.Users.Insert(t.Context(), duplicate); !errors.As(err, &dbErr) || dbErr.Kind != database.ErrDuplicate || dbErr.Field != "email" {
+		t.Errorf("inserting a duplicate email: err = %v, want ErrDuplicate of email", err)
+	}
+	duplicate = &database.User{UserName: "alice", Email: "alice2@example.com", Password: "hash"}
+	if err := m.Users.Insert(t.Context(), duplicate); !errors.As(err, &dbErr) || dbErr.Kind != database.ErrDuplicate || dbErr.Field != "username" {
+		t.Errorf("inserting a duplicate username: err = %v, want ErrDuplicate of username", err)
+	}
+
+	if err := m.Users.UpdateRole(t.Context(), bob.ID, database.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Users.GetUser(t.Context(), bob.ID); got.Role != database.RoleAdmin {
+		t.Errorf("role after UpdateRole = %q, want %q", got.Role, database.RoleAdmin)
+	}
+	if err := m.Users.UpdateRole(t.Context(), 9999, database.RoleAdmin); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("UpdateRole of a missing user: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testEvents(t *testing.T, m database.Models) {
+	owner := createUser(t, m, "owner")
+	start := time.Date(2030, 3, 10, 19, 30, 15, 500, berlin)
+	event := createEvent(t, m, owner, "Meetup", start)
+	if event.ID == 0 || event.Timezone != "UTC" {
+		t.Fatalf("inserted event = %+v, want an id and the UTC timezone", event)
+	}
+
+	got, err := m.Events.Get(t.Context(), event.ID)
+	if err != nil || got == nil {
+		t.Fatalf("Get = %v, %v", got, err)
+	}
+	if want := start.Truncate(time.Second); !got.StartsAt.Equal(want) || !got.EndsAt.Equal(want.Add(2*time.Hour)) {
+		t.Errorf("times = %v - %v, want %v - %v", got.StartsAt, got.EndsAt, want, want.Add(2*time.Hour))
+	}
+	if got.Name != "Meetup" || got.OwnerId != owner.ID || got.Sequence != 0 || got.DeletedAt != nil {
+		t.Errorf("Get = %+v", got)
+	}
+	if got, err := m.Events.Get(t.Context(), 9999); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Get of a missing event = %v, %v; want ErrNotFound", got, err)
+	}
+
+	got.Name, got.Timezone, got.Capacity = "Renamed", "Europe/Berlin", capacity(10)
+	got.RRule, got.ExDates = "FREQ=WEEKLY", database.DateList{"2030-03-17"}
+	if err := m.Events.Update(t.Context(), got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Sequence != 1 {
+		t.Errorf("sequence after Update = %d, want 1", got.Sequence)
+	}
+	updated, _ := m.Events.Get(t.Context(), event.ID)
+	if updated.Name != "Renamed" || updated.Timezone != "Europe/Berlin" || *updated.Capacity != 10 ||
+		updated.RRule != "FREQ=WEEKLY" || len(updated.ExDates) != 1 || updated.Sequence != 1 {
+		t.Errorf("event after Update = %+v", updated)
+	}
+	if err := m.Events.Update(t.Context(), &database.Event{ID: 9999, StartsAt: start, EndsAt: start}); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Update of a missing event: err = %v, want ErrNotFound", err)
+	}
+
+	other := createEvent(t, m, owner, "Other", start)
+	if err := m.Events.Delete(t.Context(), event.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := m.Events.Get(t.Context(), event.ID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Get of a deleted event = %v, %v; want ErrNotFound", got, err)
+	}
+	deleted, err := m.Events.GetWithDeleted(t.Context(), event.ID)
+	if err != nil || deleted == nil || deleted.DeletedAt == nil || deleted.Sequence != 2 {
+		t.Errorf("GetWithDeleted = %+v, %v; want the event marked deleted at sequence 2", deleted, err)
+	}
+	if err := m.Events.Update(t.Context(), deleted); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Update of a deleted event: err = %v, want ErrNotFound", err)
+	}
+	if err := m.Events.Delete(t.Context(), 9999); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Delete of a missing event: err = %v, want ErrNotFound", err)
+	}
+	if err := m.Events.Delete(t.Context(), event.ID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("second Delete: err = %v, want ErrNotFound", err)
+	}
+
+	all, err := m.Events.GetAll(t.Context())
+	if err != nil || len(all) != 1 || all[0].ID != other.ID {
+		t.Errorf("GetAll = %s, %v; want only the event that was not deleted", eventNames(all), err)
+	}
+}
+
+func testEventListing(t *testing.T, m database.Models) {
+	alice := createUser(t, m, "alice")
+	bob := createUser(t, m, "bob")
+	createEvent(t, m, alice, "Charlie", date(2030, 1, 3))
+	a := createEvent(t, m, alice, "Alpha", date(2030, 1, 2))
+	b := createEvent(t, m, bob, "Bravo", date(2030, 1, 1))
+	d := createEvent(t, m, bob, "Delta", date(2030, 1, 4))
+	d.Location = "Harbour"
+	if err := m.Events.Update(t.Context(), d); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(filter database.EventFilter, page database.PageRequest) *database.Page[*database.Event] {
+		t.Helper()
+		p, err := m.Events.List(t.Context(), filter, page)
+		if err != nil {
+			t.Fatalf("List(%+v, %+v): %v", filter, page, err)
+		}
+		return p
+	}
+
+	tests := []struct {
+		filter database.EventFilter
+		page   database.PageRequest
+		want   string
+	}{
+		{database.EventFilter{}, database.PageRequest{}, "Charlie,Alpha,Bravo,Delta"},
+		{database.EventFilter{}, database.PageRequest{Sort: "name"}, "Alpha,Bravo,Charlie,Delta"},
+		{database.EventFilter{}, database.PageRequest{Sort: "starts_at", Desc: true}, "Delta,Charlie,Alpha,Bravo"},
+		{database.EventFilter{}, database.PageRequest{Sort: "date"}, "Bravo,Alpha,Charlie,Delta"},
+		{database.EventFilter{From: "2030-01-02", To: "2030-01-03"}, database.PageRequest{}, "Charlie,Alpha"},
+		{database.EventFilter{Location: "HARB"}, database.PageRequest{}, "Delta"},
+		{database.EventFilter{OwnerID: bob.ID}, database.PageRequest{}, "Bravo,Delta"},
+	}
+	for _, tt := range tests {
+		p := list(tt.filter, tt.page)
+		if got := eventNames(p.Data); got != tt.want {
+			t.Errorf("List(%+v, %+v) = %s, want %s", tt.filter, tt.page, got, tt.want)
+		}
+	}
+
+	// Walking the pages visits every event once, even when the sort key
+	// is shared by several of them.
+	b.Name, d.Name = "Same", "Same"
+	for _, e := range []*database.Event{b, d} {
+		if err := m.Events.Update(t.Context(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var walked []*database.Event
+	page := database.PageRequest{Limit: 1, Sort: "name", Desc: true}
+	for {
+		p := list(database.EventFilter{}, page)
+		if p.Total != 4 {
+			t.Fatalf("Total = %d, want 4", p.Total)
+		}
+		walked = append(walked, p.Data...)
+		if p.NextCursor == "" {
+			break
+		}
+		page.Cursor = p.NextCursor
+	}
+	if got := eventNames(walked); got != "Same,Same,Charlie,Alpha" || walked[0].ID != d.ID {
+		t.Errorf("walking the pages gave %s, want Same,Same,Charlie,Alpha with the newer event first", got)
+	}
+
+	if _, err := m.Events.List(t.Context(), database.EventFilter{}, database.PageRequest{Sort: "location"}); !errors.Is(err, database.ErrInvalidSort) {
+		t.Errorf("sorting by location: err = %v, want ErrInvalidSort", err)
+	}
+	if _, err := m.Events.List(t.Context(), database.EventFilter{}, database.PageRequest{Cursor: "garbage"}); !errors.Is(err, database.ErrInvalidCursor) {
+		t.Errorf("garbage cursor: err = %v, want ErrInvalidCursor", err)
+	}
+	first := list(database.EventFilter{}, database.PageRequest{Limit: 1})
+	if _, err := m.Events.List(t.Context(), database.EventFilter{}, database.PageRequest{Sort: "name", Cursor: first.NextCursor}); !errors.Is(err, database.ErrInvalidCursor) {
+		t.Errorf("cursor for another sort: err = %v, want ErrInvalidCursor", err)
+	}
+
+	deletedAt := time.Now().Add(-time.Minute)
+	if err := m.Events.Delete(t.Context(), a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := eventNames(list(database.EventFilter{}, database.PageRequest{}).Data); got != "Charlie,Same,Same" {
+		t.Errorf("List after Delete = %s, want Charlie,Same,Same", got)
+	}
+	withDeleted := list(database.EventFilter{DeletedSince: deletedAt}, database.PageRequest{}).Data
+	if got := eventNames(withDeleted); got != "Charlie,Alpha,Same,Same" || withDeleted[1].DeletedAt == nil {
+		t.Errorf("List with DeletedSince = %s, want Charlie,Alpha,Same,Same with Alpha marked deleted", got)
+	}
+	if got := list(database.EventFilter{DeletedSince: time.Now().Add(time.Hour)}, database.PageRequest{}); pageNames(got) != "Charlie,Same,Same" {
+		t.Errorf("List with a later DeletedSince = %s, want Charlie,Same,Same", pageNames(got))
+	}
+}
+
+func testAttendees(t *testing.T, m database.Models) {
+	owner := createUser(t, m, "owner")
+	users := []*database.User{createUser(t, m, "u1"), createUser(t, m, "u2"), createUser(t, m, "u3"), createUser(t, m, "u4")}
+	event := createEvent(t, m, owner, "Workshop", date(2030, 5, 1))
+	event.Capacity = capacity(1)
+	if err := m.Events.Update(t.Context(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	register := func(u *database.User) *database.Attendee {
+		t.Helper()
+		a, err := m.Attendees.Insert(t.Context(), &database.Attendee{EventID: event.ID, UserID: u.ID})
+		if err != nil {
+			t.Fatalf("register %s: %v", u.UserName, err)
+		}
+		return a
+	}
+	position := func(a *database.Attendee) int {
+		if a.WaitlistPosition == nil {
+			return 0
+		}
+		return *a.WaitlistPosition
+	}
+
+	first := register(users[0])
+	if first.ID == 0 || first.RSVP != database.RSVPGoing || first.Status != database.AttendeeRegistered || first.WaitlistPosition != nil {
+		t.Fatalf("first registration = %+v, want a registered seat", first)
+	}
+	second, third := register(users[1]), register(users[2])
+	if second.Status != database.AttendeeWaitlisted || position(second) != 1 || position(third) != 2 {
+		t.Fatalf("registrations beyond capacity = %+v, %+v; want waitlist positions 1 and 2", second, third)
+	}
+
+	if err := m.Attendees.Delete(t.Context(), event.ID, users[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.Attendees.GetByEventAndAttendee(t.Context(), event.ID, users[1].ID)
+	if err != nil || got.Status != database.AttendeeRegistered || got.WaitlistPosition != nil {
+		t.Errorf("after the seat was freed the next in line is %+v, %v; want registered", got, err)
+	}
+	if got, _ := m.Attendees.GetByEventAndAttendee(t.Context(), event.ID, users[2].ID); position(got) != 1 {
+		t.Errorf("waitlist position after a promotion = %d, want 1", position(got))
+	}
+	if got, err := m.Attendees.GetByEventAndAttendee(t.Context(), event.ID, users[0].ID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetByEventAndAttendee of a removed attendee = %v, %v; want ErrNotFound", got, err)
+	}
+	if err := m.Attendees.Delete(t.Context(), event.ID, users[0].ID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Delete of a missing attendee: err = %v, want ErrNotFound", err)
+	}
+
+	// Raising the capacity promotes the rest of the waitlist.
+	register(users[3])
+	event.Capacity = capacity(3)
+	if err := m.Events.Update(t.Context(), event); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range users[1:] {
+		if got, _ := m.Attendees.GetByEventAndAttendee(t.Context(), event.ID, u.ID); got.Status != database.AttendeeRegistered {
+			t.Errorf("%s after raising the capacity = %+v, want registered", u.UserName, got)
+		}
+	}
+
+	var dbErr *database.Error
+	if _, err := m.Attendees.Insert(t.Context(), &database.Attendee{EventID: event.ID, UserID: users[1].ID}); !errors.As(err, &dbErr) || dbErr.Kind != database.ErrDuplicate || dbErr.Field != "event_id" {
+		t.Errorf("registering twice: err = %v, want ErrDuplicate of event_id", err)
+	}
+	if _, err := m.Attendees.Insert(t.Context(), &database.Attendee{EventID: 9999, UserID: users[0].ID}); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("registering for a missing event: err = %v, want ErrNotFound", err)
+	}
+	if err := m.Events.Delete(t.Context(), event.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Attendees.Insert(t.Context(), &database.Attendee{EventID: event.ID, UserID: users[0].ID}); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("registering for a deleted event: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testRSVP(t *testing.T, m database.Models) {
+	owner := createUser(t, m, "owner")
+	alice, bob, carol := createUser(t, m, "alice"), createUser(t, m, "bob"), createUser(t, m, "carol")
+	event := createEvent(t, m, owner, "Dinner", date(2030, 6, 1))
+	event.Capacity = capacity(1)
+	if err := m.Events.Update(t.Context(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	set := func(u *database.User, rsvp string) *database.Attendee {
+		t.Helper()
+		a, err := m.Attendees.SetRSVP(t.Context(), event.ID, u.ID, rsvp)
+		if err != nil {
+			t.Fatalf("SetRSVP(%s, %s): %v", u.UserName, rsvp, err)
+		}
+		return a
+	}
+
+	if a := set(alice, database.RSVPMaybe); a.ID == 0 || a.RSVP != database.RSVPMaybe || a.Status != "" {
+		t.Errorf("maybe = %+v, want an attendee without a seat", a)
+	}
+	if a := set(bob, database.RSVPGoing); a.Status != database.AttendeeRegistered {
+		t.Errorf("bob going = %+v, want registered", a)
+	}
+	if a := set(carol, database.RSVPGoing); a.Status != database.AttendeeWaitlisted || *a.WaitlistPosition != 1 {
+		t.Errorf("carol going = %+v, want waitlisted first", a)
+	}
+	if a := set(alice, database.RSVPGoing); a.Status != database.AttendeeWaitlisted || *a.WaitlistPosition != 2 {
+		t.Errorf("alice going = %+v, want waitlisted behind carol", a)
+	}
+	if a := set(alice, database.RSVPGoing); a.Status != database.AttendeeWaitlisted || *a.WaitlistPosition != 2 {
+		t.Errorf("repeating an answer = %+v, want it unchanged", a)
+	}
+
+	if a := set(bob, database.RSVPDeclined); a.RSVP != database.RSVPDeclined || a.Status != "" {
+		t.Errorf("bob declined = %+v, want no seat", a)
+	}
+	if got, _ := m.Attendees.GetByEventAndAttendee(t.Context(), event.ID, carol.ID); got.Status != database.AttendeeRegistered {
+		t.Errorf("carol after bob declined = %+v, want registered", got)
+	}
+	if got, _ := m.Attendees.GetByEventAndAttendee(t.Context(), event.ID, alice.ID); *got.WaitlistPosition != 1 {
+		t.Errorf("alice after bob declined = %+v, want first on the waitlist", got)
+	}
+
+	if _, err := m.Attendees.SetRSVP(t.Context(), 9999, alice.ID, database.RSVPGoing); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("SetRSVP on a missing event: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testAttendeeListing(t *testing.T, m database.Models) {
+	owner := createUser(t, m, "owner")
+	zoe, adam := createUser(t, m, "zoe"), createUser(t, m, "adam")
+	first := createEvent(t, m, owner, "First", date(2030, 2, 1))
+	second := createEvent(t, m, owner, "Second", date(2030, 2, 2))
+	third := createEvent(t, m, owner, "Third", date(2030, 2, 3))
+
+	for _, e := range []*database.Event{first, second, third} {
+		if _, err := m.Attendees.Insert(t.Context(), &database.Attendee{EventID: e.ID, UserID: zoe.ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.Attendees.SetRSVP(t.Context(), second.ID, zoe.ID, database.RSVPMaybe); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Attendees.Insert(t.Context(), &database.Attendee{EventID: first.ID, UserID: adam.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := m.Attendees.GetAttendeesByEvent(t.Context(), first.ID, database.PageRequest{Sort: "username"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Total != 2 || len(p.Data) != 2 || p.Data[0].ID != adam.ID || p.Data[0].UserName != "adam" || p.Data[1].Email != "zoe@example.com" {
+		t.Errorf("GetAttendeesByEvent = %+v, want adam then zoe", p)
+	}
+	p, err = m.Attendees.GetAttendeesByEvent(t.Context(), first.ID, database.PageRequest{Limit: 1})
+	if err != nil || len(p.Data) != 1 || p.Data[0].ID != zoe.ID || p.NextCursor == "" {
+		t.Fatalf("first page of attendees = %+v, %v", p, err)
+	}
+	p, err = m.Attendees.GetAttendeesByEvent(t.Context(), first.ID, database.PageRequest{Limit: 1, Cursor: p.NextCursor})
+	if err != nil || len(p.Data) != 1 || p.Data[0].ID != adam.ID || p.NextCursor != "" {
+		t.Errorf("second page of attendees = %+v, %v", p, err)
+	}
+
+	events, err := m.Attendees.GetEventsByAttendee(t.Context(), zoe.ID, database.EventFilter{}, database.PageRequest{})
+	if err != nil || pageNames(events) != "First,Second,Third" {
+		t.Errorf("GetEventsByAttendee = %s, %v", pageNames(events), err)
+	}
+	events, err = m.Attendees.GetEventsByAttendee(t.Context(), zoe.ID, database.EventFilter{RSVP: []string{database.RSVPGoing}, From: "2030-02-02"}, database.PageRequest{Sort: "starts_at", Desc: true})
+	if err != nil || pageNames(events) != "Third" {
+		t.Errorf("GetEventsByAttendee filtered = %s, %v; want Third", pageNames(events), err)
+	}
+	if err := m.Events.Delete(t.Context(), third.ID); err != nil {
+		t.Fatal(err)
+	}
+	events, err = m.Attendees.GetEventsByAttendee(t.Context(), zoe.ID, database.EventFilter{}, database.PageRequest{})
+	if err != nil || pageNames(events) != "First,Second" || events.Total != 2 {
+		t.Errorf("GetEventsByAttendee after a delete = %s, %v; want First,Second", pageNames(events), err)
+	}
+}
+
+func testOccurrences(t *testing.T, m database.Models) {
+	owner := createUser(t, m, "owner")
+	attendee := createUser(t, m, "attendee")
+	// Weekly on Tuesdays at 19:00 Berlin time, across the DST change.
+	series := createEvent(t, m, owner, "Choir", time.Date(2030, 3, 19, 19, 0, 0, 0, berlin))
+	series.Timezone, series.RRule, series.ExDates = "Europe/Berlin", "FREQ=WEEKLY;COUNT=6", database.DateList{"2030-04-09"}
+	if err := m.Events.Update(t.Context(), series); err != nil {
+		t.Fatal(err)
+	}
+	oneOff := createEvent(t, m, owner, "Concert", date(2030, 4, 3))
+	createEvent(t, m, owner, "Later", date(2030, 6, 1))
+	if _, err := m.Attendees.Insert(t.Context(), &database.Attendee{EventID: series.ID, UserID: attendee.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	moved := time.Date(2030, 4, 17, 20, 0, 0, 0, berlin)
+	for _, o := range []*database.OccurrenceOverride{
+		{EventID: series.ID, OriginalDate: "2030-03-26", Cancelled: true},
+		{EventID: series.ID, OriginalDate: "2030-04-16", StartsAt: &moved},
+		{EventID: series.ID, OriginalDate: "2030-04-02", Name: ptr("Removed again")},
+		{EventID: series.ID, OriginalDate: "2030-04-02"},
+	} {
+		if err := m.Events.SetOverride(t.Context(), o); err != nil {
+			t.Fatalf("SetOverride(%+v): %v", o, err)
+		}
+	}
+	if e, _ := m.Events.Get(t.Context(), series.ID); e.Sequence != 5 {
+		t.Errorf("sequence after four overrides = %d, want 5", e.Sequence)
+	}
+
+	overrides, err := m.Events.GetOverrides(t.Context(), []int{series.ID, oneOff.ID})
+	if err != nil || len(overrides) != 1 || len(overrides[series.ID]) != 2 {
+		t.Fatalf("GetOverrides = %v, %v; want the cancellation and the move", overrides, err)
+	}
+	if o := overrides[series.ID]["2030-04-16"]; o == nil || !o.StartsAt.Equal(moved) || o.Name != nil {
+		t.Errorf("moved override = %+v", o)
+	}
+
+	filter := database.EventFilter{From: "2030-03-01", To: "2030-04-30"}
+	p, err := m.Events.ListOccurrences(t.Context(), filter, database.PageRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, o := range p.Data {
+		s := o.Name + "@" + o.StartsAt.UTC().Format("01-02T15:04")
+		if o.Cancelled {
+			s += "(cancelled)"
+		}
+		got = append(got, s)
+	}
+	want := "Choir@03-19T18:00,Choir@03-26T18:00(cancelled),Choir@04-02T17:00,Concert@04-03T18:00,Choir@04-17T18:00,Choir@04-23T17:00"
+	if strings.Join(got, ",") != want || p.Total != 6 {
+		t.Errorf("ListOccurrences = %s (total %d)\nwant %s", strings.Join(got, ","), p.Total, want)
+	}
+	if p.Data[4].OriginalDate != "2030-04-16" || !p.Data[4].Overridden {
+		t.Errorf("moved occurrence = %+v, want original date 2030-04-16", p.Data[4])
+	}
+
+	page := database.PageRequest{Limit: 4}
+	first, err := m.Events.ListOccurrences(t.Context(), filter, page)
+	if err != nil || len(first.Data) != 4 || first.NextCursor == "" {
+		t.Fatalf("first page of occurrences = %+v, %v", first, err)
+	}
+	page.Cursor = first.NextCursor
+	rest, err := m.Events.ListOccurrences(t.Context(), filter, page)
+	if err != nil || len(rest.Data) != 2 || rest.NextCursor != "" || rest.Data[0].Name != "Choir" {
+		t.Errorf("second page of occurrences = %+v, %v", rest, err)
+	}
+
+	mine, err := m.Attendees.GetOccurrencesByAttendee(t.Context(), attendee.ID, database.EventFilter{From: "2030-04-01", To: "2030-04-30"}, database.PageRequest{})
+	if err != nil || mine.Total != 3 {
+		t.Errorf("GetOccurrencesByAttendee = %+v, %v; want the 3 April choir rehearsals", mine, err)
+	}
+
+	if _, err := m.Events.ListOccurrences(t.Context(), database.EventFilter{To: "2030-04-30"}, database.PageRequest{}); err == nil {
+		t.Errorf("ListOccurrences without a start date succeeded")
+	}
+	if _, err := m.Events.ListOccurrences(t.Context(), filter, database.PageRequest{Sort: "name"}); !errors.Is(err, database.ErrInvalidSort) {
+		t.Errorf("ListOccurrences sorted by name: err = %v, want ErrInvalidSort", err)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func testSearch(t *testing.T, m database.Models) {
+	owner := createUser(t, m, "owner")
+	jazz := createEvent(t, m, owner, "Jazz Night", date(2030, 7, 1))
+	jazz.Description = "Live music at the harbour"
+	if err := m.Events.Update(t.Context(), jazz); err != nil {
+		t.Fatal(err)
+	}
+	quiz := createEvent(t, m, owner, "Pub Quiz", date(2030, 7, 2))
+	quiz.Description = "Questions about jazz and rock music"
+	if err := m.Events.Update(t.Context(), quiz); err != nil {
+		t.Fatal(err)
+	}
+	gone := createEvent(t, m, owner, "Jazz Brunch", date(2030, 7, 3))
+	if err := m.Events.Delete(t.Context(), gone.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(q string) []*database.EventSearchResult {
+		t.Helper()
+		results, err := m.Events.Search(t.Context(), q, 0)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", q, err)
+		}
+		return results
+	}
+	names := func(results []*database.EventSearchResult) string {
+		names := make([]string, len(results))
+		for i, r := range results {
+			names[i] = r.Name
+		}
+		return strings.Join(names, ",")
+	}
+
+	tests := []struct{ q, want string }{
+		{"jazz", "Jazz Night,Pub Quiz"},
+		{"JAZZ music", "Jazz Night,Pub Quiz"},
+		{"jaz*", "Jazz Night,Pub Quiz"},
+		{`"rock music"`, "Pub Quiz"},
+		{`"music rock"`, ""},
+		{"harbour OR questions", "Jazz Night,Pub Quiz"},
+		{"jazz rock", "Pub Quiz"},
+		{"brunch", ""},
+		{"harbour town", "Jazz Night"},
+	}
+	for _, tt := range tests {
+		got := names(search(tt.q))
+		if tt.q == "harbour OR questions" {
+			got = sortedCSV(got)
+		}
+		if got != tt.want {
+			t.Errorf("Search(%q) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+
+	results := search("jazz")
+	if results[0].Score <= results[1].Score {
+		t.Errorf("a name match scored %v, no higher than a description match with %v", results[0].Score, results[1].Score)
+	}
+	if results[0].NameHighlight != "<mark>Jazz</mark> Night" || !strings.Contains(results[1].Snippet, "<mark>jazz</mark>") {
+		t.Errorf("highlights = %q, %q", results[0].NameHighlight, results[1].Snippet)
+	}
+
+	// Highlights are HTML, so the event's text is escaped in them.
+	createEvent(t, m, owner, `<script>alert("xss")</script> & Blues`, date(2030, 7, 4))
+	results = search("blues")
+	if len(results) != 1 || results[0].NameHighlight != `&lt;script&gt;alert(&#34;xss&#34;)&lt;/script&gt; &amp; <mark>Blues</mark>` {
+		t.Errorf("highlight of markup = %q", results[0].NameHighlight)
+	}
+	results = search("script")
+	if len(results) != 1 || strings.Contains(results[0].Snippet, "<script") || !strings.Contains(results[0].Snippet, "<mark>script</mark>&gt;") {
+		t.Errorf("snippet of markup = %q", results[0].Snippet)
+	}
+
+	if got, _ := m.Events.Search(t.Context(), "jazz", 1); len(got) != 1 {
+		t.Errorf("Search with limit 1 returned %d results", len(got))
+	}
+	if _, err := m.Events.Search(t.Context(), `"" * OR`, 0); !errors.Is(err, database.ErrInvalidSearch) {
+		t.Errorf("Search without words: err = %v, want ErrInvalidSearch", err)
+	}
+}
+
+func sortedCSV(s string) string {
+	parts := strings.Split(s, ",")
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func testSessions(t *testing.T, m database.Models) {
+	user := createUser(t, m, "user")
+	expires := time.Now().Add(time.Hour).UTC()
+	first := &database.Session{UserID: user.ID, ExpiresAt: expires}
+	second := &database.Session{UserID: user.ID, ExpiresAt: expires}
+	for _, s := range []*database.Session{first, second} {
+		if err := m.Sessions.Insert(t.Context(), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first.ID == 0 || first.ID == second.ID || first.CreatedAt.IsZero() {
+		t.Fatalf("inserted sessions = %+v, %+v", first, second)
+	}
+
+	got, err := m.Sessions.Get(t.Context(), first.ID)
+	if err != nil || got == nil || !got.Active() || got.UserID != user.ID || !got.ExpiresAt.Equal(expires) {
+		t.Fatalf("Get = %+v, %v; want an active session", got, err)
+	}
+	if got, err := m.Sessions.Get(t.Context(), 9999); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Get of a missing session = %v, %v; want ErrNotFound", got, err)
+	}
+
+	if err := m.Sessions.Revoke(t.Context(), first.ID); err != nil {
+		t.Fatal(err)
+	}
+	revoked, _ := m.Sessions.Get(t.Context(), first.ID)
+	if revoked.RevokedAt == nil || revoked.Active() {
+		t.Errorf("revoked session = %+v", revoked)
+	}
+	if got, _ := m.Sessions.Get(t.Context(), second.ID); !got.Active() {
+		t.Errorf("revoking one session revoked another")
+	}
+	if err := m.Sessions.Revoke(t.Context(), first.ID); err != nil {
+		t.Errorf("revoking a revoked session: %v", err)
+	}
+	if got, _ := m.Sessions.Get(t.Context(), first.ID); !got.RevokedAt.Equal(*revoked.RevokedAt) {
+		t.Errorf("revoking again moved RevokedAt from %v to %v", revoked.RevokedAt, got.RevokedAt)
+	}
+	if err := m.Sessions.Revoke(t.Context(), 9999); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Revoke of a missing session: err = %v, want ErrNotFound", err)
+	}
+
+	if err := m.Sessions.RevokeAllForUser(t.Context(), user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Sessions.Get(t.Context(), second.ID); got.Active() {
+		t.Errorf("session still active after RevokeAllForUser")
+	}
+	if got, _ := m.Sessions.Get(t.Context(), first.ID); !got.RevokedAt.Equal(*revoked.RevokedAt) {
+		t.Errorf("RevokeAllForUser changed when an already revoked session was revoked")
+	}
+}
+
+func testDeleteEndedSessions(t *testing.T, m database.Models) {
+	user := createUser(t, m, "user")
+	now := time.Now()
+	expired := &database.Session{UserID: user.ID, ExpiresAt: now.Add(-2 * time.Hour).UTC()}
+	revoked := &database.Session{UserID: user.ID, ExpiresAt: now.Add(time.Hour).UTC()}
+	active := &database.Session{UserID: user.ID, ExpiresAt: now.Add(time.Hour).UTC()}
+	for _, s := range []*database.Session{expired, revoked, active} {
+		if err := m.Sessions.Insert(t.Context(), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token := &database.RefreshToken{SessionID: expired.ID, TokenHash: "expired", ExpiresAt: expired.ExpiresAt}
+	if err := m.RefreshTokens.Insert(t.Context(), token); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Sessions.Revoke(t.Context(), revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The revocation happened just now, so only the expired session ended
+	// an hour ago.
+	if n, err := m.Sessions.DeleteEnded(t.Context(), now.Add(-time.Hour)); n != 1 || err != nil {
+		t.Fatalf("DeleteEnded an hour ago = %d, %v; want 1", n, err)
+	}
+	if got, _ := m.Sessions.Get(t.Context(), expired.ID); got != nil {
+		t.Errorf("expired session still exists")
+	}
+	if got, _ := m.RefreshTokens.GetByHash(t.Context(), "expired"); got != nil {
+		t.Errorf("refresh token of a deleted session still exists")
+	}
+	if n, err := m.Sessions.DeleteEnded(t.Context(), time.Now().Add(time.Minute)); n != 1 || err != nil {
+		t.Fatalf("DeleteEnded now = %d, %v; want 1", n, err)
+	}
+	if got, _ := m.Sessions.Get(t.Context(), active.ID); got == nil {
+		t.Errorf("active session was deleted")
+	}
+
+	// Access tokens name their session by id, so the id of a deleted
+	// session, even the newest, is never given to another one.
+	if err := m.Sessions.Revoke(t.Context(), active.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := m.Sessions.DeleteEnded(t.Context(), time.Now().Add(time.Minute)); n != 1 || err != nil {
+		t.Fatalf("DeleteEnded of the newest session = %d, %v; want 1", n, err)
+	}
+	next := &database.Session{UserID: user.ID, ExpiresAt: now.Add(time.Hour).UTC()}
+	if err := m.Sessions.Insert(t.Context(), next); err != nil {
+		t.Fatal(err)
+	}
+	if next.ID <= active.ID {
+		t.Errorf("session inserted after deleting session %d got id %d", active.ID, next.ID)
+	}
+}
+
+func testRefreshTokens(t *testing.T, m database.Models) {
+	user := createUser(t, m, "user")
+	session := &database.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := m.Sessions.Insert(t.Context(), session); err != nil {
+		t.Fatal(err)
+	}
+	token := &database.RefreshToken{SessionID: session.ID, TokenHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := m.RefreshTokens.Insert(t.Context(), token); err != nil {
+		t.Fatal(err)
+	}
+	if token.ID == 0 || token.CreatedAt.IsZero() {
+		t.Fatalf("inserted token = %+v", token)
+	}
+	if err := m.RefreshTokens.Insert(t.Context(), &database.RefreshToken{SessionID: session.ID, TokenHash: "hash"}); !errors.Is(err, database.ErrDuplicate) {
+		t.Errorf("inserting a duplicate token hash: err = %v, want ErrDuplicate", err)
+	}
+
+	got, err := m.RefreshTokens.GetByHash(t.Context(), "hash")
+	if err != nil || got == nil || got.ID != token.ID || got.SessionID != session.ID || got.UsedAt != nil {
+		t.Fatalf("GetByHash = %+v, %v", got, err)
+	}
+	if got, err := m.RefreshTokens.GetByHash(t.Context(), "unknown"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetByHash of an unknown hash = %v, %v; want ErrNotFound", got, err)
+	}
+
+	if ok, err := m.RefreshTokens.MarkUsed(t.Context(), token.ID); !ok || err != nil {
+		t.Errorf("first MarkUsed = %v, %v; want true", ok, err)
+	}
+	if ok, err := m.RefreshTokens.MarkUsed(t.Context(), token.ID); ok || err != nil {
+		t.Errorf("second MarkUsed = %v, %v; want false", ok, err)
+	}
+	if _, err := m.RefreshTokens.MarkUsed(t.Context(), 9999); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("MarkUsed of a missing token: err = %v, want ErrNotFound", err)
+	}
+	if got, _ := m.RefreshTokens.GetByHash(t.Context(), "hash"); got.UsedAt == nil {
+		t.Errorf("used token has no UsedAt")
+	}
+}
+
+func testCalendarTokens(t *testing.T, m database.Models) {
+	alice, bob := createUser(t, m, "alice"), createUser(t, m, "bob")
+	if err := m.CalendarTokens.Set(t.Context(), alice.ID, "a1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CalendarTokens.Set(t.Context(), bob.ID, "b1"); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := m.CalendarTokens.GetUserID(t.Context(), "a1"); id != alice.ID || err != nil {
+		t.Errorf("GetUserID = %d, %v; want %d", id, err, alice.ID)
+	}
+
+	if err := m.CalendarTokens.Set(t.Context(), alice.ID, "a2"); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := m.CalendarTokens.GetUserID(t.Context(), "a1"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("replaced token still belongs to user %d", id)
+	}
+	if id, _ := m.CalendarTokens.GetUserID(t.Context(), "a2"); id != alice.ID {
+		t.Errorf("new token belongs to user %d, want %d", id, alice.ID)
+	}
+
+	if err := m.CalendarTokens.Delete(t.Context(), alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := m.CalendarTokens.GetUserID(t.Context(), "a2"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("deleted token still belongs to user %d", id)
+	}
+	if err := m.CalendarTokens.Delete(t.Context(), alice.ID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("second Delete: err = %v, want ErrNotFound", err)
+	}
+	if id, _ := m.CalendarTokens.GetUserID(t.Context(), "b1"); id != bob.ID {
+		t.Errorf("deleting alice's token affected bob's")
+	}
+}
+
+func testCancellation(t *testing.T, m database.Models) {
+	alice := createUser(t, m, "alice")
+	event := createEvent(t, m, alice, "Standup", date(2030, 1, 6))
+
+	cancelled, cancel := context.WithCancel(t.Context())
+	cancel()
+	expired, cancel := context.WithDeadline(t.Context(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	for _, tc := range []struct {
+		ctx  context.Context
+		want error
+	}{
+		{cancelled, context.Canceled},
+		{expired, context.DeadlineExceeded},
+	} {
+		if _, err := m.Events.Get(tc.ctx, event.ID); !errors.Is(err, tc.want) {
+			t.Errorf("Get: err = %v, want %v", err, tc.want)
+		}
+		if _, err := m.Events.List(tc.ctx, database.EventFilter{}, database.PageRequest{}); !errors.Is(err, tc.want) {
+			t.Errorf("List: err = %v, want %v", err, tc.want)
+		}
+		if _, err := m.Events.Search(tc.ctx, "standup", 10); !errors.Is(err, tc.want) {
+			t.Errorf("Search: err = %v, want %v", err, tc.want)
+		}
+		renamed := *event
+		renamed.Name = "Renamed"
+		if err := m.Events.Update(tc.ctx, &renamed); !errors.Is(err, tc.want) {
+			t.Errorf("Update: err = %v, want %v", err, tc.want)
+		}
+		if _, err := m.Attendees.SetRSVP(tc.ctx, event.ID, alice.ID, database.RSVPGoing); !errors.Is(err, tc.want) {
+			t.Errorf("SetRSVP: err = %v, want %v", err, tc.want)
+		}
+	}
+
+	// Nothing written under a cancelled context may have taken effect.
+	got, err := m.Events.Get(t.Context(), event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Standup" {
+		t.Errorf("event renamed to %q by a cancelled Update", got.Name)
+	}
+	if a, _ := m.Attendees.GetByEventAndAttendee(t.Context(), event.ID, alice.ID); a != nil {
+		t.Errorf("cancelled SetRSVP added an attendee")
+	}
+}
+
+func testTransactions(t *testing.T, m database.Models) {
+	alice, bob := createUser(t, m, "alice"), createUser(t, m, "bob")
+	errAbort := errors.New("abort")
+
+	var committed *database.Event
+	err := m.WithTx(t.Context(), func(tx database.Models) error {
+		committed = createEvent(t, tx, alice, "Committed", date(2030, 1, 6))
+		// The transaction sees its own writes.
+		if got, err := tx.Events.Get(t.Context(), committed.ID); err != nil || got == nil {
+			t.Errorf("Get inside the transaction = %v, %v", got, err)
+		}
+		_, err := tx.Attendees.SetRSVP(t.Context(), committed.ID, bob.ID, database.RSVPGoing)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if a, _ := m.Attendees.GetByEventAndAttendee(t.Context(), committed.ID, bob.ID); a == nil {
+		t.Errorf("committed RSVP is missing")
+	}
+
+	var rolledBack *database.Event
+	err = m.WithTx(t.Context(), func(tx database.Models) error {
+		rolledBack = createEvent(t, tx, alice, "Rolled back", date(2030, 1, 7))
+		if _, err := tx.Attendees.SetRSVP(t.Context(), committed.ID, bob.ID, database.RSVPDeclined); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx: err = %v, want the error of fn", err)
+	}
+	if got, _ := m.Events.Get(t.Context(), rolledBack.ID); got != nil {
+		t.Errorf("event of a rolled back transaction exists")
+	}
+	if a, _ := m.Attendees.GetByEventAndAttendee(t.Context(), committed.ID, bob.ID); a == nil || a.RSVP != database.RSVPGoing {
+		t.Errorf("RSVP of a rolled back transaction was kept: %+v", a)
+	}
+
+	// A failed nested transaction leaves the outer one intact.
+	var outer, inner *database.Event
+	err = m.WithTx(t.Context(), func(tx database.Models) error {
+		outer = createEvent(t, tx, alice, "Outer", date(2030, 1, 8))
+		err := tx.WithTx(t.Context(), func(tx database.Models) error {
+			inner = createEvent(t, tx, alice, "Inner", date(2030, 1, 9))
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			t.Errorf("nested WithTx: err = %v, want the error of fn", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if got, _ := m.Events.Get(t.Context(), outer.ID); got == nil {
+		t.Errorf("event of the outer transaction is missing")
+	}
+	if got, _ := m.Events.Get(t.Context(), inner.ID); got != nil {
+		t.Errorf("event of a rolled back nested transaction exists")
+	}
+
+	// Concurrent check-then-insert sequences add a single attendee.
+	event := createEvent(t, m, alice, "Popular", date(2030, 2, 1))
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- m.WithTx(t.Context(), func(tx database.Models) error {
+				_, err := tx.Attendees.GetByEventAndAttendee(t.Context(), event.ID, bob.ID)
+				if !errors.Is(err, database.ErrNotFound) {
+					return err
+				}
+				// Give the others time to run their check too.
+				time.Sleep(10 * time.Millisecond)
+				_, err = tx.Attendees.Insert(t.Context(), &database.Attendee{EventID: event.ID, UserID: bob.ID})
+				return err
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent WithTx: %v", err)
+		}
+	}
+	attendees, err := m.Attendees.GetAttendeesByEvent(t.Context(), event.ID, database.PageRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attendees.Data) != 1 {
+		t.Errorf("concurrent registrations added %d attendees, want 1", len(attendees.Data))
+	}
+}
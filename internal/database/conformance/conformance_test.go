@@ -0,0 +1,21 @@
+package conformance
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	Run(t, Memory)
+}
+
+func TestSQLite(t *testing.T) {
+	Run(t, SQLite)
+}
+
+func TestPostgres(t *testing.T) {
+	if os.Getenv(PostgresURLEnv) == "" {
+		t.Skipf("%s is not set", PostgresURLEnv)
+	}
+	Run(t, Postgres)
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Dialect is the SQL database the models run against. Queries are written in
+// the SQL that SQLite and PostgreSQL share, $n placeholders, RETURNING and
+// ON CONFLICT included; the helpers below cover where they differ.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite3"
+	Postgres Dialect = "postgres"
+)
+
+// Open connects to the database described by dsn. postgres:// and
+// postgresql:// URLs select PostgreSQL; anything else is the path of a SQLite
+// database, optionally prefixed with sqlite://.
+func Open(dsn string) (*sql.DB, Dialect, error) {
+	if isPostgres(dsn) {
+		config, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid PostgreSQL DSN: %w", err)
+		}
+		// Timestamps are read back in UTC and date-only values compared
+		// against them mean UTC midnight, as with SQLite.
+		config.RuntimeParams["timezone"] = "UTC"
+		return stdlib.OpenDB(*config), Postgres, nil
+	}
+
+	path := sqlitePath(dsn)
+	// Foreign keys are a setting of each connection, so they are switched
+	// on in the DSN rather than with a PRAGMA that would reach only one
+	// connection of the pool.
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	db, err := sql.Open("sqlite3", path+sep+"_foreign_keys=on")
+	if err != nil {
+		return nil, "", err
+	}
+	return db, SQLite, nil
+}
+
+// SQLiteFile returns the file of the SQLite database described by dsn, or ""
+// for PostgreSQL and in-memory databases.
+func SQLiteFile(dsn string) string {
+	if isPostgres(dsn) {
+		return ""
+	}
+	file, _, _ := strings.Cut(strings.TrimPrefix(sqlitePath(dsn), "file:"), "?")
+	if file == ":memory:" || file == "" || strings.Contains(sqlitePath(dsn), "mode=memory") {
+		return ""
+	}
+	return file
+}
+
+func isPostgres(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+func sqlitePath(dsn string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(dsn, "sqlite://"), "sqlite3://")
+}
+
+// eventTime returns t as an argument for the starts_at and ends_at columns.
+// SQLite stores them as text in the format of dbTime, PostgreSQL as
+// timestamptz; both keep whole seconds.
+func (d Dialect) eventTime(t time.Time) any {
+	if d == Postgres {
+		return t.UTC().Truncate(time.Second)
+	}
+	return dbTime(t)
+}
+
+// eventTimePtr is eventTime for optional times.
+func (d Dialect) eventTimePtr(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return d.eventTime(*t)
+}
+
+// date returns midnight UTC of a date as an argument to compare event times
+// against.
+func (d Dialect) date(t time.Time) any {
+	if d == Postgres {
+		return t.UTC()
+	}
+	return t.Format("2006-01-02")
+}
+
+// typed annotates a placeholder whose type PostgreSQL cannot infer, such as
+// one in the select list of INSERT ... SELECT. SQLite is dynamically typed.
+func (d Dialect) typed(placeholder, pgType string) string {
+	if d == Postgres {
+		return placeholder + "::" + pgType
+	}
+	return placeholder
+}
+
+// lockEvent serialises changes to the seats of an event for the rest of tx.
+// SQLite allows a single writer at a time anyway; PostgreSQL needs the event
+// row locked so that concurrent registrations cannot both take the last
+// seat.
+func (d Dialect) lockEvent(ctx context.Context, tx DBTX, eventID int) error {
+	if d != Postgres {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, "SELECT id FROM events WHERE id = $1 FOR UPDATE", eventID)
+	return err
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+// The errors the repositories report, the same for every database. Errors
+// from the database carry them through Error, so callers test for them with
+// errors.Is.
+var (
+	// ErrNotFound means that the row a method reads, changes or deletes
+	// does not exist, or has been deleted.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate means that a write would have stored a value that has
+	// to be unique, such as a user's email, a second time.
+	ErrDuplicate = errors.New("duplicate value")
+	// ErrForeignKey means that a write refers to a row that does not
+	// exist, such as an event of an unknown owner.
+	ErrForeignKey = errors.New("reference to a missing row")
+	// ErrConflict means that a transaction kept colliding with concurrent
+	// ones and gave up.
+	ErrConflict = errors.New("conflict with a concurrent transaction")
+)
+
+// Error is a database error translated into one of the errors above. It
+// wraps the driver's error too, for logging and for retryable.
+type Error struct {
+	// Kind is ErrDuplicate, ErrForeignKey or ErrConflict.
+	Kind error
+	// Field is the column whose value is duplicate, if the database says.
+	Field string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Field != "" {
+		return e.Kind.Error() + " of " + e.Field + ": " + e.Err.Error()
+	}
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error { return []error{e.Kind, e.Err} }
+
+// translate turns constraint violations and lost races reported by SQLite
+// or PostgreSQL into an Error, and sql.ErrNoRows into ErrNotFound. Other
+// errors are returned as they are.
+func translate(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	var translated *Error
+	if errors.As(err, &translated) {
+		return err
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			// "UNIQUE constraint failed: users.email", with more columns
+			// after a comma for a composite key.
+			_, column, _ := strings.Cut(sqliteErr.Error(), ": ")
+			column, _, _ = strings.Cut(column, ",")
+			_, column, _ = strings.Cut(column, ".")
+			return &Error{Kind: ErrDuplicate, Field: column, Err: err}
+		case sqlite3.ErrConstraintForeignKey:
+			return &Error{Kind: ErrForeignKey, Err: err}
+		}
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505": // unique_violation
+			// "Key (email)=(a@b.c) already exists."; the value is left
+			// out, as it may be a secret. A composite key is named by its
+			// first column, as on SQLite.
+			column, _, _ := strings.Cut(strings.TrimPrefix(pgErr.Detail, "Key ("), ")")
+			column, _, _ = strings.Cut(column, ",")
+			return &Error{Kind: ErrDuplicate, Field: column, Err: &pgconn.PgError{Code: pgErr.Code, Message: pgErr.Message, ConstraintName: pgErr.ConstraintName}}
+		case "23503": // foreign_key_violation
+			return &Error{Kind: ErrForeignKey, Err: err}
+		}
+	}
+	if retryable(err) {
+		return &Error{Kind: ErrConflict, Err: err}
+	}
+	return err
+}
+
+// expectRow returns ErrNotFound if result changed no row.
+func expectRow(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
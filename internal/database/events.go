@@ -2,39 +2,226 @@ package database
 
 import (
 	"context"
-	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
 	"time"
 )
 
 type EventModel struct {
-	DB *sql.DB
+	DB       DBTX
+	Dialect  Dialect
+	Timeouts Timeouts
 }
 type Event struct {
 	ID          int    `json:"id"`
 	OwnerId     int    `json:"owner_id"`
 	Name        string `json:"name" binding:"required,min=3,max=255"`
 	Description string `json:"description" binding:"required,min=10,max=100"`
-	Date        string `json:"date" binding:"required,datetime=2006-01-02"`
-	Location    string `json:"location" binding:"required,min=3,max=255"`
+	// StartsAt and EndsAt are RFC 3339 instants. Responses render them in the
+	// event's Timezone unless the client asks for another zone.
+	StartsAt time.Time `json:"starts_at" binding:"required"`
+	EndsAt   time.Time `json:"ends_at" binding:"required,gtfield=StartsAt"`
+	// Timezone is the IANA timezone the event takes place in, e.g.
+	// "Europe/Berlin". Recurring events keep their local time across DST
+	// changes in it. Defaults to UTC.
+	Timezone string `json:"timezone" binding:"omitempty,timezone"`
+	Location string `json:"location" binding:"required,min=3,max=255"`
+	// Capacity is the number of seats; nil means unlimited. Registrations
+	// beyond it are put on the waitlist.
+	Capacity *int `json:"capacity,omitempty" binding:"omitempty,min=1"`
+	// RRule makes the event recurring, starting at StartsAt. It is an RFC 5545
+	// recurrence rule such as "FREQ=WEEKLY;BYDAY=TU;COUNT=10".
+	RRule string `json:"rrule,omitempty" binding:"omitempty,max=255"`
+	// ExDates are dates on which a recurring event does not take place.
+	ExDates DateList `json:"exdates,omitempty" binding:"omitempty,dive,datetime=2006-01-02"`
+	// Sequence counts the changes made to the event since it was created and
+	// UpdatedAt is the time of the last one; calendar clients use them to
+	// pick the latest version.
+	Sequence  int       `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+	// DeletedAt is set once the event is deleted. Deleted events are hidden
+	// everywhere except calendar feeds, which report them as cancelled.
+	DeletedAt *time.Time `json:"-"`
+}
+
+// eventColumns selects every event column from the events table aliased as
+// e, in the order scanned by Event.fields.
+const eventColumns = "e.id, e.owner_id, e.name, e.description, e.starts_at, e.ends_at, e.timezone, e.location, e.capacity, COALESCE(e.rrule, ''), e.exdates, e.sequence, e.updated_at, e.deleted_at"
+
+// fields returns the scan destinations for eventColumns followed by extra.
+func (e *Event) fields(extra ...any) []any {
+	return append([]any{&e.ID, &e.OwnerId, &e.Name, &e.Description, &e.StartsAt, &e.EndsAt, &e.Timezone, &e.Location, &e.Capacity, &e.RRule, &e.ExDates, &e.Sequence, &e.UpdatedAt, &e.DeletedAt}, extra...)
+}
+
+// DateList is a list of dates stored as a comma-separated column.
+type DateList []string
+
+func (d *DateList) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into DateList", src)
+	}
+	if s == "" {
+		*d = nil
+		return nil
+	}
+	*d = strings.Split(s, ",")
+	return nil
+}
+
+func (d DateList) Value() (driver.Value, error) {
+	if len(d) == 0 {
+		return nil, nil
+	}
+	return strings.Join(d, ","), nil
+}
+
+// Zone returns the location of the event's Timezone, falling back to UTC.
+func (e *Event) Zone() *time.Location {
+	if e.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(e.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// In returns a copy of the event with its times rendered in loc.
+func (e *Event) In(loc *time.Location) *Event {
+	c := *e
+	c.StartsAt = e.StartsAt.In(loc)
+	c.EndsAt = e.EndsAt.In(loc)
+	return &c
+}
+
+// dbTime formats t the way event times are stored: UTC RFC 3339 text, which
+// sorts chronologically and compares correctly against plain dates.
+func dbTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// EventFilter narrows an event listing. Zero values mean "no filter"; From
+// and To are inclusive UTC dates in 2006-01-02 format matched against the
+// start of events.
+type EventFilter struct {
+	From     string
+	To       string
+	Location string
+	OwnerID  int
+	// RSVP only applies to the events of an attendee and keeps those the
+	// attendee answered with one of the given values.
+	RSVP []string
+	// DeletedSince includes events deleted at or after it. Deleted events
+	// are left out when it is zero.
+	DeletedSince time.Time
+}
+
+// eventSortColumns whitelists the columns events can be sorted by.
+var eventSortColumns = map[string]string{
+	"id":        "e.id",
+	"starts_at": "e.starts_at",
+	// date is the name starts_at was sorted by before events had times.
+	"date": "e.starts_at",
+	"name": "e.name",
+}
+
+// conditions appends the SQL conditions for the filter to conds.
+func (f EventFilter) conditions(d Dialect, conds []string, args *queryArgs) ([]string, error) {
+	if f.DeletedSince.IsZero() {
+		conds = append(conds, "e.deleted_at IS NULL")
+	} else {
+		conds = append(conds, "(e.deleted_at IS NULL OR e.deleted_at >= "+args.add(f.DeletedSince.UTC())+")")
+	}
+	if f.From != "" {
+		from, err := time.Parse("2006-01-02", f.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from date %q", f.From)
+		}
+		conds = append(conds, "e.starts_at >= "+args.add(d.date(from)))
+	}
+	if f.To != "" {
+		to, err := time.Parse("2006-01-02", f.To)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to date %q", f.To)
+		}
+		conds = append(conds, "e.starts_at < "+args.add(d.date(to.AddDate(0, 0, 1))))
+	}
+	if f.Location != "" {
+		conds = append(conds, "LOWER(e.location) LIKE "+args.add("%"+strings.ToLower(f.Location)+"%"))
+	}
+	if f.OwnerID != 0 {
+		conds = append(conds, "e.owner_id = "+args.add(f.OwnerID))
+	}
+	return conds, nil
+}
+
+// matches is the in-memory equivalent of conditions.
+func (f EventFilter) matches(e *Event) bool {
+	if e.DeletedAt != nil && (f.DeletedSince.IsZero() || e.DeletedAt.Before(f.DeletedSince)) {
+		return false
+	}
+	start := dbTime(e.StartsAt)
+	if f.From != "" && start < f.From {
+		return false
+	}
+	if f.To != "" {
+		to, err := time.Parse("2006-01-02", f.To)
+		if err != nil || start >= to.AddDate(0, 0, 1).Format("2006-01-02") {
+			return false
+		}
+	}
+	if f.Location != "" && !strings.Contains(strings.ToLower(e.Location), strings.ToLower(f.Location)) {
+		return false
+	}
+	return f.OwnerID == 0 || e.OwnerId == f.OwnerID
 }
 
 // implementing the handler functions for the EventModel
 
 // Insert inserts a new event into the database
-func (m *EventModel) Insert(event *Event) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *EventModel) Insert(ctx context.Context, event *Event) error {
+	ctx, span := startSpan(ctx, "EventModel.Insert")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
 	defer cancel()
 
-	query := "INSERT INTO events (owner_id, name, description, date, location) VALUES ($1, $2, $3, $4, $5) RETURNING id"
-	return m.DB.QueryRowContext(ctx, query, event.OwnerId, event.Name, event.Description, event.Date, event.Location).Scan(&event.ID)
+	if event.Timezone == "" {
+		event.Timezone = "UTC"
+	}
+	event.UpdatedAt = time.Now().UTC()
+	query := `INSERT INTO events (owner_id, name, description, starts_at, ends_at, timezone, location, capacity, rrule, exdates, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`
+	err := m.DB.QueryRowContext(ctx, query, event.OwnerId, event.Name, event.Description, m.Dialect.eventTime(event.StartsAt), m.Dialect.eventTime(event.EndsAt), event.Timezone,
+		event.Location, event.Capacity, nullIfEmpty(event.RRule), event.ExDates, event.UpdatedAt).Scan(&event.ID)
+	return translate(err)
 }
 
 // GetAll gets all events from the database
-func (m *EventModel) GetAll() ([]*Event, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *EventModel) GetAll(ctx context.Context) ([]*Event, error) {
+	ctx, span := startSpan(ctx, "EventModel.GetAll")
+	defer span.End()
+	ctx, cancel := m.Timeouts.read(ctx)
 	defer cancel()
 
-	query := "SELECT * FROM events"
+	query := "SELECT " + eventColumns + " FROM events e WHERE e.deleted_at IS NULL"
 	rows, err := m.DB.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
@@ -44,8 +231,7 @@ func (m *EventModel) GetAll() ([]*Event, error) {
 	events := []*Event{}
 	for rows.Next() {
 		var event Event
-		scanErr := rows.Scan(&event.ID, &event.OwnerId, &event.Name, &event.Description, &event.Date, &event.Location)
-		if scanErr != nil {
+		if err := rows.Scan(event.fields()...); err != nil {
 			return nil, err
 		}
 		events = append(events, &event)
@@ -56,43 +242,141 @@ func (m *EventModel) GetAll() ([]*Event, error) {
 	return events, nil
 }
 
-// Get gets an event by id from the database
-func (m *EventModel) Get(id int) (*Event, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// List returns one page of events matching the filter
+func (m *EventModel) List(ctx context.Context, filter EventFilter, page PageRequest) (*Page[*Event], error) {
+	ctx, span := startSpan(ctx, "EventModel.List")
+	defer span.End()
+	ctx, cancel := m.Timeouts.read(ctx)
 	defer cancel()
-	query := "SELECT * FROM events WHERE id = $1"
-	row := m.DB.QueryRowContext(ctx, query, id)
-	var event Event
-	err := row.Scan(&event.ID, &event.OwnerId, &event.Name, &event.Description, &event.Date, &event.Location)
+	return listEvents(ctx, m.DB, m.Dialect, "", nil, nil, filter, page)
+}
+
+// listEvents runs a keyset-paginated query over events. join and conds let
+// callers restrict the listing further, e.g. to the events of one attendee.
+func listEvents(ctx context.Context, db DBTX, d Dialect, join string, conds []string, args queryArgs, filter EventFilter, page PageRequest) (*Page[*Event], error) {
+	k, err := newKeyset(page, eventSortColumns)
+	if err != nil {
+		return nil, err
+	}
+	conds, err = filter.conditions(d, conds, &args)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
+		return nil, err
+	}
+
+	result := &Page[*Event]{Data: []*Event{}}
+	countQuery := "SELECT COUNT(*) FROM events e" + join + whereClause(conds)
+	if err := db.QueryRowContext(ctx, countQuery, args...).Scan(&result.Total); err != nil {
+		return nil, err
+	}
+
+	if cond := k.where(&args); cond != "" {
+		conds = append(conds, cond)
+	}
+	query := "SELECT " + eventColumns + ", " + k.sortKey() +
+		" FROM events e" + join + whereClause(conds) + k.orderBy()
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lastKey string
+	fetched := 0
+	for rows.Next() {
+		fetched++
+		if fetched > k.limit {
+			break
 		}
+		var event Event
+		err := rows.Scan(event.fields(&lastKey)...)
+		if err != nil {
+			return nil, err
+		}
+		result.Data = append(result.Data, &event)
+	}
+	if err = rows.Err(); err != nil {
 		return nil, err
 	}
+	if len(result.Data) > 0 {
+		result.NextCursor = k.next(fetched, lastKey, result.Data[len(result.Data)-1].ID)
+	}
+	return result, nil
+}
+
+// Get gets an event by id from the database. Deleted events are not found.
+func (m *EventModel) Get(ctx context.Context, id int) (*Event, error) {
+	ctx, span := startSpan(ctx, "EventModel.Get")
+	defer span.End()
+	return m.get(ctx, id, false)
+}
+
+// GetWithDeleted gets an event by id even if it has been deleted.
+func (m *EventModel) GetWithDeleted(ctx context.Context, id int) (*Event, error) {
+	ctx, span := startSpan(ctx, "EventModel.GetWithDeleted")
+	defer span.End()
+	return m.get(ctx, id, true)
+}
+
+func (m *EventModel) get(ctx context.Context, id int, withDeleted bool) (*Event, error) {
+	ctx, cancel := m.Timeouts.read(ctx)
+	defer cancel()
+	query := "SELECT " + eventColumns + " FROM events e WHERE e.id = $1"
+	if !withDeleted {
+		query += " AND e.deleted_at IS NULL"
+	}
+	row := m.DB.QueryRowContext(ctx, query, id)
+	var event Event
+	if err := row.Scan(event.fields()...); err != nil {
+		return nil, translate(err)
+	}
 	return &event, nil
 }
 
-// Update updates an event in the database
-func (m *EventModel) Update(event *Event) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// Update updates an event in the database. Raising the capacity promotes
+// waitlisted attendees into the new seats.
+func (m *EventModel) Update(ctx context.Context, event *Event) error {
+	ctx, span := startSpan(ctx, "EventModel.Update")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
 	defer cancel()
-	query := "UPDATE events SET name = $1, description = $2, date = $3, location = $4 WHERE id = $5"
-	_, err := m.DB.ExecContext(ctx, query, event.Name, event.Description, event.Date, event.Location, event.ID)
+
+	tx, err := begin(ctx, m.DB, nil)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	if event.Timezone == "" {
+		event.Timezone = "UTC"
+	}
+	event.UpdatedAt = time.Now().UTC()
+	query := `UPDATE events SET name = $1, description = $2, starts_at = $3, ends_at = $4, timezone = $5, location = $6,
+		capacity = $7, rrule = $8, exdates = $9, sequence = sequence + 1, updated_at = $10
+		WHERE id = $11 AND deleted_at IS NULL
+		RETURNING sequence`
+	err = tx.QueryRowContext(ctx, query, event.Name, event.Description, m.Dialect.eventTime(event.StartsAt), m.Dialect.eventTime(event.EndsAt), event.Timezone,
+		event.Location, event.Capacity, nullIfEmpty(event.RRule), event.ExDates, event.UpdatedAt, event.ID).Scan(&event.Sequence)
+	if err != nil {
+		return translate(err)
+	}
+	if _, err := promoteWaitlisted(ctx, tx, event.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// Delete deletes an event from the database
-func (m *EventModel) Delete(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// Delete marks an event as deleted. Its row and attendees are kept so that
+// calendar feeds can report the event as cancelled.
+func (m *EventModel) Delete(ctx context.Context, id int) error {
+	ctx, span := startSpan(ctx, "EventModel.Delete")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
 	defer cancel()
-	query := "DELETE FROM events WHERE id = $1"
-	_, err := m.DB.ExecContext(ctx, query, id)
+	now := time.Now().UTC()
+	query := "UPDATE events SET deleted_at = $1, updated_at = $1, sequence = sequence + 1 WHERE id = $2 AND deleted_at IS NULL"
+	result, err := m.DB.ExecContext(ctx, query, now, id)
 	if err != nil {
 		return err
 	}
-	return nil
+	return expectRow(result)
 }
@@ -0,0 +1,434 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore holds the data behind NewMemoryModels. One mutex guards all
+// of it, which makes every method as atomic as the transactions the SQL
+// models use. Inside WithTx the lock is held for the whole transaction and
+// the models given to fn use a copy of the store whose lock does nothing.
+type memoryStore struct {
+	mu             sync.Locker
+	users          map[int]*User
+	events         map[int]*Event
+	overrides      map[int]map[string]*OccurrenceOverride
+	attendees      map[int]*memoryAttendee
+	sessions       map[int]*Session
+	refreshTokens  map[int]*RefreshToken
+	calendarTokens map[int]string
+	// lastSessionID is the id of the newest session ever inserted. Like an
+	// AUTOINCREMENT column it never goes back, so deleted sessions' ids are
+	// not handed out again. It is shared with the copies made by WithTx.
+	lastSessionID *int
+}
+
+// memoryAttendee is an attendees row.
+type memoryAttendee struct {
+	Attendee
+	createdAt time.Time
+}
+
+// errForeignKey and duplicate are the errors that SQLite's constraints
+// would have been translated to.
+var errForeignKey = &Error{Kind: ErrForeignKey, Err: errors.New("FOREIGN KEY constraint failed")}
+
+func duplicate(table, column string) error {
+	return &Error{Kind: ErrDuplicate, Field: column, Err: errors.New("UNIQUE constraint failed: " + table + "." + column)}
+}
+
+// NewMemoryModels returns models that keep everything in memory. They behave
+// like the SQL models, except that search ranking only approximates FTS5, and
+// are meant for tests.
+func NewMemoryModels() Models {
+	s := &memoryStore{
+		mu:             new(sync.Mutex),
+		users:          map[int]*User{},
+		events:         map[int]*Event{},
+		overrides:      map[int]map[string]*OccurrenceOverride{},
+		attendees:      map[int]*memoryAttendee{},
+		sessions:       map[int]*Session{},
+		refreshTokens:  map[int]*RefreshToken{},
+		calendarTokens: map[int]string{},
+		lastSessionID:  new(int),
+	}
+	return s.models()
+}
+
+func (s *memoryStore) models() Models {
+	return Models{
+		Users:          &memoryUsers{s},
+		Events:         &memoryEvents{s},
+		Attendees:      &memoryAttendees{s},
+		Sessions:       &memorySessions{s},
+		RefreshTokens:  &memoryRefreshTokens{s},
+		CalendarTokens: &memoryCalendarTokens{s},
+		withTx:         s.withTx,
+	}
+}
+
+// noLock is the lock of a store that is only used inside WithTx, whose
+// caller already holds the real one.
+type noLock struct{}
+
+func (noLock) Lock()   {}
+func (noLock) Unlock() {}
+
+// withTx implements Models.WithTx. Conflicts cannot happen, so fn runs
+// once; if it fails, every table is put back the way it was.
+func (s *memoryStore) withTx(ctx context.Context, fn func(tx Models) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := s.snapshot()
+	tx := *s
+	tx.mu = noLock{}
+	if err := fn(tx.models()); err != nil {
+		s.restore(saved)
+		return err
+	}
+	return nil
+}
+
+// snapshot returns a copy of every table. The caller must hold the lock.
+func (s *memoryStore) snapshot() *memoryStore {
+	overrides := make(map[int]map[string]*OccurrenceOverride, len(s.overrides))
+	for id, byDate := range s.overrides {
+		overrides[id] = copyRows(byDate)
+	}
+	return &memoryStore{
+		users:          copyRows(s.users),
+		events:         copyRows(s.events),
+		overrides:      overrides,
+		attendees:      copyRows(s.attendees),
+		sessions:       copyRows(s.sessions),
+		refreshTokens:  copyRows(s.refreshTokens),
+		calendarTokens: maps.Clone(s.calendarTokens),
+	}
+}
+
+// restore puts back the tables of a snapshot. The maps are refilled rather
+// than replaced because the copies of the store made by WithTx share them.
+func (s *memoryStore) restore(saved *memoryStore) {
+	refill(s.users, saved.users)
+	refill(s.events, saved.events)
+	refill(s.overrides, saved.overrides)
+	refill(s.attendees, saved.attendees)
+	refill(s.sessions, saved.sessions)
+	refill(s.refreshTokens, saved.refreshTokens)
+	refill(s.calendarTokens, saved.calendarTokens)
+}
+
+// copyRows copies a table, rows included.
+func copyRows[K comparable, T any](rows map[K]*T) map[K]*T {
+	out := make(map[K]*T, len(rows))
+	for k, row := range rows {
+		c := *row
+		out[k] = &c
+	}
+	return out
+}
+
+func refill[K comparable, V any](dst, src map[K]V) {
+	clear(dst)
+	maps.Copy(dst, src)
+}
+
+// nextID returns the id SQLite would give the next row of a table.
+func nextID[T any](rows map[int]T) int {
+	id := 0
+	for k := range rows {
+		id = max(id, k)
+	}
+	return id + 1
+}
+
+// sortedIDs returns the keys of rows in ascending order.
+func sortedIDs[T any](rows map[int]T) []int {
+	ids := make([]int, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+type memoryUsers struct{ s *memoryStore }
+
+func (m *memoryUsers) Insert(ctx context.Context, user *User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for _, u := range m.s.users {
+		if u.UserName == user.UserName {
+			return duplicate("users", "username")
+		}
+		if u.Email == user.Email {
+			return duplicate("users", "email")
+		}
+	}
+	if user.Role == "" {
+		user.Role = RoleOrganizer
+	}
+	user.ID = nextID(m.s.users)
+	u := *user
+	m.s.users[u.ID] = &u
+	return nil
+}
+
+func (m *memoryUsers) GetUser(ctx context.Context, id int) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	u, ok := m.s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *u
+	return &c, nil
+}
+
+func (m *memoryUsers) GetByEmail(ctx context.Context, email string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for _, u := range m.s.users {
+		if u.Email == email {
+			c := *u
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryUsers) UpdateRole(ctx context.Context, id int, role string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	u, ok := m.s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	u.Role = role
+	return nil
+}
+
+type memorySessions struct{ s *memoryStore }
+
+func (m *memorySessions) Insert(ctx context.Context, session *Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[session.UserID]; !ok {
+		return errForeignKey
+	}
+	session.CreatedAt = time.Now().UTC()
+	*m.s.lastSessionID++
+	session.ID = *m.s.lastSessionID
+	c := *session
+	m.s.sessions[c.ID] = &c
+	return nil
+}
+
+func (m *memorySessions) Get(ctx context.Context, id int) (*Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	session, ok := m.s.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *session
+	return &c, nil
+}
+
+func (m *memorySessions) Revoke(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	session, ok := m.s.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if session.RevokedAt == nil {
+		now := time.Now().UTC()
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+func (m *memorySessions) RevokeAllForUser(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, session := range m.s.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memorySessions) DeleteEnded(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	deleted := 0
+	for id, session := range m.s.sessions {
+		if session.ExpiresAt.Before(before) || session.RevokedAt != nil && session.RevokedAt.Before(before) {
+			delete(m.s.sessions, id)
+			deleted++
+		}
+	}
+	for id, token := range m.s.refreshTokens {
+		if _, ok := m.s.sessions[token.SessionID]; !ok {
+			delete(m.s.refreshTokens, id)
+		}
+	}
+	return deleted, nil
+}
+
+type memoryRefreshTokens struct{ s *memoryStore }
+
+func (m *memoryRefreshTokens) Insert(ctx context.Context, token *RefreshToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.sessions[token.SessionID]; !ok {
+		return errForeignKey
+	}
+	for _, t := range m.s.refreshTokens {
+		if t.TokenHash == token.TokenHash {
+			return duplicate("refresh_tokens", "token_hash")
+		}
+	}
+	token.CreatedAt = time.Now().UTC()
+	token.ID = nextID(m.s.refreshTokens)
+	c := *token
+	m.s.refreshTokens[c.ID] = &c
+	return nil
+}
+
+func (m *memoryRefreshTokens) GetByHash(ctx context.Context, hash string) (*RefreshToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for _, t := range m.s.refreshTokens {
+		if t.TokenHash == hash {
+			c := *t
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryRefreshTokens) MarkUsed(ctx context.Context, id int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	t, ok := m.s.refreshTokens[id]
+	if !ok {
+		return false, ErrNotFound
+	}
+	if t.UsedAt != nil {
+		return false, nil
+	}
+	now := time.Now().UTC()
+	t.UsedAt = &now
+	return true, nil
+}
+
+type memoryCalendarTokens struct{ s *memoryStore }
+
+func (m *memoryCalendarTokens) Set(ctx context.Context, userID int, tokenHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[userID]; !ok {
+		return errForeignKey
+	}
+	for id, hash := range m.s.calendarTokens {
+		if hash == tokenHash && id != userID {
+			return duplicate("calendar_tokens", "token_hash")
+		}
+	}
+	m.s.calendarTokens[userID] = tokenHash
+	return nil
+}
+
+func (m *memoryCalendarTokens) GetUserID(ctx context.Context, tokenHash string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for userID, hash := range m.s.calendarTokens {
+		if hash == tokenHash {
+			return userID, nil
+		}
+	}
+	return 0, ErrNotFound
+}
+
+func (m *memoryCalendarTokens) Delete(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.calendarTokens[userID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.s.calendarTokens, userID)
+	return nil
+}
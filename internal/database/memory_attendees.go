@@ -0,0 +1,266 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type memoryAttendees struct{ s *memoryStore }
+
+// attendeesOf returns the attendee rows of an event ordered by id. The
+// caller must hold the lock.
+func (s *memoryStore) attendeesOf(eventID int) []*memoryAttendee {
+	var rows []*memoryAttendee
+	for _, id := range sortedIDs(s.attendees) {
+		if a := s.attendees[id]; a.EventID == eventID {
+			rows = append(rows, a)
+		}
+	}
+	return rows
+}
+
+// findAttendee returns the attendee row of a user for an event, or nil.
+func (s *memoryStore) findAttendee(eventID, userID int) *memoryAttendee {
+	for _, a := range s.attendeesOf(eventID) {
+		if a.UserID == userID {
+			return a
+		}
+	}
+	return nil
+}
+
+// seatStatus is the in-memory counterpart of seatStatus.
+func (s *memoryStore) seatStatus(e *Event, rsvp string) string {
+	if rsvp != RSVPGoing {
+		return ""
+	}
+	if e.Capacity == nil {
+		return AttendeeRegistered
+	}
+	registered := 0
+	for _, a := range s.attendeesOf(e.ID) {
+		if a.Status == AttendeeRegistered {
+			registered++
+		}
+	}
+	if registered < *e.Capacity {
+		return AttendeeRegistered
+	}
+	return AttendeeWaitlisted
+}
+
+// waitlist returns the waitlisted attendees of an event, next in line first.
+func (s *memoryStore) waitlist(eventID int) []*memoryAttendee {
+	var waiting []*memoryAttendee
+	for _, a := range s.attendeesOf(eventID) {
+		if a.Status == AttendeeWaitlisted {
+			waiting = append(waiting, a)
+		}
+	}
+	sort.SliceStable(waiting, func(i, j int) bool { return waiting[i].createdAt.Before(waiting[j].createdAt) })
+	return waiting
+}
+
+// attendee returns a copy of an attendee row with its waitlist position.
+func (s *memoryStore) attendee(a *memoryAttendee) *Attendee {
+	c := a.Attendee
+	c.WaitlistPosition = nil
+	if a.Status == AttendeeWaitlisted {
+		position := slices.Index(s.waitlist(a.EventID), a) + 1
+		c.WaitlistPosition = &position
+	}
+	return &c
+}
+
+// promoteWaitlisted is the in-memory counterpart of promoteWaitlisted.
+func (s *memoryStore) promoteWaitlisted(eventID int) {
+	e, ok := s.events[eventID]
+	if !ok {
+		return
+	}
+	waiting := s.waitlist(eventID)
+	free := len(waiting)
+	if e.Capacity != nil {
+		registered := 0
+		for _, a := range s.attendeesOf(eventID) {
+			if a.Status == AttendeeRegistered {
+				registered++
+			}
+		}
+		free = min(free, *e.Capacity-registered)
+	}
+	for i := 0; i < free; i++ {
+		waiting[i].Status = AttendeeRegistered
+	}
+}
+
+// insertAttendee is the in-memory counterpart of insertAttendee.
+func (s *memoryStore) insertAttendee(attendee *Attendee) error {
+	if attendee.RSVP == "" {
+		attendee.RSVP = RSVPGoing
+	}
+	e, ok := s.events[attendee.EventID]
+	if !ok || e.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if _, ok := s.users[attendee.UserID]; !ok {
+		return errForeignKey
+	}
+	if s.findAttendee(attendee.EventID, attendee.UserID) != nil {
+		return duplicate("attendees", "event_id")
+	}
+	a := &memoryAttendee{Attendee: *attendee, createdAt: time.Now().UTC()}
+	a.ID = nextID(s.attendees)
+	a.Status = s.seatStatus(e, a.RSVP)
+	a.WaitlistPosition = nil
+	s.attendees[a.ID] = a
+	*attendee = *s.attendee(a)
+	return nil
+}
+
+func (m *memoryAttendees) Insert(ctx context.Context, attendee *Attendee) (*Attendee, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if err := m.s.insertAttendee(attendee); err != nil {
+		return nil, err
+	}
+	return attendee, nil
+}
+
+func (m *memoryAttendees) SetRSVP(ctx context.Context, eventID int, userID int, rsvp string) (*Attendee, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	attendee := &Attendee{EventID: eventID, UserID: userID, RSVP: rsvp}
+	a := m.s.findAttendee(eventID, userID)
+	switch {
+	case a == nil:
+		if err := m.s.insertAttendee(attendee); err != nil {
+			return nil, err
+		}
+	case a.RSVP == rsvp:
+		*attendee = *m.s.attendee(a)
+	case rsvp == RSVPGoing:
+		a.RSVP, a.createdAt, a.Status = rsvp, time.Now().UTC(), ""
+		a.Status = m.s.seatStatus(m.s.events[eventID], rsvp)
+		*attendee = *m.s.attendee(a)
+	default:
+		a.RSVP, a.Status = rsvp, ""
+		m.s.promoteWaitlisted(eventID)
+		attendee.ID = a.ID
+	}
+	return attendee, nil
+}
+
+func (m *memoryAttendees) GetByEventAndAttendee(ctx context.Context, eventID int, userID int) (*Attendee, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	a := m.s.findAttendee(eventID, userID)
+	if a == nil {
+		return nil, ErrNotFound
+	}
+	return m.s.attendee(a), nil
+}
+
+func (m *memoryAttendees) GetAttendeesByEvent(ctx context.Context, eventId int, page PageRequest) (*Page[*EventAttendee], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	k, err := newKeyset(page, attendeeSortColumns)
+	if err != nil {
+		return nil, err
+	}
+	var attendees []*EventAttendee
+	for _, a := range m.s.attendeesOf(eventId) {
+		u, ok := m.s.users[a.UserID]
+		if !ok {
+			continue
+		}
+		row := m.s.attendee(a)
+		attendees = append(attendees, &EventAttendee{
+			ID:               u.ID,
+			UserName:         u.UserName,
+			Email:            u.Email,
+			RSVP:             row.RSVP,
+			Status:           row.Status,
+			WaitlistPosition: row.WaitlistPosition,
+		})
+	}
+	key := func(a *EventAttendee) string { return strconv.Itoa(a.ID) }
+	if k.column == "u.username" {
+		key = func(a *EventAttendee) string { return a.UserName }
+	}
+	return pageOf(k, attendees, key, func(a *EventAttendee) int { return a.ID }), nil
+}
+
+func (m *memoryAttendees) Delete(ctx context.Context, eventId int, userId int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	deleted := false
+	for _, a := range m.s.attendeesOf(eventId) {
+		if a.UserID == userId {
+			delete(m.s.attendees, a.ID)
+			deleted = true
+		}
+	}
+	if !deleted {
+		return ErrNotFound
+	}
+	m.s.promoteWaitlisted(eventId)
+	return nil
+}
+
+// eventsOf returns the events of an attendee, once for each attendee row
+// like the SQL join. The caller must hold the lock.
+func (s *memoryStore) eventsOf(attendeeId int, filter EventFilter) []*Event {
+	var events []*Event
+	for _, id := range sortedIDs(s.attendees) {
+		a := s.attendees[id]
+		if a.UserID != attendeeId || (len(filter.RSVP) > 0 && !slices.Contains(filter.RSVP, a.RSVP)) {
+			continue
+		}
+		if e, ok := s.events[a.EventID]; ok {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func (m *memoryAttendees) GetEventsByAttendee(ctx context.Context, attendeeId int, filter EventFilter, page PageRequest) (*Page[*Event], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+	return m.s.listEvents(m.s.eventsOf(attendeeId, filter), filter, page)
+}
+
+func (m *memoryAttendees) GetOccurrencesByAttendee(ctx context.Context, attendeeId int, filter EventFilter, page PageRequest) (*Page[*Occurrence], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+	return m.s.listOccurrences(m.s.eventsOf(attendeeId, filter), filter, page)
+}
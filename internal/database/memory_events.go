@@ -0,0 +1,301 @@
+package database
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+type memoryEvents struct{ s *memoryStore }
+
+// storedTime is an event time as it reads back from the database: UTC, in
+// whole seconds.
+func storedTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// storedTimePtr is storedTime for optional times.
+func storedTimePtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := storedTime(*t)
+	return &c
+}
+
+// copyEvent returns a copy of e that shares no memory with it.
+func copyEvent(e *Event) *Event {
+	c := *e
+	c.Capacity = copyPtr(e.Capacity)
+	c.ExDates = append(DateList(nil), e.ExDates...)
+	if len(c.ExDates) == 0 {
+		c.ExDates = nil
+	}
+	c.DeletedAt = copyPtr(e.DeletedAt)
+	return &c
+}
+
+// copyOverride returns a copy of o that shares no memory with it.
+func copyOverride(o *OccurrenceOverride) *OccurrenceOverride {
+	c := *o
+	c.Name, c.Description, c.Location = copyPtr(o.Name), copyPtr(o.Description), copyPtr(o.Location)
+	c.StartsAt, c.EndsAt = copyPtr(o.StartsAt), copyPtr(o.EndsAt)
+	return &c
+}
+
+func copyPtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	return &c
+}
+
+// eventSortKey returns the text form of the column k sorts events by, as
+// keyset.sortKey selects it.
+func eventSortKey(k *keyset) func(*Event) string {
+	switch k.column {
+	case "e.starts_at":
+		return func(e *Event) string { return dbTime(e.StartsAt) }
+	case "e.name":
+		return func(e *Event) string { return e.Name }
+	default:
+		return func(e *Event) string { return strconv.Itoa(e.ID) }
+	}
+}
+
+func eventID(e *Event) int { return e.ID }
+
+// listEvents is the in-memory counterpart of listEvents. The caller must
+// hold the lock.
+func (s *memoryStore) listEvents(events []*Event, filter EventFilter, page PageRequest) (*Page[*Event], error) {
+	k, err := newKeyset(page, eventSortColumns)
+	if err != nil {
+		return nil, err
+	}
+	// Validate the filter exactly like the SQL models do.
+	if _, err := filter.conditions(SQLite, nil, new(queryArgs)); err != nil {
+		return nil, err
+	}
+	var matched []*Event
+	for _, e := range events {
+		if filter.matches(e) {
+			matched = append(matched, copyEvent(e))
+		}
+	}
+	return pageOf(k, matched, eventSortKey(k), eventID), nil
+}
+
+// listOccurrences is the in-memory counterpart of listOccurrences. The
+// caller must hold the lock.
+func (s *memoryStore) listOccurrences(events []*Event, filter EventFilter, page PageRequest) (*Page[*Occurrence], error) {
+	w, err := newOccurrenceWindow(filter, page)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.filter.conditions(SQLite, nil, new(queryArgs)); err != nil {
+		return nil, err
+	}
+	var matched []*Event
+	var recurringIDs []int
+	for _, e := range events {
+		if w.filter.matches(e) && w.includes(e) {
+			matched = append(matched, copyEvent(e))
+			if e.RRule != "" {
+				recurringIDs = append(recurringIDs, e.ID)
+			}
+		}
+	}
+	return w.page(matched, s.overridesFor(recurringIDs))
+}
+
+// overridesFor copies the overrides of the given events. The caller must
+// hold the lock.
+func (s *memoryStore) overridesFor(eventIDs []int) map[int]map[string]*OccurrenceOverride {
+	out := map[int]map[string]*OccurrenceOverride{}
+	for _, id := range eventIDs {
+		for date, o := range s.overrides[id] {
+			if out[id] == nil {
+				out[id] = map[string]*OccurrenceOverride{}
+			}
+			out[id][date] = copyOverride(o)
+		}
+	}
+	return out
+}
+
+// allEvents returns the stored events ordered by id. The caller must hold
+// the lock.
+func (s *memoryStore) allEvents() []*Event {
+	events := make([]*Event, 0, len(s.events))
+	for _, id := range sortedIDs(s.events) {
+		events = append(events, s.events[id])
+	}
+	return events
+}
+
+func (m *memoryEvents) Insert(ctx context.Context, event *Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[event.OwnerId]; !ok {
+		return errForeignKey
+	}
+	if event.Timezone == "" {
+		event.Timezone = "UTC"
+	}
+	event.UpdatedAt = time.Now().UTC()
+	event.ID = nextID(m.s.events)
+
+	stored := copyEvent(event)
+	stored.StartsAt, stored.EndsAt = storedTime(event.StartsAt), storedTime(event.EndsAt)
+	stored.Sequence, stored.DeletedAt = 0, nil
+	m.s.events[stored.ID] = stored
+	return nil
+}
+
+func (m *memoryEvents) GetAll(ctx context.Context) ([]*Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	events := []*Event{}
+	for _, e := range m.s.allEvents() {
+		if e.DeletedAt == nil {
+			events = append(events, copyEvent(e))
+		}
+	}
+	return events, nil
+}
+
+func (m *memoryEvents) List(ctx context.Context, filter EventFilter, page PageRequest) (*Page[*Event], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+	return m.s.listEvents(m.s.allEvents(), filter, page)
+}
+
+func (m *memoryEvents) Get(ctx context.Context, id int) (*Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	e, ok := m.s.events[id]
+	if !ok || e.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	return copyEvent(e), nil
+}
+
+func (m *memoryEvents) GetWithDeleted(ctx context.Context, id int) (*Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	e, ok := m.s.events[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyEvent(e), nil
+}
+
+func (m *memoryEvents) Update(ctx context.Context, event *Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	stored, ok := m.s.events[event.ID]
+	if !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if event.Timezone == "" {
+		event.Timezone = "UTC"
+	}
+	event.UpdatedAt = time.Now().UTC()
+	event.Sequence = stored.Sequence + 1
+
+	c := copyEvent(event)
+	stored.Name, stored.Description, stored.Location = c.Name, c.Description, c.Location
+	stored.StartsAt, stored.EndsAt, stored.Timezone = storedTime(c.StartsAt), storedTime(c.EndsAt), c.Timezone
+	stored.Capacity, stored.RRule, stored.ExDates = c.Capacity, c.RRule, c.ExDates
+	stored.Sequence, stored.UpdatedAt = event.Sequence, event.UpdatedAt
+	m.s.promoteWaitlisted(event.ID)
+	return nil
+}
+
+func (m *memoryEvents) Delete(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	e, ok := m.s.events[id]
+	if !ok || e.DeletedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	e.DeletedAt, e.UpdatedAt = &now, now
+	e.Sequence++
+	return nil
+}
+
+func (m *memoryEvents) ListOccurrences(ctx context.Context, filter EventFilter, page PageRequest) (*Page[*Occurrence], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+	return m.s.listOccurrences(m.s.allEvents(), filter, page)
+}
+
+func (m *memoryEvents) SetOverride(ctx context.Context, o *OccurrenceOverride) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	e, ok := m.s.events[o.EventID]
+	if o.empty() {
+		if !ok {
+			return ErrNotFound
+		}
+		delete(m.s.overrides[o.EventID], o.OriginalDate)
+	} else {
+		if !ok {
+			return errForeignKey
+		}
+		c := copyOverride(o)
+		c.StartsAt, c.EndsAt = storedTimePtr(o.StartsAt), storedTimePtr(o.EndsAt)
+		if m.s.overrides[o.EventID] == nil {
+			m.s.overrides[o.EventID] = map[string]*OccurrenceOverride{}
+		}
+		m.s.overrides[o.EventID][o.OriginalDate] = c
+	}
+	e.Sequence++
+	e.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (m *memoryEvents) GetOverrides(ctx context.Context, eventIDs []int) (map[int]map[string]*OccurrenceOverride, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+	return m.s.overridesFor(eventIDs), nil
+}
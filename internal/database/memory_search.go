@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The in-memory search evaluates the expressions built by ftsQuery the way
+// FTS5 does, but ranks results by weighted hit counts instead of bm25 and
+// picks snippets by a simpler rule, so scores are not comparable with the
+// SQL model's.
+
+// searchColumnWeights are the bm25 weights of name, description and location.
+var searchColumnWeights = []float64{10, 2, 1}
+
+const snippetTokens = 12
+
+// searchToken is a word of an indexed column and where it is in the text.
+type searchToken struct {
+	word       string
+	start, end int
+}
+
+// searchTokens splits text into lower-cased runs of letters and digits, like
+// the unicode61 tokenizer.
+func searchTokens(text string) []searchToken {
+	var tokens []searchToken
+	start := -1
+	for i, r := range text + " " {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			tokens = append(tokens, searchToken{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	return tokens
+}
+
+// hits returns the indexes of the tokens matched by the term.
+func (t searchTerm) hits(tokens []searchToken) []int {
+	var out []int
+	for i := 0; i+len(t.words) <= len(tokens); i++ {
+		matched := true
+		for j, w := range t.words {
+			word := tokens[i+j].word
+			last := j == len(t.words)-1
+			if word != w && !(last && t.prefix && strings.HasPrefix(word, w)) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			for j := range t.words {
+				out = append(out, i+j)
+			}
+		}
+	}
+	return out
+}
+
+// highlight returns the text of tokens [from, to) as HTML, wrapping the
+// marked ones in <mark></mark>.
+func highlight(text string, tokens []searchToken, marked map[int]bool, from, to int) string {
+	var b strings.Builder
+	pos := tokens[from].start
+	for i := from; i < to; i++ {
+		t := tokens[i]
+		b.WriteString(html.EscapeString(text[pos:t.start]))
+		if marked[i] {
+			b.WriteString("<mark>" + html.EscapeString(text[t.start:t.end]) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(text[t.start:t.end]))
+		}
+		pos = t.end
+	}
+	return b.String()
+}
+
+func (m *memoryEvents) Search(ctx context.Context, q string, limit int) ([]*EventSearchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	match := ftsQuery(q)
+	if match == "" {
+		return nil, ErrInvalidSearch
+	}
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+	groups := parseSearch(match)
+
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	results := []*EventSearchResult{}
+	for _, e := range m.s.allEvents() {
+		if e.DeletedAt != nil {
+			continue
+		}
+		columns := []string{e.Name, e.Description, e.Location}
+		tokens := make([][]searchToken, len(columns))
+		for i, text := range columns {
+			tokens[i] = searchTokens(text)
+		}
+
+		found := false
+		marked := make([]map[int]bool, len(columns))
+		for i := range marked {
+			marked[i] = map[int]bool{}
+		}
+		for _, group := range groups {
+			all := len(group) > 0
+			groupHits := make([][]int, len(columns))
+			for _, term := range group {
+				matched := false
+				for i := range columns {
+					hits := term.hits(tokens[i])
+					groupHits[i] = append(groupHits[i], hits...)
+					matched = matched || len(hits) > 0
+				}
+				all = all && matched
+			}
+			if !all {
+				continue
+			}
+			found = true
+			for i, hits := range groupHits {
+				for _, h := range hits {
+					marked[i][h] = true
+				}
+			}
+		}
+		if !found {
+			continue
+		}
+
+		r := &EventSearchResult{Event: *copyEvent(e), NameHighlight: html.EscapeString(e.Name)}
+		best := -1
+		for i := range columns {
+			r.Score += searchColumnWeights[i] * float64(len(marked[i]))
+			if best < 0 || len(marked[i]) > len(marked[best]) {
+				best = i
+			}
+		}
+		if toks := tokens[0]; len(toks) > 0 {
+			r.NameHighlight = html.EscapeString(e.Name[:toks[0].start]) + highlight(e.Name, toks, marked[0], 0, len(toks)) + html.EscapeString(e.Name[toks[len(toks)-1].end:])
+		}
+		if toks := tokens[best]; len(toks) > 0 {
+			first := len(toks)
+			for h := range marked[best] {
+				first = min(first, h)
+			}
+			from := max(0, min(first, len(toks)-snippetTokens))
+			to := min(len(toks), from+snippetTokens)
+			r.Snippet = highlight(columns[best], toks, marked[best], from, to)
+			if from > 0 {
+				r.Snippet = "…" + r.Snippet
+			}
+			if to < len(toks) {
+				r.Snippet += "…"
+			}
+		}
+		results = append(results, r)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
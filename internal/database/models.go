@@ -1,17 +1,79 @@
 package database
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"time"
+)
 
 type Models struct {
-	Users     UserModel
-	Events    EventModel
-	Attendees AttendeeModel
+	Users          UserRepository
+	Events         EventRepository
+	Attendees      AttendeeRepository
+	Sessions       SessionRepository
+	RefreshTokens  RefreshTokenRepository
+	CalendarTokens CalendarTokenRepository
+
+	withTx func(ctx context.Context, fn func(tx Models) error) error
+}
+
+// Timeouts bound how long a single model method may spend in the database,
+// on top of whatever deadline the caller's context already has. Zero means
+// no limit of its own.
+type Timeouts struct {
+	Read   time.Duration
+	Write  time.Duration
+	Search time.Duration
+	// SlowQuery is how long a single statement may take before it is
+	// logged as slow; zero disables the log.
+	SlowQuery time.Duration
+}
+
+// DefaultTimeouts are the limits the models had before they were
+// configurable.
+var DefaultTimeouts = Timeouts{
+	Read:   3 * time.Second,
+	Write:  3 * time.Second,
+	Search: 3 * time.Second,
+}
+
+func (t Timeouts) read(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.Read)
+}
+
+func (t Timeouts) write(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.Write)
+}
+
+func (t Timeouts) search(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.Search)
+}
+
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// NewModels returns the SQL models for db, whose dialect is given by Open.
+func NewModels(db *sql.DB, dialect Dialect, timeouts Timeouts) Models {
+	return newModels(db, dialect, timeouts)
 }
 
-func NewModels(db *sql.DB) Models {
+func newModels(db DBTX, dialect Dialect, timeouts Timeouts) Models {
+	slow := timeouts.SlowQuery
 	return Models{
-		Users:     UserModel{DB: db},
-		Events:    EventModel{DB: db},
-		Attendees: AttendeeModel{DB: db},
+		Users:          &UserModel{DB: observe(db, dialect, "users", slow), Timeouts: timeouts},
+		Events:         &EventModel{DB: observe(db, dialect, "events", slow), Dialect: dialect, Timeouts: timeouts},
+		Attendees:      &AttendeeModel{DB: observe(db, dialect, "attendees", slow), Dialect: dialect, Timeouts: timeouts},
+		Sessions:       &SessionModel{DB: observe(db, dialect, "sessions", slow), Timeouts: timeouts},
+		RefreshTokens:  &RefreshTokenModel{DB: observe(db, dialect, "refresh_tokens", slow), Timeouts: timeouts},
+		CalendarTokens: &CalendarTokenModel{DB: observe(db, dialect, "calendar_tokens", slow), Timeouts: timeouts},
+		withTx: func(ctx context.Context, fn func(tx Models) error) error {
+			return runTx(ctx, db, dialect, func(tx DBTX) error {
+				return fn(newModels(tx, dialect, timeouts))
+			})
+		},
 	}
 }
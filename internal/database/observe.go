@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer traces the methods of the SQL models and the statements they run.
+var tracer = otel.Tracer("go-rest/internal/database")
+
+// startSpan starts the span of a model method, named after the model type
+// and the method, such as EventModel.Get. The statements the method runs
+// are traced as its children.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindInternal))
+}
+
+// queryDuration times the statements of the SQL models. Statements are
+// labelled by model and kind rather than by their text, which would make
+// too many series. Queries are timed until their first row is ready, see
+// observedDB.QueryContext.
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_query_duration_seconds",
+	Help:    "Duration of the database statements of each model, by statement kind.",
+	Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+}, []string{"model", "statement"})
+
+// observedDB is a DBTX that traces and times the statements of one model
+// and logs those that take longer than slowQuery, with the context of the
+// request they were made for. Their arguments are left out, as they
+// include password and token hashes.
+type observedDB struct {
+	DBTX
+	dialect   Dialect
+	model     string
+	slowQuery time.Duration
+}
+
+// observe wraps the database handle of model in an observedDB. A slowQuery
+// of zero disables the log.
+func observe(db DBTX, dialect Dialect, model string, slowQuery time.Duration) DBTX {
+	return observedDB{DBTX: db, dialect: dialect, model: model, slowQuery: slowQuery}
+}
+
+func (o observedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, s := o.start(ctx, query)
+	result, err := o.DBTX.ExecContext(ctx, query, args...)
+	s.end(err)
+	return result, err
+}
+
+// QueryContext records the query once the database has answered with its
+// first row. Reading the remaining rows is left out of the histogram, the
+// span and the slow query log, as DBTX hands out *sql.Rows, which cannot be
+// wrapped to notice Close; that time shows in the span of the model method.
+func (o observedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, s := o.start(ctx, query)
+	rows, err := o.DBTX.QueryContext(ctx, query, args...)
+	s.end(err)
+	return rows, err
+}
+
+func (o observedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, s := o.start(ctx, query)
+	row := o.DBTX.QueryRowContext(ctx, query, args...)
+	s.end(row.Err())
+	return row
+}
+
+// statement is a statement being run by an observedDB.
+type statement struct {
+	observedDB
+	ctx   context.Context
+	span  trace.Span
+	query string
+	kind  string
+	start time.Time
+}
+
+func (o observedDB) start(ctx context.Context, query string) (context.Context, statement) {
+	s := statement{observedDB: o, query: sanitize(query), kind: statementKind(query)}
+	system := semconv.DBSystemSqlite
+	if o.dialect == Postgres {
+		system = semconv.DBSystemPostgreSQL
+	}
+	s.ctx, s.span = tracer.Start(ctx, strings.ToUpper(s.kind), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		system,
+		semconv.DBOperationName(s.kind),
+		semconv.DBQueryText(s.query),
+		attribute.String("db.model", o.model),
+	))
+	s.start = time.Now()
+	return s.ctx, s
+}
+
+// end records the statement once it has run, err being its error.
+func (s statement) end(err error) {
+	d := time.Since(s.start)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+	queryDuration.WithLabelValues(s.model, s.kind).Observe(d.Seconds())
+	if s.slowQuery > 0 && d >= s.slowQuery {
+		slog.WarnContext(s.ctx, "Slow query", "model", s.model, "sql", s.query, "duration_ms", float64(d.Microseconds())/1000)
+	}
+}
+
+// sanitize returns query on a single line. Queries take their values as
+// arguments, which are never recorded, so their text holds no data.
+func sanitize(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// statementKind returns the leading keyword of query in lower case, such
+// as select or insert.
+func statementKind(query string) string {
+	kind, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	return strings.ToLower(strings.TrimSpace(kind))
+}
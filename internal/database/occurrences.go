@@ -0,0 +1,336 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"go-rest/internal/recurrence"
+	"strings"
+	"time"
+)
+
+// OccurrenceOverride changes or cancels a single occurrence of a recurring
+// event, identified by the date the series would have put it on. Nil fields
+// keep the series' value.
+type OccurrenceOverride struct {
+	EventID      int        `json:"event_id"`
+	OriginalDate string     `json:"original_date"`
+	Cancelled    bool       `json:"cancelled"`
+	Name         *string    `json:"name,omitempty"`
+	Description  *string    `json:"description,omitempty"`
+	StartsAt     *time.Time `json:"starts_at,omitempty"`
+	EndsAt       *time.Time `json:"ends_at,omitempty"`
+	Location     *string    `json:"location,omitempty"`
+}
+
+func (o *OccurrenceOverride) empty() bool {
+	return !o.Cancelled && o.Name == nil && o.Description == nil && o.StartsAt == nil && o.EndsAt == nil && o.Location == nil
+}
+
+// Occurrence is a single instance of an event. For a one-off event it is
+// the event itself; for a recurring one StartsAt and EndsAt are the times of
+// this instance and OriginalDate, the local date the series puts it on,
+// identifies it within the series.
+type Occurrence struct {
+	Event
+	OriginalDate string `json:"original_date"`
+	Overridden   bool   `json:"overridden,omitempty"`
+	Cancelled    bool   `json:"cancelled,omitempty"`
+}
+
+// RecurrenceSet returns the series the event describes, or nil if it is not
+// a recurring event.
+func (e *Event) RecurrenceSet() (*recurrence.Set, error) {
+	if e.RRule == "" {
+		return nil, nil
+	}
+	rule, err := recurrence.Parse(e.RRule)
+	if err != nil {
+		return nil, err
+	}
+	loc := e.Zone()
+	set := &recurrence.Set{DTStart: e.StartsAt.In(loc), Rule: rule}
+	for _, d := range e.ExDates {
+		t, err := time.ParseInLocation("2006-01-02", d, loc)
+		if err != nil {
+			return nil, err
+		}
+		set.ExDates = append(set.ExDates, t)
+	}
+	return set, nil
+}
+
+// OccurrenceOn returns the start of the occurrence the series puts on the
+// given date, ignoring overrides, or nil if there is none. date must be
+// midnight in the event's timezone.
+func (e *Event) OccurrenceOn(date time.Time) (*time.Time, error) {
+	set, err := e.RecurrenceSet()
+	if err != nil || set == nil {
+		return nil, err
+	}
+	occurrences := set.Between(date, date.AddDate(0, 0, 1))
+	if len(occurrences) == 0 {
+		return nil, nil
+	}
+	return &occurrences[0], nil
+}
+
+// SetOverride stores the override for one occurrence, replacing any earlier
+// one. An override that neither cancels nor changes anything is removed.
+// Either way the event counts as changed.
+func (m *EventModel) SetOverride(ctx context.Context, o *OccurrenceOverride) error {
+	ctx, span := startSpan(ctx, "EventModel.SetOverride")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
+	defer cancel()
+
+	tx, err := begin(ctx, m.DB, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if o.empty() {
+		query := "DELETE FROM event_occurrence_overrides WHERE event_id = $1 AND original_date = $2"
+		_, err = tx.ExecContext(ctx, query, o.EventID, o.OriginalDate)
+	} else {
+		query := `INSERT INTO event_occurrence_overrides (event_id, original_date, cancelled, name, description, starts_at, ends_at, location)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (event_id, original_date) DO UPDATE SET
+				cancelled = excluded.cancelled, name = excluded.name, description = excluded.description,
+				starts_at = excluded.starts_at, ends_at = excluded.ends_at, location = excluded.location`
+		_, err = tx.ExecContext(ctx, query, o.EventID, o.OriginalDate, o.Cancelled, o.Name, o.Description,
+			m.Dialect.eventTimePtr(o.StartsAt), m.Dialect.eventTimePtr(o.EndsAt), o.Location)
+	}
+	if err != nil {
+		return translate(err)
+	}
+	query := "UPDATE events SET sequence = sequence + 1, updated_at = $1 WHERE id = $2"
+	result, err := tx.ExecContext(ctx, query, time.Now().UTC(), o.EventID)
+	if err != nil {
+		return err
+	}
+	if err := expectRow(result); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetOverrides returns the overrides of the given events keyed by event id
+// and original date.
+func (m *EventModel) GetOverrides(ctx context.Context, eventIDs []int) (map[int]map[string]*OccurrenceOverride, error) {
+	ctx, span := startSpan(ctx, "EventModel.GetOverrides")
+	defer span.End()
+	ctx, cancel := m.Timeouts.read(ctx)
+	defer cancel()
+	return overridesFor(ctx, m.DB, eventIDs)
+}
+
+// overridesFor loads the overrides of the given events keyed by event id and
+// original date.
+func overridesFor(ctx context.Context, db DBTX, eventIDs []int) (map[int]map[string]*OccurrenceOverride, error) {
+	out := map[int]map[string]*OccurrenceOverride{}
+	if len(eventIDs) == 0 {
+		return out, nil
+	}
+	var args queryArgs
+	placeholders := make([]string, len(eventIDs))
+	for i, id := range eventIDs {
+		placeholders[i] = args.add(id)
+	}
+	query := "SELECT event_id, original_date, cancelled, name, description, starts_at, ends_at, location FROM event_occurrence_overrides WHERE event_id IN (" + strings.Join(placeholders, ", ") + ")"
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o OccurrenceOverride
+		if err := rows.Scan(&o.EventID, &o.OriginalDate, &o.Cancelled, &o.Name, &o.Description, &o.StartsAt, &o.EndsAt, &o.Location); err != nil {
+			return nil, err
+		}
+		if out[o.EventID] == nil {
+			out[o.EventID] = map[string]*OccurrenceOverride{}
+		}
+		out[o.EventID][o.OriginalDate] = &o
+	}
+	return out, rows.Err()
+}
+
+// ListOccurrences expands the events matching the filter into their
+// occurrences between filter.From and filter.To, which are both required,
+// and returns one page of them ordered by start. Only "starts_at" (or its
+// older name "date") is accepted as the sort field.
+func (m *EventModel) ListOccurrences(ctx context.Context, filter EventFilter, page PageRequest) (*Page[*Occurrence], error) {
+	ctx, span := startSpan(ctx, "EventModel.ListOccurrences")
+	defer span.End()
+	ctx, cancel := m.Timeouts.read(ctx)
+	defer cancel()
+	return listOccurrences(ctx, m.DB, m.Dialect, "", nil, nil, filter, page)
+}
+
+// listOccurrences is the occurrence counterpart of listEvents. Expansion
+// happens in memory, so the window should be kept reasonably small.
+func listOccurrences(ctx context.Context, db DBTX, d Dialect, join string, conds []string, args queryArgs, filter EventFilter, page PageRequest) (*Page[*Occurrence], error) {
+	w, err := newOccurrenceWindow(filter, page)
+	if err != nil {
+		return nil, err
+	}
+	conds, err = w.filter.conditions(d, conds, &args)
+	if err != nil {
+		return nil, err
+	}
+	conds = append(conds, fmt.Sprintf("((e.rrule IS NULL AND e.starts_at >= %s AND e.starts_at < %s) OR (e.rrule IS NOT NULL AND e.starts_at < %s))",
+		args.add(d.date(w.from)), args.add(d.date(w.to)), args.add(d.date(w.to))))
+
+	query := "SELECT " + eventColumns + " FROM events e" + join + whereClause(conds)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var events []*Event
+	for rows.Next() {
+		var event Event
+		if err := rows.Scan(event.fields()...); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var recurringIDs []int
+	for _, e := range events {
+		if e.RRule != "" {
+			recurringIDs = append(recurringIDs, e.ID)
+		}
+	}
+	overrides, err := overridesFor(ctx, db, recurringIDs)
+	if err != nil {
+		return nil, err
+	}
+	return w.page(events, overrides)
+}
+
+// occurrenceWindow is a validated occurrence listing: the dates [from, to)
+// to expand events in and the rest of the filter.
+type occurrenceWindow struct {
+	k        *keyset
+	from, to time.Time
+	filter   EventFilter
+}
+
+func newOccurrenceWindow(filter EventFilter, page PageRequest) (*occurrenceWindow, error) {
+	if page.Sort != "" && page.Sort != "starts_at" && page.Sort != "date" {
+		return nil, fmt.Errorf("%w %q", ErrInvalidSort, page.Sort)
+	}
+	page.Sort = "starts_at"
+	k, err := newKeyset(page, map[string]string{"id": "id", "starts_at": "starts_at"})
+	if err != nil {
+		return nil, err
+	}
+	from, err := time.Parse("2006-01-02", filter.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from date %q", filter.From)
+	}
+	to, err := time.Parse("2006-01-02", filter.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to date %q", filter.To)
+	}
+	// One-off events must start inside the window; a series only has to
+	// start before its end; see includes.
+	filter.From, filter.To = "", ""
+	return &occurrenceWindow{k: k, from: from, to: to.AddDate(0, 0, 1), filter: filter}, nil
+}
+
+// includes reports whether an event matching the rest of the filter may
+// have occurrences in the window.
+func (w *occurrenceWindow) includes(e *Event) bool {
+	start := dbTime(e.StartsAt)
+	if start >= w.to.Format("2006-01-02") {
+		return false
+	}
+	return e.RRule != "" || start >= w.from.Format("2006-01-02")
+}
+
+// page expands the events and returns the requested page of occurrences.
+func (w *occurrenceWindow) page(events []*Event, overrides map[int]map[string]*OccurrenceOverride) (*Page[*Occurrence], error) {
+	var all []*Occurrence
+	for _, e := range events {
+		occurrences, err := expandEvent(e, overrides[e.ID], w.from, w.to)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, occurrences...)
+	}
+	sortKey := func(o *Occurrence) string { return dbTime(o.StartsAt) + "/" + o.OriginalDate }
+	return pageOf(w.k, all, sortKey, func(o *Occurrence) int { return o.ID }), nil
+}
+
+// expandEvent returns the occurrences of an event in [from, to) with its
+// overrides applied. An override that moves an occurrence counts where the
+// occurrence ends up, not where the series put it.
+func expandEvent(e *Event, overrides map[string]*OccurrenceOverride, from, to time.Time) ([]*Occurrence, error) {
+	set, err := e.RecurrenceSet()
+	if err != nil {
+		return nil, fmt.Errorf("event %d: %w", e.ID, err)
+	}
+	loc := e.Zone()
+	if set == nil {
+		return []*Occurrence{{Event: *e, OriginalDate: e.StartsAt.In(loc).Format("2006-01-02")}}, nil
+	}
+
+	duration := e.EndsAt.Sub(e.StartsAt)
+	inWindow := func(t time.Time) bool { return !t.Before(from) && t.Before(to) }
+	var out []*Occurrence
+	add := func(t time.Time) {
+		o := &Occurrence{Event: *e, OriginalDate: t.Format("2006-01-02")}
+		o.StartsAt, o.EndsAt = t, t.Add(duration)
+		if ov, ok := overrides[o.OriginalDate]; ok {
+			if ov.StartsAt != nil {
+				if !inWindow(*ov.StartsAt) {
+					return
+				}
+				o.StartsAt = *ov.StartsAt
+				o.EndsAt = ov.StartsAt.Add(duration)
+			}
+			if ov.EndsAt != nil {
+				o.EndsAt = *ov.EndsAt
+			}
+			if ov.Name != nil {
+				o.Name = *ov.Name
+			}
+			if ov.Description != nil {
+				o.Description = *ov.Description
+			}
+			if ov.Location != nil {
+				o.Location = *ov.Location
+			}
+			o.Cancelled = ov.Cancelled
+			o.Overridden = true
+		}
+		out = append(out, o)
+	}
+
+	seen := map[string]bool{}
+	for _, t := range set.Between(from, to) {
+		seen[t.Format("2006-01-02")] = true
+		add(t)
+	}
+	// Occurrences moved into the window from outside it.
+	for original, ov := range overrides {
+		if ov.StartsAt == nil || seen[original] || !inWindow(*ov.StartsAt) {
+			continue
+		}
+		day, err := time.ParseInLocation("2006-01-02", original, loc)
+		if err != nil {
+			continue
+		}
+		if occurrences := set.Between(day, day.AddDate(0, 0, 1)); len(occurrences) > 0 {
+			add(occurrences[0])
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+var (
+	// ErrInvalidCursor is returned when a cursor cannot be decoded or was
+	// issued for a different sort order than the one requested.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidSort is returned when a listing cannot be sorted by the
+	// requested field.
+	ErrInvalidSort = errors.New("invalid sort field")
+)
+
+// PageRequest describes one page of a keyset-paginated listing. Sort names a
+// column from the listing's whitelist; an empty Sort means "id".
+type PageRequest struct {
+	Limit  int
+	Cursor string
+	Sort   string
+	Desc   bool
+}
+
+// Page is a single page of results. NextCursor is empty on the last page.
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int    `json:"total"`
+}
+
+type cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// queryArgs collects positional arguments while a query is being built and
+// hands out the matching $n placeholder for each one.
+type queryArgs []any
+
+func (a *queryArgs) add(v any) string {
+	*a = append(*a, v)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// keyset is the resolved sort of a page: the SQL column to order by, the
+// direction and, when continuing from a cursor, the position to resume at.
+type keyset struct {
+	sort   string
+	column string
+	idCol  string
+	desc   bool
+	after  *cursor
+	limit  int
+}
+
+// newKeyset validates page against the allowed sort columns. columns maps API
+// sort names to SQL expressions and must contain "id".
+func newKeyset(page PageRequest, columns map[string]string) (*keyset, error) {
+	sort := page.Sort
+	if sort == "" {
+		sort = "id"
+	}
+	column, ok := columns[sort]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrInvalidSort, sort)
+	}
+	limit := page.Limit
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+	k := &keyset{sort: sort, column: column, idCol: columns["id"], desc: page.Desc, limit: limit}
+	if page.Cursor != "" {
+		c, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != sort || c.Desc != page.Desc {
+			return nil, ErrInvalidCursor
+		}
+		k.after = c
+	}
+	return k, nil
+}
+
+// where returns the condition selecting the rows after the cursor, or an
+// empty string on the first page.
+func (k *keyset) where(args *queryArgs) string {
+	if k.after == nil {
+		return ""
+	}
+	op := ">"
+	if k.desc {
+		op = "<"
+	}
+	if k.column == k.idCol {
+		return fmt.Sprintf("%s %s %s", k.idCol, op, args.add(k.after.ID))
+	}
+	return fmt.Sprintf("(%s %s %s OR (%s = %s AND %s %s %s))",
+		k.column, op, args.add(k.after.Value),
+		k.column, args.add(k.after.Value),
+		k.idCol, op, args.add(k.after.ID))
+}
+
+// orderBy returns the ORDER BY/LIMIT tail. One extra row is fetched so the
+// caller can tell whether there is a next page.
+func (k *keyset) orderBy() string {
+	dir := "ASC"
+	if k.desc {
+		dir = "DESC"
+	}
+	if k.column == k.idCol {
+		return fmt.Sprintf(" ORDER BY %s %s LIMIT %d", k.idCol, dir, k.limit+1)
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT %d", k.column, dir, k.idCol, dir, k.limit+1)
+}
+
+// sortKey is the expression selected alongside each row so the cursor can be
+// built from the raw column value.
+func (k *keyset) sortKey() string {
+	return fmt.Sprintf("CAST(%s AS TEXT)", k.column)
+}
+
+// next returns the cursor for the page following rows whose last sort key and
+// id are given, or "" if there are no more rows.
+func (k *keyset) next(fetched int, lastValue string, lastID int) string {
+	if fetched <= k.limit {
+		return ""
+	}
+	return encodeCursor(cursor{Sort: k.sort, Desc: k.desc, Value: lastValue, ID: lastID})
+}
+
+// pageOf pages through items held in memory the way the SQL listings do:
+// sorted by key, which must match sortKey's text form of the column, then by
+// id, and resumed after the cursor. Total counts all items.
+func pageOf[T any](k *keyset, items []T, key func(T) string, id func(T) int) *Page[T] {
+	less := func(a, b T) bool {
+		if k.column != k.idCol {
+			if ka, kb := key(a), key(b); ka != kb {
+				return (ka < kb) != k.desc
+			}
+		}
+		return (id(a) < id(b)) != k.desc
+	}
+	sorted := append([]T(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+
+	start := 0
+	if c := k.after; c != nil {
+		start = sort.Search(len(sorted), func(i int) bool {
+			kv, iv := c.Value, id(sorted[i])
+			if k.column != k.idCol {
+				if ki := key(sorted[i]); ki != kv {
+					return (ki > kv) != k.desc
+				}
+			}
+			if k.desc {
+				return iv < c.ID
+			}
+			return iv > c.ID
+		})
+	}
+	end := min(start+k.limit, len(sorted))
+	page := &Page[T]{Data: append([]T{}, sorted[start:end]...), Total: len(items)}
+	if end < len(sorted) && end > start {
+		last := sorted[end-1]
+		page.NextCursor = encodeCursor(cursor{Sort: k.sort, Desc: k.desc, Value: key(last), ID: id(last)})
+	}
+	return page
+}
+
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
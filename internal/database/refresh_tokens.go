@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type RefreshTokenModel struct {
+	DB       DBTX
+	Timeouts Timeouts
+}
+
+// RefreshToken is a single-use token belonging to a session. Only the SHA-256
+// hash of the token is stored.
+type RefreshToken struct {
+	ID        int
+	SessionID int
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// Insert inserts a new refresh token into the database
+func (m *RefreshTokenModel) Insert(ctx context.Context, token *RefreshToken) error {
+	ctx, span := startSpan(ctx, "RefreshTokenModel.Insert")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
+	defer cancel()
+
+	token.CreatedAt = time.Now().UTC()
+	query := "INSERT INTO refresh_tokens (session_id, token_hash, created_at, expires_at) VALUES ($1, $2, $3, $4) RETURNING id"
+	return translate(m.DB.QueryRowContext(ctx, query, token.SessionID, token.TokenHash, token.CreatedAt, token.ExpiresAt).Scan(&token.ID))
+}
+
+// GetByHash gets a refresh token by the hash of its value
+func (m *RefreshTokenModel) GetByHash(ctx context.Context, hash string) (*RefreshToken, error) {
+	ctx, span := startSpan(ctx, "RefreshTokenModel.GetByHash")
+	defer span.End()
+	ctx, cancel := m.Timeouts.read(ctx)
+	defer cancel()
+
+	query := "SELECT id, session_id, token_hash, created_at, expires_at, used_at FROM refresh_tokens WHERE token_hash = $1"
+	var token RefreshToken
+	var usedAt sql.NullTime
+	err := m.DB.QueryRowContext(ctx, query, hash).Scan(&token.ID, &token.SessionID, &token.TokenHash, &token.CreatedAt, &token.ExpiresAt, &usedAt)
+	if err != nil {
+		return nil, translate(err)
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return &token, nil
+}
+
+// MarkUsed marks a refresh token as used. It reports false when the token had
+// already been used, which lets concurrent refreshes of the same token be
+// detected as reuse, and ErrNotFound when there is no such token.
+func (m *RefreshTokenModel) MarkUsed(ctx context.Context, id int) (bool, error) {
+	ctx, span := startSpan(ctx, "RefreshTokenModel.MarkUsed")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
+	defer cancel()
+
+	query := "UPDATE refresh_tokens SET used_at = $1 WHERE id = $2 AND used_at IS NULL"
+	result, err := m.DB.ExecContext(ctx, query, time.Now().UTC(), id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rows == 0 {
+		var exists bool
+		query := "SELECT EXISTS (SELECT 1 FROM refresh_tokens WHERE id = $1)"
+		if err := m.DB.QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+			return false, err
+		}
+		if !exists {
+			return false, ErrNotFound
+		}
+	}
+	return rows == 1, nil
+}
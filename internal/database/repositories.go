@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// The repositories below are what the API depends on. The *Model types
+// implement them on top of SQL and NewMemoryModels provides an in-memory
+// implementation with the same behaviour for tests; the conformance package
+// checks that both agree. Every method takes the context of the request it
+// serves, so that a query is cancelled when its client goes away; errors
+// caused by that cancellation wrap context.Canceled or
+// context.DeadlineExceeded.
+//
+// A method that reads, changes or deletes a row that does not exist returns
+// ErrNotFound. Writes that break a constraint return an Error wrapping
+// ErrDuplicate or ErrForeignKey, and transactions that keep colliding with
+// concurrent ones one wrapping ErrConflict.
+
+type UserRepository interface {
+	// Insert adds a user, defaulting its role to organizer. A taken
+	// username or email is ErrDuplicate, with the Field of the Error naming
+	// which.
+	Insert(ctx context.Context, user *User) error
+	GetUser(ctx context.Context, id int) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	UpdateRole(ctx context.Context, id int, role string) error
+}
+
+type EventRepository interface {
+	Insert(ctx context.Context, event *Event) error
+	GetAll(ctx context.Context) ([]*Event, error)
+	List(ctx context.Context, filter EventFilter, page PageRequest) (*Page[*Event], error)
+	// Get returns ErrNotFound for deleted events too, GetWithDeleted
+	// returns them.
+	Get(ctx context.Context, id int) (*Event, error)
+	GetWithDeleted(ctx context.Context, id int) (*Event, error)
+	// Update returns ErrNotFound if the event has been deleted.
+	Update(ctx context.Context, event *Event) error
+	Delete(ctx context.Context, id int) error
+	Search(ctx context.Context, q string, limit int) ([]*EventSearchResult, error)
+	ListOccurrences(ctx context.Context, filter EventFilter, page PageRequest) (*Page[*Occurrence], error)
+	SetOverride(ctx context.Context, o *OccurrenceOverride) error
+	GetOverrides(ctx context.Context, eventIDs []int) (map[int]map[string]*OccurrenceOverride, error)
+}
+
+type AttendeeRepository interface {
+	// Insert returns ErrNotFound if the event does not exist or has been
+	// deleted, and ErrDuplicate of event_id if the user already attends it.
+	Insert(ctx context.Context, attendee *Attendee) (*Attendee, error)
+	SetRSVP(ctx context.Context, eventID int, userID int, rsvp string) (*Attendee, error)
+	GetByEventAndAttendee(ctx context.Context, eventID int, userID int) (*Attendee, error)
+	GetAttendeesByEvent(ctx context.Context, eventId int, page PageRequest) (*Page[*EventAttendee], error)
+	Delete(ctx context.Context, eventId int, userId int) error
+	GetEventsByAttendee(ctx context.Context, attendeeId int, filter EventFilter, page PageRequest) (*Page[*Event], error)
+	GetOccurrencesByAttendee(ctx context.Context, attendeeId int, filter EventFilter, page PageRequest) (*Page[*Occurrence], error)
+}
+
+type SessionRepository interface {
+	Insert(ctx context.Context, session *Session) error
+	Get(ctx context.Context, id int) (*Session, error)
+	Revoke(ctx context.Context, id int) error
+	RevokeAllForUser(ctx context.Context, userID int) error
+	// DeleteEnded deletes the sessions that expired or were revoked before
+	// the given time, with their refresh tokens, and returns how many.
+	DeleteEnded(ctx context.Context, before time.Time) (int, error)
+}
+
+type RefreshTokenRepository interface {
+	Insert(ctx context.Context, token *RefreshToken) error
+	GetByHash(ctx context.Context, hash string) (*RefreshToken, error)
+	// MarkUsed reports false if the token had already been used.
+	MarkUsed(ctx context.Context, id int) (bool, error)
+}
+
+type CalendarTokenRepository interface {
+	Set(ctx context.Context, userID int, tokenHash string) error
+	GetUserID(ctx context.Context, tokenHash string) (int, error)
+	Delete(ctx context.Context, userID int) error
+}
+
+var (
+	_ UserRepository          = (*UserModel)(nil)
+	_ EventRepository         = (*EventModel)(nil)
+	_ AttendeeRepository      = (*AttendeeModel)(nil)
+	_ SessionRepository       = (*SessionModel)(nil)
+	_ RefreshTokenRepository  = (*RefreshTokenModel)(nil)
+	_ CalendarTokenRepository = (*CalendarTokenModel)(nil)
+)
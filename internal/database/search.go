@@ -0,0 +1,216 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidSearch is returned when a search query contains no terms.
+var ErrInvalidSearch = errors.New("search query must contain at least one word")
+
+// EventSearchResult is an event matched by a full-text search. Highlighted
+// fields are HTML: the text is escaped and the matched terms are wrapped in
+// <mark></mark>. A higher Score is a better match.
+type EventSearchResult struct {
+	Event
+	Score         float64 `json:"score"`
+	NameHighlight string  `json:"name_highlight"`
+	Snippet       string  `json:"snippet"`
+}
+
+// The SQL highlight functions insert these private-use characters around
+// matches, which markHighlight turns into <mark></mark> once the text has
+// been escaped. Marking with the tags directly would leave the text
+// unescaped.
+const (
+	markStart = "\uE000"
+	markEnd   = "\uE001"
+)
+
+var highlightMarks = strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>")
+
+// markHighlight turns text highlighted by the database into HTML.
+func markHighlight(text string) string {
+	return highlightMarks.Replace(html.EscapeString(text))
+}
+
+// Search runs a full-text search over the name, description and location of
+// events and returns the best matches first. See ftsQuery for the accepted
+// query syntax. SQLite uses FTS5; PostgreSQL uses the search column, and its
+// scores and snippets differ somewhat.
+func (m *EventModel) Search(ctx context.Context, q string, limit int) ([]*EventSearchResult, error) {
+	ctx, span := startSpan(ctx, "EventModel.Search")
+	defer span.End()
+	ctx, cancel := m.Timeouts.search(ctx)
+	defer cancel()
+
+	match := ftsQuery(q)
+	if match == "" {
+		return nil, ErrInvalidSearch
+	}
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+
+	query := `SELECT ` + eventColumns + `,
+			-bm25(events_fts, 10.0, 2.0, 1.0) AS score,
+			highlight(events_fts, 0, '` + markStart + `', '` + markEnd + `'),
+			snippet(events_fts, -1, '` + markStart + `', '` + markEnd + `', '…', 12)
+		FROM events_fts
+		JOIN events e ON e.id = events_fts.rowid
+		WHERE events_fts MATCH $1 AND e.deleted_at IS NULL
+		ORDER BY score DESC, e.id
+		LIMIT $2`
+	if m.Dialect == Postgres {
+		// The search column weighs name, description and location as A, B
+		// and C; ts_rank takes the weights of D to A.
+		query = `SELECT ` + eventColumns + `,
+				ts_rank('{0.1, 0.1, 0.2, 1.0}', e.search, q) AS score,
+				ts_headline('simple', e.name, q, 'StartSel=` + markStart + `, StopSel=` + markEnd + `, HighlightAll=true'),
+				ts_headline('simple', e.description, q, 'StartSel=` + markStart + `, StopSel=` + markEnd + `, MaxWords=12, MinWords=6')
+			FROM events e, to_tsquery('simple', $1) q
+			WHERE e.search @@ q AND e.deleted_at IS NULL
+			ORDER BY score DESC, e.id
+			LIMIT $2`
+		match = tsQuery(match)
+	}
+	rows, err := m.DB.QueryContext(ctx, query, match, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*EventSearchResult{}
+	for rows.Next() {
+		var r EventSearchResult
+		err := rows.Scan(r.fields(&r.Score, &r.NameHighlight, &r.Snippet)...)
+		if err != nil {
+			return nil, err
+		}
+		r.NameHighlight, r.Snippet = markHighlight(r.NameHighlight), markHighlight(r.Snippet)
+		results = append(results, &r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ftsQuery turns user input into a safe FTS5 MATCH expression. Words are
+// matched individually and must all be present, "double quoted text" is
+// matched as a phrase, a trailing * makes a word a prefix query and a bare OR
+// between terms makes either of them sufficient. Anything else FTS5 would
+// interpret as syntax is quoted away.
+func ftsQuery(q string) string {
+	var terms []string
+	for len(q) > 0 {
+		q = strings.TrimLeftFunc(q, unicode.IsSpace)
+		if q == "" {
+			break
+		}
+		if q[0] == '"' {
+			end := strings.IndexByte(q[1:], '"')
+			phrase := q[1:]
+			q = ""
+			if end >= 0 {
+				phrase, q = phrase[:end], phrase[end+1:]
+			}
+			if term := ftsTerm(phrase, false); term != "" {
+				terms = append(terms, term)
+			}
+			continue
+		}
+		end := strings.IndexFunc(q, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+		word := q
+		q = ""
+		if end >= 0 {
+			word, q = word[:end], word[end:]
+		}
+		if word == "OR" {
+			if len(terms) > 0 && terms[len(terms)-1] != "OR" {
+				terms = append(terms, "OR")
+			}
+			continue
+		}
+		prefix := strings.HasSuffix(word, "*")
+		if term := ftsTerm(strings.TrimRight(word, "*"), prefix); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) > 0 && terms[len(terms)-1] == "OR" {
+		terms = terms[:len(terms)-1]
+	}
+	return strings.Join(terms, " ")
+}
+
+// searchTerm is a quoted phrase of an FTS5 expression.
+type searchTerm struct {
+	words  []string
+	prefix bool
+}
+
+// parseSearch parses the output of ftsQuery into groups of terms that must
+// all match, any group being sufficient.
+func parseSearch(match string) [][]searchTerm {
+	groups := [][]searchTerm{nil}
+	for len(match) > 0 {
+		match = strings.TrimLeft(match, " ")
+		if strings.HasPrefix(match, "OR") {
+			groups = append(groups, nil)
+			match = match[2:]
+			continue
+		}
+		end := strings.IndexByte(match[1:], '"') + 1
+		term := searchTerm{words: strings.Fields(strings.ToLower(match[1:end]))}
+		match = match[end+1:]
+		if strings.HasPrefix(match, "*") {
+			term.prefix = true
+			match = match[1:]
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], term)
+	}
+	return groups
+}
+
+// tsQuery translates an FTS5 expression built by ftsQuery into a
+// PostgreSQL tsquery.
+func tsQuery(match string) string {
+	var groups []string
+	for _, group := range parseSearch(match) {
+		terms := make([]string, len(group))
+		for i, term := range group {
+			words := make([]string, len(term.words))
+			for j, w := range term.words {
+				words[j] = "'" + w + "'"
+			}
+			if term.prefix {
+				words[len(words)-1] += ":*"
+			}
+			terms[i] = "(" + strings.Join(words, " <-> ") + ")"
+		}
+		groups = append(groups, "("+strings.Join(terms, " & ")+")")
+	}
+	return strings.Join(groups, " | ")
+}
+
+// ftsTerm quotes text as an FTS5 string, keeping only letters, digits and
+// spaces so the tokenizer sees the same words the index was built from.
+func ftsTerm(text string, prefix bool) string {
+	cleaned := strings.Join(strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+	if cleaned == "" {
+		return ""
+	}
+	term := `"` + cleaned + `"`
+	if prefix {
+		term += "*"
+	}
+	return term
+}
@@ -0,0 +1,20 @@
+package database
+
+import "testing"
+
+func TestMarkHighlight(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Go " + markStart + "meetup" + markEnd, "Go <mark>meetup</mark>"},
+		{
+			`<script>alert("xss")</script> & ` + markStart + "Blues" + markEnd,
+			`&lt;script&gt;alert(&#34;xss&#34;)&lt;/script&gt; &amp; <mark>Blues</mark>`,
+		},
+		// Markup inside a match is escaped too.
+		{markStart + "<b>" + markEnd + "old", "<mark>&lt;b&gt;</mark>old"},
+	}
+	for _, tt := range tests {
+		if got := markHighlight(tt.in); got != tt.want {
+			t.Errorf("markHighlight(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
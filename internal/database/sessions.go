@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type SessionModel struct {
+	DB       DBTX
+	Timeouts Timeouts
+}
+
+// Session is a login session. Every refresh token rotated from the same
+// login belongs to one session, so revoking the session kills the whole
+// token family.
+type Session struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the session is neither revoked nor expired.
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// Insert inserts a new session into the database
+func (m *SessionModel) Insert(ctx context.Context, session *Session) error {
+	ctx, span := startSpan(ctx, "SessionModel.Insert")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
+	defer cancel()
+
+	session.CreatedAt = time.Now().UTC()
+	query := "INSERT INTO sessions (user_id, created_at, expires_at) VALUES ($1, $2, $3) RETURNING id"
+	return translate(m.DB.QueryRowContext(ctx, query, session.UserID, session.CreatedAt, session.ExpiresAt).Scan(&session.ID))
+}
+
+// Get gets a session by id from the database
+func (m *SessionModel) Get(ctx context.Context, id int) (*Session, error) {
+	ctx, span := startSpan(ctx, "SessionModel.Get")
+	defer span.End()
+	ctx, cancel := m.Timeouts.read(ctx)
+	defer cancel()
+
+	query := "SELECT id, user_id, created_at, expires_at, revoked_at FROM sessions WHERE id = $1"
+	var session Session
+	var revokedAt sql.NullTime
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.ExpiresAt, &revokedAt)
+	if err != nil {
+		return nil, translate(err)
+	}
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return &session, nil
+}
+
+// Revoke revokes a single session. Revoking it again keeps the time it was
+// first revoked.
+func (m *SessionModel) Revoke(ctx context.Context, id int) error {
+	ctx, span := startSpan(ctx, "SessionModel.Revoke")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
+	defer cancel()
+
+	query := "UPDATE sessions SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2"
+	result, err := m.DB.ExecContext(ctx, query, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+// RevokeAllForUser revokes every session belonging to a user
+func (m *SessionModel) RevokeAllForUser(ctx context.Context, userID int) error {
+	ctx, span := startSpan(ctx, "SessionModel.RevokeAllForUser")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
+	defer cancel()
+
+	query := "UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL"
+	_, err := m.DB.ExecContext(ctx, query, time.Now().UTC(), userID)
+	return err
+}
+
+// DeleteEnded deletes the sessions that expired or were revoked before the
+// given time; their refresh tokens go with them by cascade.
+func (m *SessionModel) DeleteEnded(ctx context.Context, before time.Time) (int, error) {
+	ctx, span := startSpan(ctx, "SessionModel.DeleteEnded")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
+	defer cancel()
+
+	query := "DELETE FROM sessions WHERE expires_at < $1 OR revoked_at < $1"
+	result, err := m.DB.ExecContext(ctx, query, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DBTX is what the SQL models need from a database handle. *sql.DB and
+// *sql.Tx both provide it, so the same model works on its own or inside
+// Models.WithTx.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// maxTxAttempts is how often WithTx runs a transaction that keeps
+// conflicting with others before giving up.
+const maxTxAttempts = 5
+
+// WithTx runs fn with models whose methods all belong to one transaction,
+// which is committed if fn returns nil and rolled back otherwise, fn's error
+// being returned. A check followed by a write inside fn therefore cannot
+// race with another request.
+//
+// When the database reports a conflict with a concurrent transaction, such
+// as SQLITE_BUSY or a PostgreSQL serialization failure, the transaction is
+// rolled back and fn runs again from the start, so it must not have effects
+// outside the database. If it still conflicts after a few attempts, the
+// error wraps ErrConflict. Calling WithTx on the models given to fn starts a
+// nested transaction that can fail without failing the outer one.
+func (m Models) WithTx(ctx context.Context, fn func(tx Models) error) error {
+	return m.withTx(ctx, fn)
+}
+
+// runTx runs fn in a transaction on db, retrying it on conflicts unless db
+// is itself a transaction.
+func runTx(ctx context.Context, db DBTX, d Dialect, fn func(tx DBTX) error) error {
+	ctx, span := startSpan(ctx, "Models.WithTx")
+	defer span.End()
+	_, nested := db.(*sql.Tx)
+	for attempt := 1; ; attempt++ {
+		err := func() error {
+			tx, err := begin(ctx, db, d.txOptions())
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			if err := fn(tx.DBTX); err != nil {
+				return err
+			}
+			return tx.Commit()
+		}()
+		if err == nil || nested || attempt == maxTxAttempts || !retryable(err) {
+			return translate(err)
+		}
+		// Back off by a random amount so that the transactions that
+		// collided do not collide again.
+		delay := time.Duration(rand.Int64N(int64(10 * time.Millisecond << attempt)))
+		span.AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt+1), attribute.String("error", err.Error())))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// txOptions are the options of transactions begun by WithTx. SQLite
+// transactions are serializable anyway; PostgreSQL has to be asked, or two
+// transactions could both pass a check before either writes.
+func (d Dialect) txOptions() *sql.TxOptions {
+	if d == Postgres {
+		return &sql.TxOptions{Isolation: sql.LevelSerializable}
+	}
+	return nil
+}
+
+// retryable reports whether err means that a transaction lost a race with
+// another one and would likely succeed if run again.
+func retryable(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// serialization_failure and deadlock_detected
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	return false
+}
+
+// modelTx is a transaction begun by a model method or WithTx. On a
+// database handle it is a real transaction; inside one it is a savepoint,
+// so that the method's writes are still all or nothing without committing
+// the caller's transaction early.
+type modelTx struct {
+	DBTX
+	tx   *sql.Tx
+	ctx  context.Context
+	done bool
+}
+
+// begin starts a transaction on db, or a savepoint if db is a transaction.
+func begin(ctx context.Context, db DBTX, opts *sql.TxOptions) (*modelTx, error) {
+	if o, ok := db.(observedDB); ok {
+		tx, err := begin(ctx, o.DBTX, opts)
+		if err != nil {
+			return nil, err
+		}
+		o.DBTX = tx.DBTX
+		tx.DBTX = o
+		return tx, nil
+	}
+	if db, ok := db.(*sql.DB); ok {
+		tx, err := db.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &modelTx{DBTX: tx, tx: tx}, nil
+	}
+	if _, err := db.ExecContext(ctx, "SAVEPOINT model"); err != nil {
+		return nil, err
+	}
+	return &modelTx{DBTX: db, ctx: ctx}, nil
+}
+
+func (t *modelTx) Commit() error {
+	if t.tx != nil {
+		return t.tx.Commit()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.ExecContext(t.ctx, "RELEASE SAVEPOINT model")
+	return err
+}
+
+func (t *modelTx) Rollback() error {
+	if t.tx != nil {
+		return t.tx.Rollback()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	// ROLLBACK TO leaves the savepoint in place, so it is released too.
+	if _, err := t.ExecContext(t.ctx, "ROLLBACK TO SAVEPOINT model"); err != nil {
+		return err
+	}
+	_, err := t.ExecContext(t.ctx, "RELEASE SAVEPOINT model")
+	return err
+}
@@ -2,49 +2,81 @@ package database
 
 import (
 	"context"
-	"database/sql"
-	"time"
 )
 
 type UserModel struct {
-	DB *sql.DB
+	DB       DBTX
+	Timeouts Timeouts
 }
 
+// Roles a user can have. Admins may moderate anything, organizers may manage
+// the events they own and members may only take part in events.
+const (
+	RoleAdmin     = "admin"
+	RoleOrganizer = "organizer"
+	RoleMember    = "member"
+)
+
 type User struct {
 	ID       int    `json:"id"`
 	UserName string `json:"username"`
 	Email    string `json:"email"`
-	Password string `json:"password"`
+	// Password is the bcrypt hash of the user's password. It is left out
+	// of JSON so that responses never carry it.
+	Password string `json:"-"`
+	Role     string `json:"role"`
 }
 
-func (m *UserModel) Insert(user *User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *UserModel) Insert(ctx context.Context, user *User) error {
+	ctx, span := startSpan(ctx, "UserModel.Insert")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
 	defer cancel()
-	query := `INSERT INTO users (username, email, password) VALUES ($1, $2, $3) RETURNING id`
-	return m.DB.QueryRowContext(ctx, query, user.UserName, user.Email, user.Password).Scan(&user.ID)
+	if user.Role == "" {
+		user.Role = RoleOrganizer
+	}
+	query := `INSERT INTO users (username, email, password, role) VALUES ($1, $2, $3, $4) RETURNING id`
+	return translate(m.DB.QueryRowContext(ctx, query, user.UserName, user.Email, user.Password, user.Role).Scan(&user.ID))
 }
 
-func (m *UserModel) GetUser(id int) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *UserModel) GetUser(ctx context.Context, id int) (*User, error) {
+	ctx, span := startSpan(ctx, "UserModel.GetUser")
+	defer span.End()
+	ctx, cancel := m.Timeouts.read(ctx)
 	defer cancel()
 	var user User
-	query := `SELECT id, username, email, password FROM users WHERE id = $1`
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.UserName, &user.Email, &user.Password)
+	query := `SELECT id, username, email, password, role FROM users WHERE id = $1`
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.UserName, &user.Email, &user.Password, &user.Role)
 	if err != nil {
-		return nil, err
+		return nil, translate(err)
 	}
 	return &user, nil
 }
 
-func (m *UserModel) GetByEmail(email string) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, span := startSpan(ctx, "UserModel.GetByEmail")
+	defer span.End()
+	ctx, cancel := m.Timeouts.read(ctx)
 	defer cancel()
 	var user User
 	// Only select the columns needed for scanning
-	query := `SELECT id, username, email, password FROM users WHERE email = $1`
-	err := m.DB.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.UserName, &user.Email, &user.Password)
+	query := `SELECT id, username, email, password, role FROM users WHERE email = $1`
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.UserName, &user.Email, &user.Password, &user.Role)
 	if err != nil {
-		return nil, err
+		return nil, translate(err)
 	}
 	return &user, nil
 }
+
+func (m *UserModel) UpdateRole(ctx context.Context, id int, role string) error {
+	ctx, span := startSpan(ctx, "UserModel.UpdateRole")
+	defer span.End()
+	ctx, cancel := m.Timeouts.write(ctx)
+	defer cancel()
+	query := `UPDATE users SET role = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+	result, err := m.DB.ExecContext(ctx, query, role, id)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
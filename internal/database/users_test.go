@@ -0,0 +1,25 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestUserJSONOmitsPassword(t *testing.T) {
+	hash := "$2a$12$R9h/cIPz0gi.URNNX3kh2OPST9/PgBkqquzi.Ss7KIUgO2t0jWMUW"
+	b, err := json.Marshal(User{ID: 1, UserName: "alice", Email: "alice@example.com", Password: hash, Role: RoleMember})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["password"]; ok || strings.Contains(string(b), hash) {
+		t.Errorf("user JSON %s carries the password hash", b)
+	}
+	if fields["username"] != "alice" || fields["role"] != RoleMember {
+		t.Errorf("user JSON = %s", b)
+	}
+}
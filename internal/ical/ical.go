@@ -0,0 +1,190 @@
+// Package ical writes iCalendar (RFC 5545) documents containing events.
+package ical
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	utcFormat   = "20060102T150405Z"
+	localFormat = "20060102T150405"
+	// maxLineOctets is the longest a content line may be before it has to be
+	// folded, not counting the line break.
+	maxLineOctets = 75
+)
+
+// Status values of an event.
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusTentative = "TENTATIVE"
+	StatusCancelled = "CANCELLED"
+)
+
+// Calendar is a VCALENDAR object.
+type Calendar struct {
+	ProdID string
+	// Name is shown by clients as the calendar's title when subscribing.
+	Name string
+	// RefreshInterval suggests how often subscribers should poll the feed.
+	RefreshInterval time.Duration
+	Events          []*Event
+}
+
+// Event is a VEVENT.
+type Event struct {
+	UID      string
+	Sequence int
+	Stamp    time.Time
+	Start    time.Time
+	End      time.Time
+	// TimeZone is the zone Start, End and the recurrence are written in, so
+	// that a recurring event keeps its local time across DST changes. Times
+	// are written in UTC when it is nil or UTC.
+	TimeZone *time.Location
+	Summary  string
+	// Description and Location are omitted when empty.
+	Description string
+	Location    string
+	URL         string
+	Status      string
+	// RRule and ExDates make the event recurring. ExDates must be the start
+	// times of the excluded occurrences.
+	RRule   string
+	ExDates []time.Time
+	// RecurrenceID marks the event as a changed instance of the series with
+	// the same UID, identified by the start the series gives it.
+	RecurrenceID time.Time
+}
+
+// Encode returns the calendar in iCalendar format.
+func (c *Calendar) Encode() []byte {
+	var w writer
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", c.ProdID)
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		w.line("X-WR-CALNAME", escape(c.Name))
+	}
+	if c.RefreshInterval > 0 {
+		d := duration(c.RefreshInterval)
+		w.line("REFRESH-INTERVAL;VALUE=DURATION", d)
+		w.line("X-PUBLISHED-TTL", d)
+	}
+	for _, tz := range c.timeZones() {
+		tz.encode(&w)
+	}
+	for _, e := range c.Events {
+		e.encode(&w)
+	}
+	w.line("END", "VCALENDAR")
+	return w.buf.Bytes()
+}
+
+// WriteTo writes the encoded calendar to out.
+func (c *Calendar) WriteTo(out io.Writer) (int64, error) {
+	n, err := out.Write(c.Encode())
+	return int64(n), err
+}
+
+func (e *Event) encode(w *writer) {
+	w.line("BEGIN", "VEVENT")
+	w.line("UID", e.UID)
+	w.line("DTSTAMP", e.Stamp.UTC().Format(utcFormat))
+	if e.Sequence > 0 {
+		w.line("SEQUENCE", strconv.Itoa(e.Sequence))
+	}
+	if !e.RecurrenceID.IsZero() {
+		w.timeLine("RECURRENCE-ID", e.RecurrenceID, e.TimeZone)
+	}
+	w.timeLine("DTSTART", e.Start, e.TimeZone)
+	if !e.End.IsZero() {
+		w.timeLine("DTEND", e.End, e.TimeZone)
+	}
+	if e.RRule != "" {
+		w.line("RRULE", e.RRule)
+	}
+	for _, d := range e.ExDates {
+		w.timeLine("EXDATE", d, e.TimeZone)
+	}
+	w.line("SUMMARY", escape(e.Summary))
+	if e.Description != "" {
+		w.line("DESCRIPTION", escape(e.Description))
+	}
+	if e.Location != "" {
+		w.line("LOCATION", escape(e.Location))
+	}
+	if e.URL != "" {
+		w.line("URL", e.URL)
+	}
+	if e.Status != "" {
+		w.line("STATUS", e.Status)
+	}
+	w.line("END", "VEVENT")
+}
+
+type writer struct {
+	buf bytes.Buffer
+}
+
+func (w *writer) timeLine(name string, t time.Time, loc *time.Location) {
+	if !isZoned(loc) {
+		w.line(name, t.UTC().Format(utcFormat))
+		return
+	}
+	w.line(name+";TZID="+loc.String(), t.In(loc).Format(localFormat))
+}
+
+func isZoned(loc *time.Location) bool {
+	return loc != nil && loc != time.UTC && loc.String() != "UTC"
+}
+
+// line writes a content line, folding it so that no physical line exceeds
+// 75 octets. Folds never split a UTF-8 sequence.
+func (w *writer) line(name, value string) {
+	s := name + ":" + value
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.buf.WriteString(s[:cut])
+		w.buf.WriteString("\r\n ")
+		s = s[cut:]
+		// The leading space of a continuation line counts towards its length.
+		limit = maxLineOctets - 1
+	}
+	w.buf.WriteString(s)
+	w.buf.WriteString("\r\n")
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escape escapes a TEXT value.
+func escape(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// duration formats d as an RFC 5545 duration such as PT1H30M.
+func duration(d time.Duration) string {
+	s := "PT"
+	if h := int(d / time.Hour); h > 0 {
+		s += strconv.Itoa(h) + "H"
+		d -= time.Duration(h) * time.Hour
+	}
+	if m := int(d / time.Minute); m > 0 {
+		s += strconv.Itoa(m) + "M"
+		d -= time.Duration(m) * time.Minute
+	}
+	if sec := int(d / time.Second); sec > 0 || s == "PT" {
+		s += strconv.Itoa(sec) + "S"
+	}
+	return s
+}
@@ -0,0 +1,161 @@
+package ical
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func mustLoad(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+var (
+	berlin = mustLoad("Europe/Berlin")
+	tokyo  = mustLoad("Asia/Tokyo")
+	stamp  = time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+)
+
+// TestEncode compares encoded calendars with the .ics files in testdata.
+// Run it with -update to rewrite them after an intended change.
+func TestEncode(t *testing.T) {
+	series := &Event{
+		UID:      "event-1@example.com",
+		Sequence: 2,
+		Stamp:    stamp,
+		Start:    time.Date(2030, 3, 24, 9, 0, 0, 0, berlin),
+		End:      time.Date(2030, 3, 24, 10, 0, 0, 0, berlin),
+		TimeZone: berlin,
+		Summary:  "Weekly sync",
+		URL:      "https://example.com/api/v1/events/1",
+		Status:   StatusConfirmed,
+		RRule:    "FREQ=WEEKLY;COUNT=5",
+		ExDates:  []time.Time{time.Date(2030, 4, 7, 9, 0, 0, 0, berlin)},
+	}
+	moved := *series
+	moved.RRule, moved.ExDates = "", nil
+	moved.RecurrenceID = time.Date(2030, 3, 31, 9, 0, 0, 0, berlin)
+	moved.Start = time.Date(2030, 3, 31, 11, 0, 0, 0, berlin)
+	moved.End = time.Date(2030, 3, 31, 12, 0, 0, 0, berlin)
+	moved.Location = "Room 2"
+	cancelled := *series
+	cancelled.RRule, cancelled.ExDates = "", nil
+	cancelled.RecurrenceID = time.Date(2030, 4, 14, 9, 0, 0, 0, berlin)
+	cancelled.Start = cancelled.RecurrenceID
+	cancelled.End = time.Date(2030, 4, 14, 10, 0, 0, 0, berlin)
+	cancelled.Status = StatusCancelled
+
+	tests := []struct {
+		name string
+		cal  *Calendar
+	}{
+		{"utc", &Calendar{
+			ProdID: "-//go-rest//test//EN",
+			Events: []*Event{{
+				UID:         "event-1@example.com",
+				Stamp:       stamp,
+				Start:       time.Date(2030, 3, 10, 18, 0, 0, 0, time.UTC),
+				End:         time.Date(2030, 3, 10, 21, 0, 0, 0, time.UTC),
+				Summary:     "Go meetup; talks, pizza",
+				Description: "Line one\nLine two with a backslash \\ and a long tail that has to be folded: äöü äöü äöü äöü äöü",
+				Location:    "Berlin",
+				Status:      StatusTentative,
+			}},
+		}},
+		{"feed", &Calendar{
+			ProdID:          "-//go-rest//test//EN",
+			Name:            "My events",
+			RefreshInterval: 90 * time.Minute,
+			Events: []*Event{{
+				UID:      "event-2@example.com",
+				Stamp:    stamp,
+				Start:    time.Date(2030, 3, 10, 18, 0, 0, 0, time.UTC),
+				Summary:  "No end",
+				Status:   StatusConfirmed,
+				TimeZone: time.UTC,
+			}},
+		}},
+		{"recurring", &Calendar{
+			ProdID: "-//go-rest//test//EN",
+			Events: []*Event{series, &moved, &cancelled},
+		}},
+		{"timezones", &Calendar{
+			ProdID: "-//go-rest//test//EN",
+			Events: []*Event{
+				{UID: "event-3@example.com", Stamp: stamp, Start: time.Date(2030, 7, 1, 9, 0, 0, 0, tokyo), TimeZone: tokyo, Summary: "Tokyo"},
+				{UID: "event-4@example.com", Stamp: stamp, Start: time.Date(2031, 1, 1, 9, 0, 0, 0, berlin), TimeZone: berlin, Summary: "Later"},
+				// The earlier event decides the year of the VTIMEZONE.
+				{UID: "event-5@example.com", Stamp: stamp, Start: time.Date(2030, 1, 1, 9, 0, 0, 0, berlin), TimeZone: berlin, Summary: "Earlier"},
+				{UID: "event-6@example.com", Stamp: stamp, Start: time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC), Summary: "Deleted", Status: StatusCancelled},
+			},
+		}},
+	}
+	for _, tt := range tests {
+		got := tt.cal.Encode()
+		file := filepath.Join("testdata", tt.name+".ics")
+		if *update {
+			if err := os.WriteFile(file, got, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s: Encode =\n%s\nwant\n%s", tt.name, got, want)
+		}
+	}
+}
+
+func TestLinesAreFolded(t *testing.T) {
+	var w writer
+	w.line("DESCRIPTION", "ääääääääääääääääääääääääääääääääääääääääääääääääääääääääääääääääääääää")
+	for i, line := range splitLines(w.buf.String()) {
+		if len(line) > maxLineOctets {
+			t.Errorf("line %d is %d octets: %q", i, len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line %d splits a UTF-8 sequence: %q", i, line)
+		}
+		if i > 0 && line[0] != ' ' {
+			t.Errorf("continuation line %d does not start with a space: %q", i, line)
+		}
+	}
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	for len(s) > 0 {
+		i := 0
+		for i < len(s)-1 && s[i:i+2] != "\r\n" {
+			i++
+		}
+		lines = append(lines, s[:i])
+		s = s[min(i+2, len(s)):]
+	}
+	return lines
+}
+
+func TestDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		0:                            "PT0S",
+		45 * time.Second:             "PT45S",
+		90 * time.Minute:             "PT1H30M",
+		24*time.Hour + 5*time.Second: "PT24H5S",
+	} {
+		if got := duration(d); got != want {
+			t.Errorf("duration(%v) = %s, want %s", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// timeZone is a VTIMEZONE describing a location from the year before the
+// earliest event that uses it.
+type timeZone struct {
+	loc  *time.Location
+	year int
+}
+
+// timeZones returns the VTIMEZONEs needed by the events of the calendar,
+// sorted by TZID.
+func (c *Calendar) timeZones() []*timeZone {
+	byName := map[string]*timeZone{}
+	for _, e := range c.Events {
+		if !isZoned(e.TimeZone) {
+			continue
+		}
+		// Start a year early so that the first observance already
+		// covers the earliest event.
+		year := e.Start.In(e.TimeZone).Year() - 1
+		if tz, ok := byName[e.TimeZone.String()]; ok {
+			tz.year = min(tz.year, year)
+			continue
+		}
+		byName[e.TimeZone.String()] = &timeZone{loc: e.TimeZone, year: year}
+	}
+	out := make([]*timeZone, 0, len(byName))
+	for _, tz := range byName {
+		out = append(out, tz)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].loc.String() < out[j].loc.String() })
+	return out
+}
+
+// encode writes the zone with one observance per offset change in its
+// year, each repeating yearly on the same weekday of the month. That is how
+// DST rules are written today; zones whose rules change later are only
+// described correctly until then, which calendar clients that know the
+// IANA name anyway do not mind.
+func (tz *timeZone) encode(w *writer) {
+	w.line("BEGIN", "VTIMEZONE")
+	w.line("TZID", tz.loc.String())
+
+	start := time.Date(tz.year, time.January, 1, 0, 0, 0, 0, tz.loc)
+	end := start.AddDate(1, 0, 0)
+	var transitions []time.Time
+	for t := start; ; {
+		_, next := t.ZoneBounds()
+		if next.IsZero() || !next.Before(end) {
+			break
+		}
+		transitions = append(transitions, next)
+		t = next
+	}
+
+	if len(transitions) == 0 {
+		name, offset := start.Zone()
+		w.line("BEGIN", "STANDARD")
+		w.line("DTSTART", "19700101T000000")
+		w.line("TZOFFSETFROM", formatOffset(offset))
+		w.line("TZOFFSETTO", formatOffset(offset))
+		w.line("TZNAME", escape(name))
+		w.line("END", "STANDARD")
+	}
+	for _, t := range transitions {
+		_, from := t.Add(-time.Second).Zone()
+		name, to := t.Zone()
+		kind := "STANDARD"
+		if t.IsDST() {
+			kind = "DAYLIGHT"
+		}
+		// Observances start at the local time before the change.
+		local := t.In(time.FixedZone("", from))
+		w.line("BEGIN", kind)
+		w.line("DTSTART", local.Format(localFormat))
+		w.line("RRULE", fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%s", local.Month(), weekdayOfMonth(local)))
+		w.line("TZOFFSETFROM", formatOffset(from))
+		w.line("TZOFFSETTO", formatOffset(to))
+		w.line("TZNAME", escape(name))
+		w.line("END", kind)
+	}
+	w.line("END", "VTIMEZONE")
+}
+
+// weekdayOfMonth returns the BYDAY value for the weekday of t within its
+// month, e.g. "2SU" or "-1SU" when it falls in the last week.
+func weekdayOfMonth(t time.Time) string {
+	day := [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}[t.Weekday()]
+	daysInMonth := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if t.Day()+7 > daysInMonth {
+		return "-1" + day
+	}
+	return strconv.Itoa((t.Day()-1)/7+1) + day
+}
+
+// formatOffset formats a UTC offset in seconds as +HHMM.
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds/60%60)
+}
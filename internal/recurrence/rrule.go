@@ -0,0 +1,378 @@
+// Package recurrence implements the subset of RFC 5545 recurrence rules
+// that events use: FREQ, INTERVAL, BYDAY, COUNT and UNTIL, plus EXDATE
+// exceptions.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// maxPeriods bounds how many periods (days, weeks, months or years) are
+// walked while expanding a rule, so an open-ended rule queried far in the
+// future cannot loop forever.
+const maxPeriods = 100000
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+// WeekdayNum is one BYDAY entry. N is the ordinal within the month, e.g. 2
+// for "2TU" or -1 for "-1FR", and 0 for every such weekday.
+type WeekdayNum struct {
+	Day time.Weekday
+	N   int
+}
+
+// Rule is a parsed RRULE.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	Count    int
+	Until    time.Time
+	ByDay    []WeekdayNum
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Parse parses an RRULE value such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE".
+// A leading "RRULE:" is accepted.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, fmt.Errorf("%w: empty rule", ErrInvalidRule)
+	}
+	r := &Rule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: malformed part %q", ErrInvalidRule, part)
+		}
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			switch f := Frequency(strings.ToUpper(value)); f {
+			case Daily, Weekly, Monthly, Yearly:
+				r.Freq = f
+			default:
+				return nil, fmt.Errorf("%w: unsupported FREQ %q", ErrInvalidRule, value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("%w: INTERVAL must be a positive integer", ErrInvalidRule)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("%w: COUNT must be a positive integer", ErrInvalidRule)
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := parseUntil(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: UNTIL must be YYYYMMDD or YYYYMMDDTHHMMSSZ", ErrInvalidRule)
+			}
+			r.Until = t
+		case "BYDAY":
+			for _, d := range strings.Split(strings.ToUpper(value), ",") {
+				wd, err := parseWeekdayNum(d)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "WKST":
+			if value != "MO" {
+				return nil, fmt.Errorf("%w: only WKST=MO is supported", ErrInvalidRule)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unsupported part %q", ErrInvalidRule, name)
+		}
+	}
+	if r.Freq == "" {
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, fmt.Errorf("%w: COUNT and UNTIL cannot both be set", ErrInvalidRule)
+	}
+	for _, wd := range r.ByDay {
+		if wd.N != 0 && r.Freq != Monthly {
+			return nil, fmt.Errorf("%w: ordinal BYDAY is only supported with FREQ=MONTHLY", ErrInvalidRule)
+		}
+	}
+	if len(r.ByDay) > 0 && r.Freq == Yearly {
+		return nil, fmt.Errorf("%w: BYDAY is not supported with FREQ=YEARLY", ErrInvalidRule)
+	}
+	return r, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("20060102", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// A date-only UNTIL includes the whole day.
+	return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+func parseWeekdayNum(s string) (WeekdayNum, error) {
+	if len(s) < 2 {
+		return WeekdayNum{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, s)
+	}
+	day, ok := weekdays[s[len(s)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, s)
+	}
+	wd := WeekdayNum{Day: day}
+	if prefix := s[:len(s)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return WeekdayNum{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, s)
+		}
+		wd.N = n
+	}
+	return wd, nil
+}
+
+// String formats the rule in canonical RRULE form.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = wd.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+func (wd WeekdayNum) String() string {
+	name := strings.ToUpper(wd.Day.String()[:2])
+	if wd.N != 0 {
+		return strconv.Itoa(wd.N) + name
+	}
+	return name
+}
+
+// Set is a recurring series: the first occurrence, the rule generating the
+// rest and the dates excluded from it.
+type Set struct {
+	DTStart time.Time
+	Rule    *Rule
+	// ExDates are matched by calendar date in DTStart's location, which is
+	// exact because a rule produces at most one occurrence per day.
+	ExDates []time.Time
+}
+
+// Between returns the occurrences of the set in [from, to), in order.
+// Excluded dates still count towards COUNT, as in RFC 5545.
+func (s *Set) Between(from, to time.Time) []time.Time {
+	excluded := make(map[string]bool, len(s.ExDates))
+	for _, d := range s.ExDates {
+		excluded[dateKey(d.In(s.DTStart.Location()))] = true
+	}
+	var out []time.Time
+	s.each(func(t time.Time) bool {
+		if !t.Before(to) {
+			return false
+		}
+		if !t.Before(from) && !excluded[dateKey(t)] {
+			out = append(out, t)
+		}
+		return true
+	})
+	return out
+}
+
+// Includes reports whether the rule generates an occurrence on the calendar
+// date of t, ignoring EXDATEs.
+func (s *Set) Includes(t time.Time) bool {
+	key := dateKey(t.In(s.DTStart.Location()))
+	found := false
+	s.each(func(o time.Time) bool {
+		k := dateKey(o)
+		if k == key {
+			found = true
+		}
+		return k < key
+	})
+	return found
+}
+
+// each calls fn with every occurrence in order until fn returns false or
+// the rule ends.
+func (s *Set) each(fn func(time.Time) bool) {
+	start := s.DTStart
+	r := s.Rule
+	if r == nil {
+		fn(start)
+		return
+	}
+	emitted := 0
+	emit := func(t time.Time) bool {
+		if t.Before(start) {
+			return true
+		}
+		if !r.Until.IsZero() && t.After(r.Until) {
+			return false
+		}
+		if r.Count > 0 && emitted >= r.Count {
+			return false
+		}
+		emitted++
+		return fn(t)
+	}
+
+	// DTSTART is always the first occurrence, even if the rule would not
+	// generate it.
+	if !emit(start) {
+		return
+	}
+	for period := 0; period < maxPeriods; period++ {
+		for _, t := range s.candidates(period) {
+			if !t.After(start) {
+				continue
+			}
+			if !emit(t) {
+				return
+			}
+		}
+	}
+}
+
+// candidates returns the occurrences the rule generates in the given period
+// counted from DTSTART, sorted.
+func (s *Set) candidates(period int) []time.Time {
+	start := s.DTStart
+	r := s.Rule
+	n := period * r.Interval
+	y, m, d := start.Date()
+	hh, mm, ss := start.Clock()
+	loc := start.Location()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hh, mm, ss, start.Nanosecond(), loc)
+	}
+
+	switch r.Freq {
+	case Daily:
+		t := at(y, m, d+n)
+		if len(r.ByDay) > 0 && !r.hasWeekday(t.Weekday()) {
+			return nil
+		}
+		return []time.Time{t}
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			return []time.Time{at(y, m, d+7*n)}
+		}
+		// Weeks start on Monday (WKST=MO).
+		monday := d - (int(start.Weekday())+6)%7 + 7*n
+		var out []time.Time
+		for i := 0; i < 7; i++ {
+			t := at(y, m, monday+i)
+			if r.hasWeekday(t.Weekday()) {
+				out = append(out, t)
+			}
+		}
+		return out
+	case Monthly:
+		first := time.Date(y, m+time.Month(n), 1, 0, 0, 0, 0, loc)
+		if len(r.ByDay) == 0 {
+			// Months without the start day (e.g. the 31st) are skipped.
+			t := at(first.Year(), first.Month(), d)
+			if t.Month() != first.Month() {
+				return nil
+			}
+			return []time.Time{t}
+		}
+		return r.monthDays(first, at)
+	case Yearly:
+		t := at(y+n, m, d)
+		if t.Month() != m {
+			return nil
+		}
+		return []time.Time{t}
+	}
+	return nil
+}
+
+// monthDays expands BYDAY within the month starting at first.
+func (r *Rule) monthDays(first time.Time, at func(int, time.Month, int) time.Time) []time.Time {
+	daysInMonth := first.AddDate(0, 1, -1).Day()
+	seen := map[int]bool{}
+	var days []int
+	for _, wd := range r.ByDay {
+		var matches []int
+		for d := 1; d <= daysInMonth; d++ {
+			if time.Weekday((int(first.Weekday())+d-1)%7) == wd.Day {
+				matches = append(matches, d)
+			}
+		}
+		switch {
+		case wd.N == 0:
+		case wd.N > 0 && wd.N <= len(matches):
+			matches = matches[wd.N-1 : wd.N]
+		case wd.N < 0 && -wd.N <= len(matches):
+			matches = matches[len(matches)+wd.N : len(matches)+wd.N+1]
+		default:
+			matches = nil
+		}
+		for _, d := range matches {
+			if !seen[d] {
+				seen[d] = true
+				days = append(days, d)
+			}
+		}
+	}
+	sort.Ints(days)
+	out := make([]time.Time, len(days))
+	for i, d := range days {
+		out[i] = at(first.Year(), first.Month(), d)
+	}
+	return out
+}
+
+func (r *Rule) hasWeekday(day time.Weekday) bool {
+	for _, wd := range r.ByDay {
+		if wd.Day == day {
+			return true
+		}
+	}
+	return false
+}
+
+func dateKey(t time.Time) string {
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,230 @@
+package recurrence
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseString(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"FREQ=DAILY", "FREQ=DAILY"},
+		{"RRULE:freq=daily;count=5", "FREQ=DAILY;COUNT=5"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE"},
+		{"FREQ=WEEKLY;WKST=MO;BYDAY=TU", "FREQ=WEEKLY;BYDAY=TU"},
+		{"FREQ=MONTHLY;BYDAY=-1FR;UNTIL=20301231T180000Z", "FREQ=MONTHLY;BYDAY=-1FR;UNTIL=20301231T180000Z"},
+		{"FREQ=MONTHLY;BYDAY=2TU,4TH;COUNT=10", "FREQ=MONTHLY;BYDAY=2TU,4TH;COUNT=10"},
+		{"FREQ=YEARLY;INTERVAL=1", "FREQ=YEARLY"},
+		// A date-only UNTIL includes the whole day.
+		{"FREQ=DAILY;UNTIL=20301231", "FREQ=DAILY;UNTIL=20301231T235959Z"},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got := r.String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.in, got, tt.want)
+		}
+		// The canonical form parses to the same rule.
+		again, err := Parse(tt.want)
+		if err != nil || again.String() != tt.want {
+			t.Errorf("Parse(%q) = %v, %v; want it to round-trip", tt.want, again, err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"RRULE:",
+		"COUNT=3",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;COUNT",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;INTERVAL=-1",
+		"FREQ=DAILY;COUNT=3;UNTIL=20300101",
+		"FREQ=DAILY;UNTIL=2030-01-01",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYDAY=0MO",
+		"FREQ=MONTHLY;BYDAY=6MO",
+		"FREQ=YEARLY;BYDAY=MO",
+		"FREQ=MONTHLY;BYMONTHDAY=31",
+		"FREQ=WEEKLY;WKST=SU",
+	} {
+		if r, err := Parse(in); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("Parse(%q) = %v, %v; want ErrInvalidRule", in, r, err)
+		}
+	}
+}
+
+var berlin = mustLoad("Europe/Berlin")
+
+func mustLoad(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+func utc(y int, m time.Month, d, hh, mm int) time.Time {
+	return time.Date(y, m, d, hh, mm, 0, 0, time.UTC)
+}
+
+func mustParse(t *testing.T, rule string) *Rule {
+	t.Helper()
+	if rule == "" {
+		return nil
+	}
+	r, err := Parse(rule)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", rule, err)
+	}
+	return r
+}
+
+func format(times []time.Time) string {
+	s := make([]string, len(times))
+	for i, t := range times {
+		s[i] = t.Format("2006-01-02T15:04Z07:00")
+	}
+	return strings.Join(s, ",")
+}
+
+func TestBetween(t *testing.T) {
+	// 2030-01-01 is a Tuesday.
+	start := utc(2030, 1, 1, 10, 0)
+	all := [2]time.Time{utc(2000, 1, 1, 0, 0), utc(2100, 1, 1, 0, 0)}
+	tests := []struct {
+		name    string
+		start   time.Time
+		rule    string
+		exdates []time.Time
+		window  [2]time.Time
+		want    string
+	}{
+		{
+			name: "no rule", start: start, window: all,
+			want: "2030-01-01T10:00Z",
+		},
+		{
+			name: "daily count", start: start, rule: "FREQ=DAILY;COUNT=3", window: all,
+			want: "2030-01-01T10:00Z,2030-01-02T10:00Z,2030-01-03T10:00Z",
+		},
+		{
+			name: "date-only until includes the day", start: start, rule: "FREQ=DAILY;UNTIL=20300103", window: all,
+			want: "2030-01-01T10:00Z,2030-01-02T10:00Z,2030-01-03T10:00Z",
+		},
+		{
+			name: "until before the time of day", start: start, rule: "FREQ=DAILY;UNTIL=20300103T095959Z", window: all,
+			want: "2030-01-01T10:00Z,2030-01-02T10:00Z",
+		},
+		{
+			name: "exdates count towards count", start: start, rule: "FREQ=DAILY;COUNT=3",
+			exdates: []time.Time{utc(2030, 1, 2, 0, 0)}, window: all,
+			want: "2030-01-01T10:00Z,2030-01-03T10:00Z",
+		},
+		{
+			name: "window", start: start, rule: "FREQ=DAILY", window: [2]time.Time{utc(2030, 1, 3, 0, 0), utc(2030, 1, 5, 10, 0)},
+			want: "2030-01-03T10:00Z,2030-01-04T10:00Z",
+		},
+		{
+			name: "daily on weekdays", start: utc(2030, 1, 4, 10, 0), rule: "FREQ=DAILY;BYDAY=MO,FR;COUNT=3", window: all,
+			want: "2030-01-04T10:00Z,2030-01-07T10:00Z,2030-01-11T10:00Z",
+		},
+		{
+			name: "every other week on two days", start: utc(2030, 1, 2, 10, 0), rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=5", window: all,
+			want: "2030-01-02T10:00Z,2030-01-14T10:00Z,2030-01-16T10:00Z,2030-01-28T10:00Z,2030-01-30T10:00Z",
+		},
+		{
+			name: "dtstart off the rule", start: start, rule: "FREQ=WEEKLY;BYDAY=MO;COUNT=3", window: all,
+			want: "2030-01-01T10:00Z,2030-01-07T10:00Z,2030-01-14T10:00Z",
+		},
+		{
+			name: "last friday", start: utc(2030, 1, 25, 18, 0), rule: "FREQ=MONTHLY;BYDAY=-1FR;COUNT=4", window: all,
+			want: "2030-01-25T18:00Z,2030-02-22T18:00Z,2030-03-29T18:00Z,2030-04-26T18:00Z",
+		},
+		{
+			name: "second tuesday", start: utc(2030, 1, 8, 18, 0), rule: "FREQ=MONTHLY;BYDAY=2TU;COUNT=3", window: all,
+			want: "2030-01-08T18:00Z,2030-02-12T18:00Z,2030-03-12T18:00Z",
+		},
+		{
+			name: "fifth friday only in months that have one", start: utc(2030, 3, 29, 18, 0), rule: "FREQ=MONTHLY;BYDAY=5FR;COUNT=3", window: all,
+			want: "2030-03-29T18:00Z,2030-05-31T18:00Z,2030-08-30T18:00Z",
+		},
+		{
+			name: "31st skips short months", start: utc(2030, 1, 31, 10, 0), rule: "FREQ=MONTHLY;COUNT=4", window: all,
+			want: "2030-01-31T10:00Z,2030-03-31T10:00Z,2030-05-31T10:00Z,2030-07-31T10:00Z",
+		},
+		{
+			name: "29 February", start: utc(2028, 2, 29, 10, 0), rule: "FREQ=YEARLY;COUNT=3", window: all,
+			want: "2028-02-29T10:00Z,2032-02-29T10:00Z,2036-02-29T10:00Z",
+		},
+		{
+			// Summer time starts on 31 March 2030; the local time stays.
+			name: "across DST", start: time.Date(2030, 3, 24, 9, 0, 0, 0, berlin), rule: "FREQ=WEEKLY;COUNT=3", window: all,
+			want: "2030-03-24T09:00+01:00,2030-03-31T09:00+02:00,2030-04-07T09:00+02:00",
+		},
+		{
+			name: "exdates in the series' timezone", start: time.Date(2030, 10, 20, 0, 30, 0, 0, berlin), rule: "FREQ=WEEKLY;COUNT=3",
+			exdates: []time.Time{time.Date(2030, 10, 26, 22, 30, 0, 0, time.UTC)}, window: all,
+			want: "2030-10-20T00:30+02:00,2030-11-03T00:30+01:00",
+		},
+	}
+	for _, tt := range tests {
+		set := &Set{DTStart: tt.start, Rule: mustParse(t, tt.rule), ExDates: tt.exdates}
+		if got := format(set.Between(tt.window[0], tt.window[1])); got != tt.want {
+			t.Errorf("%s: Between = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBetweenStopsAfterMaxPeriods(t *testing.T) {
+	start := utc(2030, 1, 1, 10, 0)
+	set := &Set{DTStart: start, Rule: mustParse(t, "FREQ=DAILY")}
+	last := start.AddDate(0, 0, maxPeriods-1)
+	if got := set.Between(last, last.AddDate(0, 0, 1)); len(got) != 1 || !got[0].Equal(last) {
+		t.Errorf("Between around the last period = %v, want %v", got, last)
+	}
+	if got := set.Between(last.AddDate(0, 0, 1), last.AddDate(100, 0, 0)); len(got) != 0 {
+		t.Errorf("Between beyond maxPeriods = %d occurrences, want none", len(got))
+	}
+	if set.Includes(last.AddDate(0, 0, 1)) {
+		t.Errorf("Includes beyond maxPeriods = true")
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	tests := []struct {
+		start time.Time
+		rule  string
+		date  time.Time
+		want  bool
+	}{
+		{utc(2030, 1, 1, 10, 0), "FREQ=WEEKLY;BYDAY=TU", utc(2030, 1, 8, 0, 0), true},
+		{utc(2030, 1, 1, 10, 0), "FREQ=WEEKLY;BYDAY=TU", utc(2030, 1, 9, 0, 0), false},
+		{utc(2030, 1, 1, 10, 0), "FREQ=WEEKLY;BYDAY=TU", utc(2029, 12, 25, 0, 0), false},
+		{utc(2030, 1, 1, 10, 0), "FREQ=WEEKLY;BYDAY=TU;COUNT=2", utc(2030, 1, 15, 0, 0), false},
+		{utc(2030, 1, 25, 18, 0), "FREQ=MONTHLY;BYDAY=-1FR", utc(2030, 3, 29, 0, 0), true},
+		{utc(2030, 1, 25, 18, 0), "FREQ=MONTHLY;BYDAY=-1FR", utc(2030, 3, 22, 0, 0), false},
+		{utc(2030, 1, 31, 10, 0), "FREQ=MONTHLY", utc(2030, 2, 28, 0, 0), false},
+		// The date is taken in the series' timezone.
+		{time.Date(2030, 1, 8, 0, 30, 0, 0, berlin), "FREQ=WEEKLY", utc(2030, 1, 14, 23, 30), true},
+	}
+	for _, tt := range tests {
+		set := &Set{DTStart: tt.start, Rule: mustParse(t, tt.rule)}
+		if got := set.Includes(tt.date); got != tt.want {
+			t.Errorf("%s from %v: Includes(%v) = %v, want %v", tt.rule, tt.start, tt.date, got, tt.want)
+		}
+	}
+
+	// EXDATEs are ignored.
+	set := &Set{DTStart: utc(2030, 1, 1, 10, 0), Rule: mustParse(t, "FREQ=DAILY"), ExDates: []time.Time{utc(2030, 1, 2, 0, 0)}}
+	if !set.Includes(utc(2030, 1, 2, 0, 0)) {
+		t.Errorf("Includes of an excluded date = false, want true")
+	}
+}